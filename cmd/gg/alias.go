@@ -0,0 +1,277 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+)
+
+// aliasConfigPrefix is the prefix of the git configuration settings
+// that define user aliases. The rest of the setting name is the alias.
+const aliasConfigPrefix = "gg.alias."
+
+// aliasStackKey is the context key for the list of aliases currently
+// being expanded.
+type aliasStackKey struct{}
+
+// runAlias runs the user alias with the given name. It returns false if
+// there is no such alias. Aliases can't shadow built-in commands, since
+// dispatch only calls runAlias for unknown commands.
+//
+// An alias's value is either a gg command line or, if it starts with
+// "!", a shell command. In a gg command line, "$1" through "$9" are
+// replaced with the corresponding argument and "$@" with all of the
+// arguments. If the command line doesn't reference any arguments, they
+// are appended to it. Shell commands receive the arguments as
+// positional parameters.
+func runAlias(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, name string, args []string) (bool, error) {
+	cfg, err := cc.readConfig(ctx)
+	if err != nil {
+		return false, err
+	}
+	value := cfg.Value(aliasConfigPrefix + name)
+	if value == "" {
+		return false, nil
+	}
+	stack, _ := ctx.Value(aliasStackKey{}).([]string)
+	for i, prev := range stack {
+		if prev == name {
+			return true, fmt.Errorf("alias %s: recursive alias (%s -> %s)", name, strings.Join(stack[i:], " -> "), name)
+		}
+	}
+	ctx = context.WithValue(ctx, aliasStackKey{}, append(stack[:len(stack):len(stack)], name))
+
+	if strings.HasPrefix(value, "!") {
+		c := exec.CommandContext(ctx, "sh", append([]string{"-c", value[1:], name}, args...)...)
+		c.Dir = cc.dir
+		c.Env = cc.env
+		c.Stdin = cc.stdin
+		c.Stdout = cc.stdout
+		c.Stderr = cc.stderr
+		if err := c.Run(); err != nil {
+			return true, fmt.Errorf("alias %s: %v", name, err)
+		}
+		return true, nil
+	}
+	expanded, err := expandAlias(value, args)
+	if err != nil {
+		return true, fmt.Errorf("alias %s: %v", name, err)
+	}
+	if len(expanded) == 0 {
+		return true, fmt.Errorf("alias %s: empty command", name)
+	}
+	return true, runCommand(ctx, cc, globalFlags, expanded[0], expanded[1:])
+}
+
+// An aliasWord is a word in an alias's command line. It is made up of
+// literal text and references to arguments.
+type aliasWord []aliasPart
+
+type aliasPart struct {
+	text string
+	arg  int // 1-based argument number, allArgs for "$@", or 0 for text
+}
+
+const allArgs = -1
+
+// expandAlias splits an alias's command line into words and
+// substitutes the arguments into it.
+func expandAlias(value string, args []string) ([]string, error) {
+	words, err := splitAliasWords(value)
+	if err != nil {
+		return nil, err
+	}
+	var expanded []string
+	usesArgs := false
+	for _, w := range words {
+		if len(w) == 1 && w[0].arg == allArgs {
+			// A bare "$@" expands to one word per argument.
+			usesArgs = true
+			expanded = append(expanded, args...)
+			continue
+		}
+		sb := new(strings.Builder)
+		for _, part := range w {
+			switch {
+			case part.arg == allArgs:
+				usesArgs = true
+				sb.WriteString(strings.Join(args, " "))
+			case part.arg > 0:
+				usesArgs = true
+				if part.arg <= len(args) {
+					sb.WriteString(args[part.arg-1])
+				}
+			default:
+				sb.WriteString(part.text)
+			}
+		}
+		expanded = append(expanded, sb.String())
+	}
+	if !usesArgs {
+		expanded = append(expanded, args...)
+	}
+	return expanded, nil
+}
+
+// splitAliasWords splits a command line into words using shell-like
+// quoting: single quotes preserve their contents literally, while
+// double quotes and backslashes escape spaces but still allow argument
+// references.
+func splitAliasWords(s string) ([]aliasWord, error) {
+	var words []aliasWord
+	var curr aliasWord
+	inWord := false
+	text := new(strings.Builder)
+	flushText := func() {
+		if text.Len() > 0 {
+			curr = append(curr, aliasPart{text: text.String()})
+			text.Reset()
+		}
+	}
+	// argRef parses an argument reference at s[i], which is just past
+	// a '$'. It returns the number of bytes consumed, or 0 if there
+	// isn't a reference.
+	argRef := func(i int) int {
+		if i >= len(s) {
+			return 0
+		}
+		if s[i] == '@' {
+			flushText()
+			curr = append(curr, aliasPart{arg: allArgs})
+			return 1
+		}
+		if '1' <= s[i] && s[i] <= '9' {
+			flushText()
+			n, _ := strconv.Atoi(s[i : i+1])
+			curr = append(curr, aliasPart{arg: n})
+			return 1
+		}
+		return 0
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				flushText()
+				words = append(words, curr)
+				curr = nil
+				inWord = false
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, errors.New("unterminated single quote")
+			}
+			text.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				switch {
+				case s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$", s[i+1]) != -1:
+					i++
+					text.WriteByte(s[i])
+				case s[i] == '$':
+					if n := argRef(i + 1); n > 0 {
+						i += n
+					} else {
+						text.WriteByte('$')
+					}
+				default:
+					text.WriteByte(s[i])
+				}
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(s) {
+				i++
+				text.WriteByte(s[i])
+			}
+		case c == '$':
+			inWord = true
+			if n := argRef(i + 1); n > 0 {
+				i += n
+			} else {
+				text.WriteByte('$')
+			}
+		default:
+			inWord = true
+			text.WriteByte(c)
+		}
+	}
+	if inWord {
+		flushText()
+		words = append(words, curr)
+	}
+	return words, nil
+}
+
+// A userAlias is an alias defined in the git configuration.
+type userAlias struct {
+	name  string
+	value string
+}
+
+// listAliases returns the user aliases defined in the git configuration,
+// sorted by name.
+func listAliases(ctx context.Context, cc *cmdContext) ([]userAlias, error) {
+	cfg, err := cc.readConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list aliases: %v", err)
+	}
+	section := strings.TrimSuffix(aliasConfigPrefix, ".")
+	var aliases []userAlias
+	for _, name := range cfg.Variables(section) {
+		if value := cfg.Value(aliasConfigPrefix + name); value != "" {
+			aliases = append(aliases, userAlias{name: name, value: value})
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].name < aliases[j].name
+	})
+	return aliases, nil
+}
+
+// printAliasHelp writes the list of user aliases for `gg help`.
+// The list is skipped if the configuration can't be read, so that help
+// works even when the configuration is broken.
+func printAliasHelp(ctx context.Context, cc *cmdContext) error {
+	aliases, err := listAliases(ctx, cc)
+	if err != nil {
+		return nil
+	}
+	if len(aliases) == 0 {
+		return nil
+	}
+	fmt.Fprintln(cc.stdout, "\nuser aliases:")
+	for _, a := range aliases {
+		fmt.Fprintf(cc.stdout, "  %-13s %s\n", a.name, a.value)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAlias(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.writeConfig([]byte("[gg \"alias\"]\n" +
+		"\tnodes = log -T '{node|short}\\\\n'\n" +
+		"\tfirst = log -T '{desc}\\\\n' -r $1\n" +
+		"\tshout = !echo \"$1\" | tr a-z A-Z\n" +
+		"\tloop = loop2\n" +
+		"\tloop2 = loop\n" +
+		"\tstatus = log\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := h2.Short() + "\n" + h1.Short() + "\n"; string(out) != want {
+		t.Errorf("gg nodes = %q; want %q", out, want)
+	}
+	// Arguments are appended when the alias doesn't reference them.
+	out, err = env.gg(ctx, env.root, "nodes", "-r", "HEAD~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := h1.Short() + "\n"; string(out) != want {
+		t.Errorf("gg nodes -r HEAD~ = %q; want %q", out, want)
+	}
+	out, err = env.gg(ctx, env.root, "first", "HEAD~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first\n"; string(out) != want {
+		t.Errorf("gg first HEAD~ = %q; want %q", out, want)
+	}
+
+	if _, err := env.gg(ctx, env.root, "loop"); err == nil {
+		t.Error("gg loop did not return an error")
+	} else if !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("gg loop error = %v; want recursive alias error", err)
+	}
+
+	// Built-in commands can't be shadowed.
+	out, err = env.gg(ctx, env.root, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 {
+		t.Errorf("gg status = %q; want empty", out)
+	}
+
+	out, err = env.gg(ctx, env.root, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "\nuser aliases:\n") || !strings.Contains(string(out), "\n  shout ") {
+		t.Errorf("gg help does not list user aliases:\n%s", out)
+	}
+}
+
+func TestAlias_Shell(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.writeConfig([]byte("[gg \"alias\"]\n\tshout = !echo \"$1\" | tr a-z A-Z\n")); err != nil {
+		t.Fatal(err)
+	}
+	out, err := env.gg(ctx, env.root, "shout", "hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO WORLD\n"; string(out) != want {
+		t.Errorf("gg shout 'hello world' = %q; want %q", out, want)
+	}
+}
+
+func TestExpandAlias(t *testing.T) {
+	tests := []struct {
+		value string
+		args  []string
+		want  []string
+	}{
+		{value: "log", want: []string{"log"}},
+		{value: "log -r HEAD", args: []string{"-p"}, want: []string{"log", "-r", "HEAD", "-p"}},
+		{value: "log -r $1", args: []string{"HEAD", "-p"}, want: []string{"log", "-r", "HEAD"}},
+		{value: "log -r $2", args: []string{"HEAD"}, want: []string{"log", "-r", ""}},
+		{value: "commit $@ -m wip", args: []string{"a b", "c"}, want: []string{"commit", "a b", "c", "-m", "wip"}},
+		{value: `commit -m "fix: $@"`, args: []string{"a", "b"}, want: []string{"commit", "-m", "fix: a b"}},
+		{value: `log -T '{desc} $1\n'`, args: []string{"x"}, want: []string{"log", "-T", `{desc} $1\n`, "x"}},
+		{value: `log -T "{desc}\"" a\ b ''`, want: []string{"log", "-T", `{desc}"`, "a b", ""}},
+		{value: "log -r $", want: []string{"log", "-r", "$"}},
+	}
+	for _, test := range tests {
+		got, err := expandAlias(test.value, test.args)
+		if err != nil {
+			t.Errorf("expandAlias(%q, %q): %v", test.value, test.args, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("expandAlias(%q, %q) (-want +got):\n%s", test.value, test.args, diff)
+		}
+	}
+	for _, value := range []string{`log '`, `log "`} {
+		if _, err := expandAlias(value, nil); err == nil {
+			t.Errorf("expandAlias(%q, nil) did not return an error", value)
+		}
+	}
+}
@@ -27,7 +27,7 @@ import (
 const branchSynopsis = "list or manage branches"
 
 func branch(ctx context.Context, cc *cmdContext, args []string) error {
-	f := flag.NewFlagSet(true, "gg branch [-d] [-f] [-r REV] [NAME [...]]", branchSynopsis+`
+	f := flag.NewFlagSet(true, "gg branch [-d] [-f] [-r REV] [-T TEMPLATE] [NAME [...]]", branchSynopsis+`
 
 	Branches are references to commits to help track lines of
 	development. Branches are unversioned and can be moved, renamed, and
@@ -37,18 +37,26 @@ func branch(ctx context.Context, cc *cmdContext, args []string) error {
 	When a commit is made, the active branch will advance to the new
 	commit. A plain `+"`gg update`"+` will also advance an active branch, if
 	possible. If the revision specifies a branch with an upstream, then
-	any new branch will use the named branch's upstream.`)
+	any new branch will use the named branch's upstream.
+
+	When listing branches, `+templateHelp+` The keywords are branch,
+	active, upstream, and the commit keywords `+commitTemplateKeywords+`.`)
 	delete := f.Bool("d", false, "delete the given branches")
 	f.Alias("d", "delete")
 	force := f.Bool("f", false, "force")
 	f.Alias("f", "force")
 	rev := f.String("r", "", "`rev`ision to place branches on")
+	tmpl := f.String("template", "", "display branch list with `style` or template")
+	f.Alias("template", "T")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
 		return nil
 	} else if err != nil {
 		return usagef("%v", err)
 	}
+	if *tmpl != "" && (*delete || f.NArg() > 0) {
+		return usagef("can only pass --template when listing branches")
+	}
 	switch {
 	case *delete:
 		if f.NArg() == 0 {
@@ -75,6 +83,9 @@ func branch(ctx context.Context, cc *cmdContext, args []string) error {
 		if *rev != "" {
 			return usagef("can't pass -r without branch names")
 		}
+		if *tmpl != "" {
+			return listBranchesTemplate(ctx, cc, *tmpl)
+		}
 		return cc.git.RunInteractive(ctx, "--no-pager", "branch")
 	default:
 		// Create or update
@@ -91,13 +102,13 @@ func branch(ctx context.Context, cc *cmdContext, args []string) error {
 		if err != nil {
 			return err
 		}
-		var upstream string
-		if b := r.Ref().Branch(); b != "" {
-			cfg, err := gittool.ReadConfig(ctx, cc.git)
+		source := r.Ref().Branch()
+		var cfg *gittool.Config
+		if source != "" {
+			cfg, err = gittool.ReadConfig(ctx, cc.git)
 			if err != nil {
 				return err
 			}
-			upstream = branchUpstream(cfg, b)
 		}
 		var branchArgs []string
 		branchArgs = append(branchArgs, "branch", "--quiet")
@@ -105,19 +116,12 @@ func branch(ctx context.Context, cc *cmdContext, args []string) error {
 			branchArgs = append(branchArgs, "--force")
 		}
 		branchArgs = append(branchArgs, "--", "XXX", target)
-		var upstreamArgs []string
-		if upstream != "" {
-			// TODO(soon): This should copy the configuration directly
-			// instead of relying on the default tracking branch pattern.
-			upstreamArgs = append(upstreamArgs, "branch", "--quiet", "--set-upstream-to="+upstream, "--", "XXX")
-		}
 		for _, b := range f.Args() {
 			exists := false
-			if len(upstreamArgs) > 0 && *force {
+			if source != "" && *force {
 				// This check for existence is only necessary during -force,
 				// since branch would fail otherwise. We need to check for
 				// existence because we don't want to clobber upstream.
-				// TODO(someday): write test that exercises this.
 				_, err := gittool.ParseRev(ctx, cc.git, gitobj.BranchRef(b).String())
 				exists = err == nil
 			}
@@ -125,9 +129,8 @@ func branch(ctx context.Context, cc *cmdContext, args []string) error {
 			if err := cc.git.Run(ctx, branchArgs...); err != nil {
 				return fmt.Errorf("branch %q: %v", b, err)
 			}
-			if len(upstreamArgs) > 0 && !exists {
-				upstreamArgs[len(upstreamArgs)-1] = b
-				if err := cc.git.Run(ctx, upstreamArgs...); err != nil {
+			if source != "" && !exists {
+				if err := copyBranchConfig(ctx, cc.git, cfg, source, b); err != nil {
 					return fmt.Errorf("branch %q: %v", b, err)
 				}
 			}
@@ -139,10 +142,50 @@ func branch(ctx context.Context, cc *cmdContext, args []string) error {
 	return nil
 }
 
-func branchUpstream(cfg *gittool.Config, name string) string {
-	// TODO(soon): Remove this function; the branch command should copy
-	// the configuration directly.
+// branchStyles is the set of built-in styles for branch.
+var branchStyles = map[string]string{
+	"compact": "{if(active, '* ', '  ')}{branch} {node|short} {desc|firstline}\n",
+}
+
+func listBranchesTemplate(ctx context.Context, cc *cmdContext, tmpl string) error {
+	out, err := newTemplateOutput(ctx, cc, tmpl, branchStyles)
+	if err != nil {
+		return err
+	}
+	branches, err := listBranches(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	cfg, err := gittool.ReadConfig(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	commits := make([]gitobj.Hash, 0, len(branches))
+	for _, b := range branches {
+		commits = append(commits, b.commit)
+	}
+	commitKeywords, err := commitKeywordsFor(ctx, cc.git, commits)
+	if err != nil {
+		return err
+	}
+	active := currentBranch(ctx, cc)
+	for _, b := range branches {
+		kw := copyKeywords(commitKeywords[b.commit])
+		name := b.name.Branch()
+		kw["branch"] = name
+		kw["active"] = name == active
+		kw["upstream"] = branchUpstream(cfg, name)
+		if err := out.write(kw); err != nil {
+			return err
+		}
+	}
+	return out.close()
+}
 
+// branchUpstream returns the upstream of the given branch in the form
+// "remote/branch" or the empty string if the branch does not have an
+// upstream branch.
+func branchUpstream(cfg *gittool.Config, name string) string {
 	remote := cfg.Value("branch." + name + ".remote")
 	if remote == "" {
 		return ""
@@ -156,3 +199,33 @@ func branchUpstream(cfg *gittool.Config, name string) string {
 	}
 	return remote + "/" + merge.Branch()
 }
+
+// copyBranchConfig copies all the settings of one branch to another,
+// replacing any that the destination branch already has. The settings
+// are written to the repository's configuration in a single edit, even
+// if the source branch's settings came from the global configuration,
+// since the new branch only exists in this repository. Values that
+// didn't come from a file, like those set on the command line, are not
+// copied.
+func copyBranchConfig(ctx context.Context, git *gittool.Tool, cfg *gittool.Config, from, to string) error {
+	editor := gittool.NewConfigEditor(git, gittool.LocalScope)
+	toSection := "branch." + to + "."
+	for _, name := range cfg.Variables("branch." + to) {
+		editor.Unset(toSection + name)
+	}
+	fromSection := "branch." + from + "."
+	for _, name := range cfg.Variables("branch." + from) {
+		cleared := false
+		for _, v := range cfg.All(fromSection + name) {
+			if v.Origin.Type != "" && v.Origin.Type != "file" {
+				continue
+			}
+			if !cleared {
+				editor.Unset(toSection + name)
+				cleared = true
+			}
+			editor.Add(toSection+name, v.Value)
+		}
+	}
+	return editor.Commit(ctx)
+}
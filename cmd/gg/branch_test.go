@@ -15,11 +15,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"zombiezen.com/go/gg/internal/gittool"
 )
 
@@ -139,3 +141,176 @@ func TestBranch_Upstream(t *testing.T) {
 		t.Errorf("branch.foo.remote = %q; want \"refs/heads/master\"", mergeBranch)
 	}
 }
+
+func TestBranch_CopiesUpstreamConfig(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repoPath := filepath.Join(env.root, "repo")
+	git := env.git.WithDir(repoPath)
+	if _, err := dummyRev(ctx, git, repoPath, "master", "foo.txt", "initial commit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "branch", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	// The remote-tracking branch doesn't exist, so git branch
+	// --set-upstream-to would refuse to set this.
+	settings := [][2]string{
+		{"branch.master.remote", "upstream"},
+		{"branch.master.merge", "refs/heads/main"},
+		{"branch.master.pushRemote", "fork"},
+		{"branch.master.rebase", "true"},
+		{"branch.bar.remote", "other"},
+	}
+	for _, kv := range settings {
+		if err := gittool.SetConfig(ctx, git, gittool.LocalScope, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	editor := gittool.NewConfigEditor(git, gittool.LocalScope)
+	editor.Add("branch.master.merge", "refs/heads/next")
+	editor.Set("branch.master.description", "Main line")
+	if err := editor.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.writeConfig([]byte("[branch \"master\"]\n\tmergeOptions = --no-ff\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.gg(ctx, repoPath, "branch", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, repoPath, "branch", "-f", "-r", "master", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := gittool.ReadConfig(ctx, git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"branch.foo.remote":       "upstream",
+		"branch.foo.pushRemote":   "fork",
+		"branch.foo.rebase":       "true",
+		"branch.foo.description":  "Main line",
+		"branch.foo.mergeOptions": "--no-ff",
+		"branch.bar.remote":       "other",
+		"branch.bar.merge":        "",
+	}
+	for name, v := range want {
+		if got := cfg.Value(name); got != v {
+			t.Errorf("%s = %q; want %q", name, got, v)
+		}
+	}
+	var merges []string
+	for _, v := range cfg.All("branch.foo.merge") {
+		merges = append(merges, v.Value)
+	}
+	if want := []string{"refs/heads/main", "refs/heads/next"}; !cmp.Equal(merges, want) {
+		t.Errorf("branch.foo.merge = %q; want %q", merges, want)
+	}
+	// The new branch's settings belong to this repository, even though
+	// mergeOptions was copied from the global configuration.
+	if got, err := git.RunOneLiner(ctx, '\n', "config", "--local", "branch.foo.mergeOptions"); err != nil {
+		t.Error("branch.foo.mergeOptions not in repository configuration:", err)
+	} else if string(got) != "--no-ff" {
+		t.Errorf("local branch.foo.mergeOptions = %q; want \"--no-ff\"", got)
+	}
+}
+
+func TestBranch_CopiesGlobalUpstreamConfig(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repoPath := filepath.Join(env.root, "repo")
+	git := env.git.WithDir(repoPath)
+	if _, err := dummyRev(ctx, git, repoPath, "master", "foo.txt", "initial commit"); err != nil {
+		t.Fatal(err)
+	}
+	err = env.writeConfig([]byte("[branch \"master\"]\n" +
+		"\tremote = origin\n" +
+		"\tmerge = refs/heads/main\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.gg(ctx, repoPath, "branch", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range [][2]string{
+		{"branch.feature.remote", "origin"},
+		{"branch.feature.merge", "refs/heads/main"},
+	} {
+		if got, err := git.RunOneLiner(ctx, '\n', "config", "--local", kv[0]); err != nil {
+			t.Errorf("%s not in repository configuration: %v", kv[0], err)
+		} else if string(got) != kv[1] {
+			t.Errorf("local %s = %q; want %q", kv[0], got, kv[1])
+		}
+	}
+	global, err := ioutil.ReadFile(filepath.Join(env.topDir, ".gitconfig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(global, []byte("feature")) {
+		t.Errorf("gg branch wrote new branch to global configuration:\n%s", global)
+	}
+}
+
+func TestBranch_Template(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "branch", "-T", "compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "* feature " + h2.Short() + " second\n" +
+		"  master " + h1.Short() + " first\n"
+	if string(out) != want {
+		t.Errorf("gg branch -T compact = %q; want %q", out, want)
+	}
+
+	out, err = env.gg(ctx, env.root, "branch", "-T", `{branch}:{if(upstream, 'tracking')}\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "feature:tracking\nmaster:\n"
+	if string(out) != want {
+		t.Errorf("gg branch -T '{branch}:{if(upstream, ...)}' = %q; want %q", out, want)
+	}
+
+	if _, err := env.gg(ctx, env.root, "branch", "-T", "compact", "foo"); err == nil {
+		t.Error("gg branch -T compact foo did not return an error")
+	} else if !isUsage(err) {
+		t.Errorf("gg branch -T compact foo error = %v; want usage error", err)
+	}
+}
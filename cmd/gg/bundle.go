@@ -0,0 +1,250 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/terminal"
+)
+
+const bundleSynopsis = "write changes to a file for offline transfer"
+
+func bundle(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg bundle [--all | --base REV [...]] [-r REV [...]] FILE", bundleSynopsis+`
+
+	Write the commits reachable from the given revisions (HEAD by
+	default) that are not ancestors of any base revision to FILE. Each
+	revision must name a branch or tag.
+
+	If no base revisions are given, the upstream of each revision's
+	branch is used as the base, so the bundle will contain the commits
+	that have not yet been pushed. A revision without an upstream
+	includes its entire history. Since git applies the bases to all of
+	the revisions, an upstream that would leave out another revision's
+	changes is not used, and the bundle includes more history instead.
+
+	The bundle can be imported with `+"`gg unbundle`"+` or used as the source
+	of `+"`gg pull`"+` or `+"`gg clone`"+`.`)
+	all := f.Bool("all", false, "include the entire history of the revisions")
+	f.Alias("all", "a")
+	bases := f.MultiString("base", "a `rev`ision assumed to be present at the destination")
+	revs := f.MultiString("r", "a branch or tag `rev`ision to include")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() != 1 {
+		return usagef("must pass exactly one file")
+	}
+	if *all && len(*bases) > 0 {
+		return usagef("can't pass both --all and --base")
+	}
+	if len(*revs) == 0 {
+		*revs = []string{gitobj.Head.String()}
+	}
+	var bundleArgs []string
+	var heads []gitobj.Hash
+	var upstreams []string
+	for _, r := range *revs {
+		rev, err := gittool.ParseRev(ctx, cc.git, r)
+		if err != nil {
+			return err
+		}
+		if !rev.Ref().IsBranch() && !rev.Ref().IsTag() {
+			return fmt.Errorf("cannot bundle %s: not a branch or tag", r)
+		}
+		bundleArgs = append(bundleArgs, rev.Ref().String())
+		heads = append(heads, rev.Commit())
+		up := ""
+		if !*all && len(*bases) == 0 && rev.Ref().IsBranch() {
+			if upRev, err := gittool.ParseRev(ctx, cc.git, rev.Ref().Branch()+"@{upstream}"); err == nil {
+				up = upRev.Commit().String()
+			}
+		}
+		upstreams = append(upstreams, up)
+	}
+	// git bundle excludes the bases from every revision, so an upstream is
+	// only used if it doesn't cut off another revision's changes.
+	for i, up := range upstreams {
+		if up == "" {
+			continue
+		}
+		use := true
+		for j, head := range heads {
+			if j == i {
+				continue
+			}
+			cuts, err := cutsHistory(ctx, cc.git, head, upstreams[j], up)
+			if err != nil {
+				return err
+			}
+			if cuts {
+				use = false
+				break
+			}
+		}
+		if use {
+			bundleArgs = append(bundleArgs, "^"+up)
+		}
+	}
+	for _, b := range *bases {
+		rev, err := gittool.ParseRev(ctx, cc.git, b)
+		if err != nil {
+			return err
+		}
+		bundleArgs = append(bundleArgs, "^"+rev.Commit().String())
+	}
+
+	// git bundle fails with a cryptic message if there's nothing to send.
+	countArgs := append([]string{"rev-list", "--count"}, bundleArgs...)
+	countArgs = append(countArgs, "--")
+	count, err := cc.git.RunOneLiner(ctx, '\n', countArgs...)
+	if err != nil {
+		return err
+	}
+	if string(count) == "0" {
+		return errors.New("no changes found")
+	}
+	createArgs := append([]string{"bundle", "create", cc.abs(f.Arg(0))}, bundleArgs...)
+	// Only git bundle create's output is worth showing, and it only
+	// reports progress when it writes directly to the terminal.
+	return cc.git.RunInteractive(ctx, createArgs...)
+}
+
+// cutsHistory reports whether excluding the ancestors of cut would
+// leave out commits reachable from head that are not ancestors of base.
+// An empty base means that all of head's history is needed.
+func cutsHistory(ctx context.Context, git *gittool.Tool, head gitobj.Hash, base, cut string) (bool, error) {
+	args := []string{"rev-list", "--count", head.String()}
+	if base != "" {
+		args = append(args, "^"+base)
+	}
+	needed, err := git.RunOneLiner(ctx, '\n', append(args, "--")...)
+	if err != nil {
+		return false, err
+	}
+	kept, err := git.RunOneLiner(ctx, '\n', append(args, "^"+cut, "--")...)
+	if err != nil {
+		return false, err
+	}
+	return string(needed) != string(kept), nil
+}
+
+const unbundleSynopsis = "apply changes from a bundle file"
+
+func unbundle(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg unbundle [-u] FILE", unbundleSynopsis+`
+
+	Copy the branches and tags from a file created by `+"`gg bundle`"+` into
+	the repository. Branches that do not exist locally are created and
+	existing branches are fast-forwarded. The checked out branch is only
+	updated if `+"`-u`"+` is given, in which case the working copy is updated
+	as well, as in `+"`gg pull -u`"+`.`)
+	update := f.Bool("u", false, "update to new head if new descendants were unbundled")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() != 1 {
+		return usagef("must pass exactly one file")
+	}
+	path := cc.abs(f.Arg(0))
+	heads, err := listBundleHeads(ctx, cc.git, path)
+	if err != nil {
+		return err
+	}
+	branch := currentBranch(ctx, cc)
+	var currentHead gitobj.Hash
+	fetchArgs := []string{"fetch"}
+	if terminal.IsTerminal(cc.stderr) {
+		// gg inspects git's stderr, so git sees a pipe instead of the
+		// terminal.
+		fetchArgs = append(fetchArgs, "--progress")
+	}
+	fetchArgs = append(fetchArgs, "--", path)
+	refStart := len(fetchArgs)
+	for _, h := range heads {
+		switch {
+		case h.name.IsBranch() && h.name.Branch() == branch:
+			// git refuses to fetch into the checked out branch.
+			currentHead = h.commit
+			fetchArgs = append(fetchArgs, h.name.String()+":")
+		case h.name.IsBranch() || h.name.IsTag():
+			fetchArgs = append(fetchArgs, h.name.String()+":"+h.name.String())
+		}
+	}
+	if len(fetchArgs) == refStart {
+		return fmt.Errorf("%s does not contain any branches or tags", f.Arg(0))
+	}
+	if err := cc.git.Run(ctx, fetchArgs...); err != nil {
+		return err
+	}
+	if currentHead == (gitobj.Hash{}) {
+		return nil
+	}
+	if head, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String()); err == nil && head.Commit() == currentHead {
+		return nil
+	}
+	if !*update {
+		fmt.Fprintf(cc.stderr, "gg: not updating checked out branch %s (use -u to update)\n", branch)
+		return nil
+	}
+	return cc.git.Run(ctx, "merge", "--quiet", "--ff-only", currentHead.String())
+}
+
+// listBundleHeads returns the refs contained in the bundle file at path.
+func listBundleHeads(ctx context.Context, git *gittool.Tool, path string) (refList, error) {
+	p, err := git.Start(ctx, "bundle", "list-heads", path)
+	if err != nil {
+		return nil, fmt.Errorf("read bundle %s: %v", path, err)
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	var refs refList
+	for s.Scan() {
+		line := s.Text()
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil, fmt.Errorf("read bundle %s: parse git bundle list-heads: line must start with commit hash", path)
+		}
+		h, err := gitobj.ParseHash(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("read bundle %s: parse git bundle list-heads: %v", path, err)
+		}
+		refs = append(refs, refListEntry{
+			name:   gitobj.Ref(line[i+1:]),
+			commit: h,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read bundle %s: %v", path, err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("read bundle %s: %v", path, err)
+	}
+	return refs, nil
+}
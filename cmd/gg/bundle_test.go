@@ -0,0 +1,208 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestBundle(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	pullEnv, err := setupPullTest(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitA := env.git.WithDir(pullEnv.repoA)
+	if err := gitA.Run(ctx, "branch", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(env.root, "changes.bundle")
+	if _, err := env.gg(ctx, pullEnv.repoA, "bundle", "--base=first", "-r", "master", "-r", "feature", bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.gg(ctx, pullEnv.repoB, "unbundle", bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	names := pullEnv.commitNames()
+	gitB := env.git.WithDir(pullEnv.repoB)
+	if r, err := gittool.ParseRev(ctx, gitB, "HEAD"); err != nil {
+		t.Error(err)
+	} else if r.Commit() != pullEnv.commit1 {
+		t.Errorf("after unbundle, HEAD = %s; want %s",
+			prettyCommit(r.Commit(), names),
+			prettyCommit(pullEnv.commit1, names))
+	}
+	if r, err := gittool.ParseRev(ctx, gitB, "refs/heads/feature"); err != nil {
+		t.Error(err)
+	} else if r.Commit() != pullEnv.commit2 {
+		t.Errorf("after unbundle, feature = %s; want %s",
+			prettyCommit(r.Commit(), names),
+			prettyCommit(pullEnv.commit2, names))
+	}
+
+	if _, err := env.gg(ctx, pullEnv.repoB, "unbundle", "-u", bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := gittool.ParseRev(ctx, gitB, "HEAD"); err != nil {
+		t.Error(err)
+	} else {
+		if r.Commit() != pullEnv.commit2 {
+			t.Errorf("after unbundle -u, HEAD = %s; want %s",
+				prettyCommit(r.Commit(), names),
+				prettyCommit(pullEnv.commit2, names))
+		}
+		if r.Ref() != "refs/heads/master" {
+			t.Errorf("after unbundle -u, HEAD refname = %q; want refs/heads/master", r.Ref())
+		}
+	}
+}
+
+func TestBundle_DefaultBase(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	pullEnv, err := setupPullTest(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := dummyRev(ctx, env.git, pullEnv.repoB, "master", "bar.txt", "local commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(env.root, "changes.bundle")
+	if _, err := env.gg(ctx, pullEnv.repoB, "bundle", bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	gitB := env.git.WithDir(pullEnv.repoB)
+	p, err := gitB.Start(ctx, "bundle", "verify", bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte(local.String()+" refs/heads/master")) {
+		t.Errorf("bundle does not contain master at local commit %v. verify output:\n%s", local, out)
+	}
+	if !bytes.Contains(out, []byte(pullEnv.commit1.String())) {
+		t.Errorf("bundle does not require upstream commit %v. verify output:\n%s", pullEnv.commit1, out)
+	}
+
+	// Nothing left to send once the upstream has everything.
+	if err := gitB.Run(ctx, "update-ref", "refs/remotes/origin/master", local.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, pullEnv.repoB, "bundle", filepath.Join(env.root, "empty.bundle")); err == nil {
+		t.Error("bundle with no new commits did not return an error")
+	}
+}
+
+func TestBundle_MixedUpstreams(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	pullEnv, err := setupPullTest(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, pullEnv.repoB, "master", "bar.txt", "local commit"); err != nil {
+		t.Fatal(err)
+	}
+	gitB := env.git.WithDir(pullEnv.repoB)
+	if err := gitB.Run(ctx, "branch", "--no-track", "solo", "origin/master"); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(env.root, "changes.bundle")
+	if _, err := env.gg(ctx, pullEnv.repoB, "bundle", "-r", "master", "-r", "solo", bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// solo has no upstream, so master's upstream must not cut off its
+	// history: the bundle can be cloned without any other commits.
+	if err := env.git.Run(ctx, "clone", "--branch=solo", bundlePath, filepath.Join(env.root, "clone")); err != nil {
+		t.Error("bundle is missing solo's history:", err)
+	}
+}
+
+func TestBundle_CloneAndPull(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	pullEnv, err := setupPullTest(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(env.root, "repo.bundle")
+	if _, err := env.gg(ctx, pullEnv.repoA, "bundle", "--all", bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	names := pullEnv.commitNames()
+
+	t.Run("Clone", func(t *testing.T) {
+		if _, err := env.gg(ctx, env.root, "clone", "repo.bundle"); err != nil {
+			t.Fatal(err)
+		}
+		gitC := env.git.WithDir(filepath.Join(env.root, "repo"))
+		if r, err := gittool.ParseRev(ctx, gitC, "HEAD"); err != nil {
+			t.Error(err)
+		} else if r.Commit() != pullEnv.commit2 {
+			t.Errorf("HEAD = %s; want %s",
+				prettyCommit(r.Commit(), names),
+				prettyCommit(pullEnv.commit2, names))
+		}
+	})
+	t.Run("Pull", func(t *testing.T) {
+		if _, err := env.gg(ctx, pullEnv.repoB, "pull", bundlePath); err != nil {
+			t.Fatal(err)
+		}
+		gitB := env.git.WithDir(pullEnv.repoB)
+		if r, err := gittool.ParseRev(ctx, gitB, "FETCH_HEAD"); err != nil {
+			t.Error(err)
+		} else if r.Commit() != pullEnv.commit2 {
+			t.Errorf("FETCH_HEAD = %s; want %s",
+				prettyCommit(r.Commit(), names),
+				prettyCommit(pullEnv.commit2, names))
+		}
+	})
+}
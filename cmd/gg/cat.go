@@ -15,8 +15,14 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 
 	"zombiezen.com/go/gg/internal/flag"
 	"zombiezen.com/go/gg/internal/gittool"
@@ -39,39 +45,113 @@ func cat(ctx context.Context, cc *cmdContext, args []string) error {
 	if f.NArg() == 0 {
 		return usagef("must pass one or more files to cat")
 	}
-	rev, err := gittool.ParseRev(ctx, cc.git, *r)
+	rev, err := parseRevArg(ctx, cc.git, *r)
 	if err != nil {
 		return err
 	}
+	prefix, err := cc.git.RunOneLiner(ctx, '\n', "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+	objs, err := gittool.NewObjectReader(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	defer objs.Close()
 	for _, arg := range f.Args() {
-		if err := catFile(ctx, cc, rev, arg); err != nil {
+		if err := catFile(ctx, cc, objs, rev, string(prefix), arg); err != nil {
 			return err
 		}
 	}
-	return nil
+	return objs.Close()
 }
 
-func catFile(ctx context.Context, cc *cmdContext, rev *gittool.Rev, path string) error {
-	// Find path relative to top of repository. ls-files outputs files in
-	// a different order than its arguments, so we have to do this one at
-	// a time.
-	topPath, err := cc.git.RunOneLiner(ctx, 0, "ls-tree", "-z", "--name-only", "--full-name", rev.Commit().String(), "--", ":(literal)"+path)
+// catFile copies a file at the given revision to stdout. A relative
+// path is interpreted relative to prefix, the working directory's path
+// from the top of the repository.
+func catFile(ctx context.Context, cc *cmdContext, objs *gittool.ObjectReader, rev *gittool.Rev, prefix string, path string) error {
+	relPath := path
+	if filepath.IsAbs(path) {
+		var err error
+		relPath, err = filepath.Rel(cc.dir, path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	topPath := filepath.ToSlash(filepath.Clean(filepath.Join(filepath.FromSlash(prefix), relPath)))
+	if topPath == "." || topPath == ".." || strings.HasPrefix(topPath, "../") {
+		return fmt.Errorf("%s: outside repository", path)
+	}
+	obj, err := objs.Read(ctx, rev.Commit().String()+":"+topPath)
+	if gittool.Cause(err) == gittool.ErrRefNotFound {
+		return fmt.Errorf("%s: no such file in %v", path, rev)
+	}
 	if err != nil {
 		return err
 	}
+	defer obj.Close()
+	if obj.Type != "blob" {
+		return fmt.Errorf("%s: not a file in %v", path, rev)
+	}
+	if _, err := io.Copy(cc.stdout, obj); err != nil {
+		return err
+	}
+	return obj.Close()
+}
 
-	// Send file to stdout.
-	p, err := cc.git.Start(ctx, "cat-file", "blob", rev.Commit().String()+":"+string(topPath))
+// findTreeFile finds the path of a file in the given revision's tree
+// relative to the top of the repository. path is interpreted relative
+// to the tool's working directory.
+func findTreeFile(ctx context.Context, git *gittool.Tool, rev *gittool.Rev, path string) (string, error) {
+	// ls-tree outputs files in a different order than its arguments, so
+	// we have to do this one at a time.
+	topPath, err := git.RunOneLiner(ctx, 0, "ls-tree", "-z", "--name-only", "--full-name", rev.Commit().String(), "--", ":(literal)"+path)
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = io.Copy(cc.stdout, p)
-	waitErr := p.Wait()
+	if len(topPath) == 0 {
+		return "", fmt.Errorf("%s: no such file in %v", path, rev)
+	}
+	return string(topPath), nil
+}
+
+// listTreeFiles lists the files in the given revision's tree that match
+// the given pathspecs. The paths are relative to the top of the
+// repository.
+func listTreeFiles(ctx context.Context, git *gittool.Tool, rev *gittool.Rev, pathspecs []string) ([]string, error) {
+	lsArgs := []string{"ls-tree", "-r", "-z", "--name-only", "--full-name", rev.Commit().String(), "--"}
+	lsArgs = append(lsArgs, pathspecs...)
+	p, err := git.Start(ctx, lsArgs...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	s.Split(splitNUL)
+	var files []string
+	for s.Scan() {
+		files = append(files, s.Text())
 	}
-	if waitErr != nil {
-		return waitErr
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("list files in %v: %v", rev, err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// splitNUL is a bufio.SplitFunc that splits NUL-terminated tokens.
+func splitNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	i := bytes.IndexByte(data, 0)
+	if i == -1 {
+		if atEOF {
+			return 0, nil, errors.New("EOF without NUL byte")
+		}
+		return 0, nil, nil
 	}
-	return nil
+	return i + 1, data[:i], nil
 }
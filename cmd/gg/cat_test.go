@@ -114,12 +114,23 @@ func TestCat(t *testing.T) {
 			args: []string{"-r", "HEAD~", "foo.txt", "bar.txt"},
 			out:  "foo 1\nbar 1\n",
 		},
+		{
+			name: "Revset",
+			args: []string{"-r", "roots(::HEAD)", "foo.txt"},
+			out:  "foo 1\n",
+		},
 		{
 			name: "InSubdir",
 			dir:  "baz",
 			args: []string{"../foo.txt"},
 			out:  "foo 2\n",
 		},
+		{
+			name: "AbsPath",
+			dir:  "baz",
+			args: []string{filepath.Join(env.root, "foo.txt")},
+			out:  "foo 2\n",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
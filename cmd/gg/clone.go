@@ -16,6 +16,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -29,7 +30,10 @@ import (
 const cloneSynopsis = "make a copy of an existing repository"
 
 func clone(ctx context.Context, cc *cmdContext, args []string) error {
-	f := flag.NewFlagSet(true, "gg clone [-b BRANCH] SOURCE [DEST]", cloneSynopsis)
+	f := flag.NewFlagSet(true, "gg clone [-b BRANCH] SOURCE [DEST]", cloneSynopsis+`
+
+	SOURCE may be a URL, a path to a repository, or a bundle file created
+	by `+"`gg bundle`"+`.`)
 	branch := f.String("b", gitobj.Head.String(), "`branch` to check out")
 	f.Alias("b", "branch")
 	gerrit := f.Bool("gerrit", false, "install Gerrit hook")
@@ -112,8 +116,8 @@ func listRefs(ctx context.Context, git *gittool.Tool) (refList, error) {
 	var refs refList
 	for s.Scan() {
 		line := s.Bytes()
-		const spaceLoc = len(refListEntry{}.commit) * 2
-		if spaceLoc >= len(line) || line[spaceLoc] != ' ' {
+		spaceLoc := bytes.IndexByte(line, ' ')
+		if spaceLoc == -1 {
 			return refs, errors.New("parse git show-ref: line must start with commit hash")
 		}
 		h, err := gitobj.ParseHash(string(line[:spaceLoc]))
@@ -136,9 +140,11 @@ func defaultCloneDest(url string) string {
 		url = url[:len(url)-5]
 	} else if strings.HasSuffix(url, ".git") {
 		url = url[:len(url)-4]
+	} else if strings.HasSuffix(url, ".bundle") {
+		url = url[:len(url)-7]
 	}
 	if i := strings.LastIndexByte(url, '/'); i != -1 {
-		return url[i:]
+		return url[i+1:]
 	}
 	return url
 }
@@ -153,3 +153,21 @@ func setupCloneTest(ctx context.Context, env *testEnv) (head gitobj.Hash, _ erro
 	}
 	return r.Commit(), nil
 }
+
+func TestDefaultCloneDest(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"foo", "foo"},
+		{"https://example.com/foo", "foo"},
+		{"https://example.com/foo.git", "foo"},
+		{"https://example.com/foo/.git", "foo"},
+		{"/path/to/foo.bundle", "foo"},
+	}
+	for _, test := range tests {
+		if got := defaultCloneDest(test.url); got != test.want {
+			t.Errorf("defaultCloneDest(%q) = %q; want %q", test.url, got, test.want)
+		}
+	}
+}
@@ -18,8 +18,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
 	"zombiezen.com/go/gg/internal/gittool"
 	"zombiezen.com/go/gg/internal/singleclose"
 )
@@ -37,8 +39,12 @@ aliases: ci
 
 	Unlike Git, gg does not require you to stage your changes into the
 	index. This approximates the behavior of `+"`git commit -a`"+`, but
-	this command will only change the index if the commit succeeds.`)
+	this command will only change the index if the commit succeeds.
+
+	A public revision (see `+"`gg help phase`"+`) will not be amended
+	unless `+"`--force`"+` is given.`)
 	amend := f.Bool("amend", false, "amend the parent of the working directory")
+	force := f.Bool("force", false, "allow amending a public revision")
 	msg := f.String("m", "", "use text as commit `message`")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
@@ -57,7 +63,12 @@ aliases: ci
 	var commitArgs []string
 	commitArgs = append(commitArgs, "commit", "--quiet")
 	if *amend {
+		if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "--max-count=1"); err != nil {
+			return err
+		}
 		commitArgs = append(commitArgs, "--amend")
+	} else if *force {
+		return usagef("can't pass --force without --amend")
 	}
 	if *msg != "" {
 		commitArgs = append(commitArgs, "--message="+*msg)
@@ -86,7 +97,29 @@ aliases: ci
 			return errors.New("nothing changed")
 		}
 	}
-	return cc.git.WithDir(top).RunInteractive(ctx, commitArgs...)
+	if !*amend {
+		return cc.git.WithDir(top).RunInteractive(ctx, commitArgs...)
+	}
+	prev, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String())
+	if err != nil {
+		return err
+	}
+	if err := cc.git.WithDir(top).RunInteractive(ctx, commitArgs...); err != nil {
+		return err
+	}
+	curr, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String())
+	if err != nil {
+		return err
+	}
+	if curr.Commit() == prev.Commit() {
+		return nil
+	}
+	return recordObsMarkers(ctx, cc.git, []obsMarker{{
+		pred: prev.Commit(),
+		succ: curr.Commit(),
+		op:   "amend",
+		time: time.Now(),
+	}})
 }
 
 // argsToFiles finds the files named by the arguments.
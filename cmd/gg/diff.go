@@ -28,56 +28,45 @@ const diffSynopsis = "diff repository (or selected files)"
 
 func diff(ctx context.Context, cc *cmdContext, args []string) error {
 	f := flag.NewFlagSet(true, "gg diff [--stat] [-c REV | -r REV1 [-r REV2]] [FILE [...]]", diffSynopsis)
-	ignoreSpaceChange := f.Bool("b", false, "ignore changes in amount of whitespace")
+	opts := new(diffOptions)
+	f.BoolVar(&opts.ignoreSpaceChange, "b", false, "ignore changes in amount of whitespace")
 	f.Alias("b", "ignore-space-change")
-	ignoreBlankLines := f.Bool("B", false, "ignore changes whose lines are all blank")
+	f.BoolVar(&opts.ignoreBlankLines, "B", false, "ignore changes whose lines are all blank")
 	f.Alias("B", "ignore-blank-lines")
 	change := f.String("c", "", "change made by `rev`ision")
-	ncontext := f.Int("U", 3, "number of lines of context to show")
+	f.IntVar(&opts.ncontext, "U", 3, "number of lines of context to show")
 	var rev revFlag
 	f.Var(&rev, "r", "`rev`ision")
 	stat := f.Bool("stat", false, "output diffstat-style summary of changes")
-	ignoreAllSpace := f.Bool("w", false, "ignore whitespace when comparing lines")
+	f.BoolVar(&opts.ignoreAllSpace, "w", false, "ignore whitespace when comparing lines")
 	f.Alias("w", "ignore-all-space")
-	ignoreSpaceAtEOL := f.Bool("Z", false, "ignore changes in whitespace at EOL")
+	f.BoolVar(&opts.ignoreSpaceAtEOL, "Z", false, "ignore changes in whitespace at EOL")
 	f.Alias("Z", "ignore-space-at-eol")
-	renames := f.String("M", "50%", "report new files with the set `percent`age of similarity to a removed file as renamed")
-	copies := f.String("C", "50%", "report new files with the set `percent`age of similarity as copied")
-	copiesUnmodified := f.Bool("copies-unmodified", true, "whether to check unmodified files when detecting copies (can be expensive)")
+	f.StringVar(&opts.renames, "M", "50%", "report new files with the set `percent`age of similarity to a removed file as renamed")
+	f.StringVar(&opts.copies, "C", "50%", "report new files with the set `percent`age of similarity as copied")
+	f.BoolVar(&opts.copiesUnmodified, "copies-unmodified", true, "whether to check unmodified files when detecting copies (can be expensive)")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
 		return nil
 	} else if err != nil {
 		return usagef("%v", err)
 	}
+	for _, r := range []*string{&rev.r1, &rev.r2, change} {
+		if *r == "" {
+			continue
+		}
+		var err error
+		*r, err = revArgString(ctx, cc.git, *r)
+		if err != nil {
+			return err
+		}
+	}
 	var diffArgs []string
 	diffArgs = append(diffArgs, "diff")
 	if *stat {
 		diffArgs = append(diffArgs, "--stat")
-	} else {
-		diffArgs = append(diffArgs, fmt.Sprintf("-U%d", *ncontext))
-	}
-	if *ignoreSpaceChange {
-		diffArgs = append(diffArgs, "--ignore-space-change")
-	}
-	if *ignoreBlankLines {
-		diffArgs = append(diffArgs, "--ignore-blank-lines")
-	}
-	if *ignoreAllSpace {
-		diffArgs = append(diffArgs, "--ignore-all-space")
-	}
-	if *ignoreSpaceAtEOL {
-		diffArgs = append(diffArgs, "--ignore-space-at-eol")
-	}
-	if *renames != "" {
-		diffArgs = append(diffArgs, "--find-renames="+*renames)
-	}
-	if *copies != "" {
-		diffArgs = append(diffArgs, "--find-copies="+*copies)
-	}
-	if *copiesUnmodified {
-		diffArgs = append(diffArgs, "--find-copies-harder")
 	}
+	diffArgs = opts.appendArgs(diffArgs, !*stat)
 	switch {
 	case rev.r1 != "" && *change == "":
 		diffArgs = append(diffArgs, rev.r1)
@@ -108,6 +97,48 @@ func diff(ctx context.Context, cc *cmdContext, args []string) error {
 	return cc.git.RunInteractive(ctx, diffArgs...)
 }
 
+// diffOptions holds the flags shared by commands that show diffs.
+type diffOptions struct {
+	ncontext          int
+	ignoreSpaceChange bool
+	ignoreBlankLines  bool
+	ignoreAllSpace    bool
+	ignoreSpaceAtEOL  bool
+	renames           string
+	copies            string
+	copiesUnmodified  bool
+}
+
+// appendArgs appends the git diff arguments for opts to args. If patch
+// is false, then options that only affect patch output are omitted.
+func (opts *diffOptions) appendArgs(args []string, patch bool) []string {
+	if patch {
+		args = append(args, fmt.Sprintf("-U%d", opts.ncontext))
+	}
+	if opts.ignoreSpaceChange {
+		args = append(args, "--ignore-space-change")
+	}
+	if opts.ignoreBlankLines {
+		args = append(args, "--ignore-blank-lines")
+	}
+	if opts.ignoreAllSpace {
+		args = append(args, "--ignore-all-space")
+	}
+	if opts.ignoreSpaceAtEOL {
+		args = append(args, "--ignore-space-at-eol")
+	}
+	if opts.renames != "" {
+		args = append(args, "--find-renames="+opts.renames)
+	}
+	if opts.copies != "" {
+		args = append(args, "--find-copies="+opts.copies)
+	}
+	if opts.copiesUnmodified {
+		args = append(args, "--find-copies-harder")
+	}
+	return args
+}
+
 type revFlag struct {
 	r1, r2 string
 }
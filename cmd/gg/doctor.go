@@ -0,0 +1,449 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+const doctorSynopsis = "diagnose problems with the repository and environment"
+
+// minGitVersion is the oldest version of git that gg is tested against.
+var minGitVersion = gitVersion{2, 7, 4}
+
+func doctor(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg doctor [--fix]", doctorSynopsis+`
+
+	doctor checks for common problems with the installed git and the
+	current repository: an unreadable git configuration, an unsupported
+	git version, a missing or non-executable Gerrit hook, broken upstream
+	configuration, an editor that can't be found, a detached HEAD, and
+	interrupted operations.
+	Each problem is printed along with a hint on how to resolve it.
+
+	If `+"`--fix`"+` is given, then problems that can be fixed without losing
+	any data (like making the Gerrit hook executable) are fixed
+	automatically.`)
+	fix := f.Bool("fix", false, "apply safe fixes")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() != 0 {
+		return usagef("no arguments expected")
+	}
+
+	var findings []*doctorFinding
+	checks := []func(context.Context, *cmdContext) ([]*doctorFinding, error){
+		checkGitVersion,
+		checkEditor,
+	}
+	if _, err := gittool.ReadConfig(ctx, cc.git); err != nil {
+		// git refuses to run at all with a malformed configuration file,
+		// so the other checks would only fail.
+		findings = append(findings, &doctorFinding{
+			problem: fmt.Sprintf("git configuration can't be read: %v", err),
+			hint:    "fix or remove the line git reports",
+		})
+		checks = nil
+	} else if inRepo, err := cc.git.Query(ctx, "rev-parse", "--git-dir"); err == nil && inRepo {
+		checks = append(checks,
+			checkGerritHook,
+			checkUpstreams,
+			checkInProgress,
+			checkDetachedHead)
+	} else {
+		fmt.Fprintln(cc.stdout, "not in a git repository; skipping repository checks")
+	}
+	for _, check := range checks {
+		f, err := check(ctx, cc)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, f...)
+	}
+
+	remaining := 0
+	for _, finding := range findings {
+		if *fix && finding.fix != nil {
+			if err := finding.fix(ctx); err != nil {
+				return fmt.Errorf("fix %q: %v", finding.problem, err)
+			}
+			fmt.Fprintf(cc.stdout, "fixed: %s\n", finding.problem)
+			continue
+		}
+		remaining++
+		fmt.Fprintf(cc.stdout, "problem: %s\n", finding.problem)
+		if finding.hint != "" {
+			fmt.Fprintf(cc.stdout, "  hint: %s\n", finding.hint)
+		}
+		if finding.fix != nil {
+			fmt.Fprintln(cc.stdout, "  (can be fixed with gg doctor --fix)")
+		}
+	}
+	switch remaining {
+	case 0:
+		if len(findings) == 0 {
+			fmt.Fprintln(cc.stdout, "no problems found")
+		}
+		return nil
+	case 1:
+		return errors.New("found 1 problem")
+	default:
+		return fmt.Errorf("found %d problems", remaining)
+	}
+}
+
+// A doctorFinding is a problem found by gg doctor.
+type doctorFinding struct {
+	problem string
+	hint    string
+
+	// fix resolves the problem without losing data. It is nil if the
+	// problem can't be fixed automatically.
+	fix func(context.Context) error
+}
+
+func checkGitVersion(ctx context.Context, cc *cmdContext) ([]*doctorFinding, error) {
+	out, err := cc.git.RunOneLiner(ctx, '\n', "--version")
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseGitVersion(string(out))
+	if err != nil {
+		return []*doctorFinding{{
+			problem: fmt.Sprintf("could not determine git version: %v", err),
+			hint:    fmt.Sprintf("gg requires git %v or newer", minGitVersion),
+		}}, nil
+	}
+	if v.less(minGitVersion) {
+		return []*doctorFinding{{
+			problem: fmt.Sprintf("git %v is older than the minimum supported version %v", v, minGitVersion),
+			hint:    "upgrade git or pass a newer git with gg -git=PATH",
+		}}, nil
+	}
+	return nil, nil
+}
+
+func checkEditor(ctx context.Context, cc *cmdContext) ([]*doctorFinding, error) {
+	editor, err := cc.git.RunOneLiner(ctx, '\n', "var", "GIT_EDITOR")
+	if err != nil {
+		return []*doctorFinding{{
+			problem: "no editor configured",
+			hint:    "set core.editor with `git config --global core.editor EDITOR`",
+		}}, nil
+	}
+	fields := strings.Fields(string(editor))
+	if len(fields) == 0 || strings.ContainsAny(fields[0], `"'$\`) {
+		// Too complex to check without a shell.
+		return nil, nil
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return []*doctorFinding{{
+			problem: fmt.Sprintf("editor %q not found", fields[0]),
+			hint:    "set core.editor with `git config --global core.editor EDITOR`",
+		}}, nil
+	}
+	return nil, nil
+}
+
+func checkGerritHook(ctx context.Context, cc *cmdContext) ([]*doctorFinding, error) {
+	path, err := commitMsgHookPath(ctx, cc)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		// Only nag repositories that look like they use Gerrit.
+		if gerrit, err := usesGerrit(ctx, cc); err != nil || !gerrit {
+			return nil, err
+		}
+		return []*doctorFinding{{
+			problem: "repository uses Gerrit, but the commit-msg hook is not installed",
+			hint:    "run `gg gerrithook on`",
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&0111 != 0 {
+		return nil, nil
+	}
+	return []*doctorFinding{{
+		problem: fmt.Sprintf("commit-msg hook %s is not executable", path),
+		hint:    fmt.Sprintf("run `chmod +x %s`", shellEscape(path)),
+		fix: func(ctx context.Context) error {
+			return os.Chmod(path, info.Mode()|0111)
+		},
+	}}, nil
+}
+
+// usesGerrit reports whether the repository looks like it sends changes
+// to Gerrit: it has gerrit.* settings, a remote that pushes to
+// refs/for/ or is hosted on a Gerrit server, or commits with change IDs.
+func usesGerrit(ctx context.Context, cc *cmdContext) (bool, error) {
+	cfg, err := gittool.ReadConfig(ctx, cc.git)
+	if err != nil {
+		return false, err
+	}
+	if len(cfg.Variables("gerrit")) > 0 || len(cfg.Subsections("gerrit")) > 0 {
+		return true, nil
+	}
+	for _, remote := range cfg.Subsections("remote") {
+		for _, u := range cfg.All("remote." + remote + ".url") {
+			if isGerritURL(u.Value) {
+				return true, nil
+			}
+		}
+		for _, p := range cfg.All("remote." + remote + ".push") {
+			if strings.Contains(p.Value, "refs/for/") {
+				return true, nil
+			}
+		}
+	}
+	head, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String())
+	if err != nil {
+		return false, nil
+	}
+	commit, err := readCommitInfo(ctx, cc.git, head.Commit())
+	if err != nil {
+		return false, err
+	}
+	return findChangeID([]byte(commit.message)) != "", nil
+}
+
+// isGerritURL reports whether a remote URL points to a Gerrit server,
+// either by using Gerrit's SSH port or a googlesource.com host.
+func isGerritURL(u string) bool {
+	return strings.Contains(u, ":29418") || strings.Contains(u, ".googlesource.com")
+}
+
+func checkUpstreams(ctx context.Context, cc *cmdContext) ([]*doctorFinding, error) {
+	cfg, err := gittool.ReadConfig(ctx, cc.git)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := listBranches(ctx, cc.git)
+	if err != nil {
+		return nil, err
+	}
+	remotes := make(map[string]struct{})
+	for _, name := range cfg.Subsections("remote") {
+		remotes[name] = struct{}{}
+	}
+	var findings []*doctorFinding
+	for _, r := range refs {
+		b := r.name.Branch()
+		remote := cfg.Value("branch." + b + ".remote")
+		merge := cfg.Value("branch." + b + ".merge")
+		setHint := fmt.Sprintf("set the upstream with `gg upstream -b %s REF`", shellEscape(b))
+		switch {
+		case remote == "" && merge == "":
+			// No upstream.
+			continue
+		case remote == "" || merge == "":
+			findings = append(findings, &doctorFinding{
+				problem: fmt.Sprintf("branch %s has incomplete upstream configuration", b),
+				hint:    setHint,
+			})
+			continue
+		}
+		if _, known := remotes[remote]; !known && remote != "." && !strings.Contains(remote, "/") {
+			findings = append(findings, &doctorFinding{
+				problem: fmt.Sprintf("branch %s tracks unknown remote %q", b, remote),
+				hint:    setHint + " or add the remote with `git remote add`",
+			})
+			continue
+		}
+		if ok, err := cc.git.Query(ctx, "rev-parse", "-q", "--verify", b+"@{upstream}"); err == nil && ok {
+			continue
+		}
+		hint := setHint
+		if remote != "." {
+			hint = fmt.Sprintf("run `gg pull` to fetch it or %s", setHint)
+		}
+		findings = append(findings, &doctorFinding{
+			problem: fmt.Sprintf("upstream of branch %s (%s from %s) does not exist", b, merge, remote),
+			hint:    hint,
+		})
+	}
+	return findings, nil
+}
+
+func checkInProgress(ctx context.Context, cc *cmdContext) ([]*doctorFinding, error) {
+	gitDir, err := gittool.GitDir(ctx, cc.git)
+	if err != nil {
+		return nil, err
+	}
+	ops := []struct {
+		path string
+		name string
+		hint string
+	}{
+		{"rebase-merge", "rebase or histedit", "run `gg rebase --continue` or `gg rebase --abort`"},
+		{"rebase-apply", "rebase", "run `gg rebase --continue` or `gg rebase --abort`"},
+		{"MERGE_HEAD", "merge", "run `gg commit` to finish the merge or `gg merge --abort`"},
+		{"CHERRY_PICK_HEAD", "cherry-pick", "run `git cherry-pick --continue` or `git cherry-pick --abort`"},
+		{"REVERT_HEAD", "revert", "run `git revert --continue` or `git revert --abort`"},
+		{"BISECT_LOG", "bisect", "run `git bisect reset` when done"},
+	}
+	var findings []*doctorFinding
+	for _, op := range ops {
+		if _, err := os.Stat(filepath.Join(gitDir, op.path)); err == nil {
+			findings = append(findings, &doctorFinding{
+				problem: fmt.Sprintf("%s in progress", op.name),
+				hint:    op.hint,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func checkDetachedHead(ctx context.Context, cc *cmdContext) ([]*doctorFinding, error) {
+	if onBranch, err := cc.git.Query(ctx, "symbolic-ref", "-q", gitobj.Head.String()); err != nil || onBranch {
+		return nil, err
+	}
+	gitDir, err := gittool.GitDir(ctx, cc.git)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range []string{"rebase-merge", "rebase-apply", "BISECT_LOG"} {
+		if _, err := os.Stat(filepath.Join(gitDir, p)); err == nil {
+			// Detached HEAD is expected.
+			return nil, nil
+		}
+	}
+	head, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String())
+	if err != nil {
+		return nil, err
+	}
+	finding := &doctorFinding{
+		problem: "HEAD is detached, so new commits won't be on a branch",
+		hint:    "run `gg update BRANCH` to switch to a branch or `gg branch NAME` to create one",
+	}
+	refs, err := listBranches(ctx, cc.git)
+	if err != nil {
+		return nil, err
+	}
+	var tips []gitobj.Ref
+	for _, r := range refs {
+		if r.commit == head.Commit() {
+			tips = append(tips, r.name)
+		}
+	}
+	if len(tips) == 1 {
+		// Reattaching doesn't change the working copy, since the branch
+		// points to the same commit.
+		finding.hint = fmt.Sprintf("run `gg update %s`", shellEscape(tips[0].Branch()))
+		finding.fix = func(ctx context.Context) error {
+			return cc.git.Run(ctx, "symbolic-ref", "-m", "gg doctor", gitobj.Head.String(), tips[0].String())
+		}
+	}
+	return []*doctorFinding{finding}, nil
+}
+
+// listBranches returns the local branches in the repository. Unlike
+// listRefs, it succeeds in a repository without any refs.
+func listBranches(ctx context.Context, git *gittool.Tool) (refList, error) {
+	p, err := git.Start(ctx, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads/")
+	if err != nil {
+		return nil, fmt.Errorf("list branches: %v", err)
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	var refs refList
+	for s.Scan() {
+		line := s.Text()
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil, errors.New("list branches: parse git for-each-ref: line must start with commit hash")
+		}
+		h, err := gitobj.ParseHash(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("list branches: parse git for-each-ref: %v", err)
+		}
+		refs = append(refs, refListEntry{
+			name:   gitobj.Ref(line[i+1:]),
+			commit: h,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("list branches: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("list branches: %v", err)
+	}
+	return refs, nil
+}
+
+// gitVersion is a parsed git release version.
+type gitVersion [3]int
+
+// parseGitVersion parses the output of `git --version`.
+func parseGitVersion(out string) (gitVersion, error) {
+	const prefix = "git version "
+	if !strings.HasPrefix(out, prefix) {
+		return gitVersion{}, fmt.Errorf("parse git version %q: missing %q prefix", out, prefix)
+	}
+	s := out[len(prefix):]
+	if i := strings.IndexByte(s, ' '); i != -1 {
+		// Vendor suffix like "(Apple Git-117)".
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return gitVersion{}, fmt.Errorf("parse git version %q: too few components", out)
+	}
+	var v gitVersion
+	for i := 0; i < len(v) && i < len(parts); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			if i < 2 {
+				return gitVersion{}, fmt.Errorf("parse git version %q: %v", out, err)
+			}
+			// Release candidates like "2.18.0-rc2" or "2.20.GIT".
+			break
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v gitVersion) less(v2 gitVersion) bool {
+	for i := range v {
+		if v[i] != v2[i] {
+			return v[i] < v2[i]
+		}
+	}
+	return false
+}
+
+func (v gitVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestDoctor(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.writeConfig([]byte("[core]\neditor = " + configEscape(cpPath) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "doctor")
+	if err != nil {
+		t.Fatalf("gg doctor on healthy repository: %v; output:\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("no problems found")) {
+		t.Errorf("gg doctor on healthy repository output:\n%s\nwant \"no problems found\"", out)
+	}
+}
+
+func TestDoctor_UnknownRemote(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.writeConfig([]byte("[core]\neditor = " + configEscape(cpPath) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "config", "branch.master.remote", "bogus"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "config", "branch.master.merge", "refs/heads/master"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "doctor")
+	if err == nil {
+		t.Error("gg doctor did not return error")
+	}
+	if !bytes.Contains(out, []byte(`branch master tracks unknown remote "bogus"`)) {
+		t.Errorf("gg doctor output:\n%s\nwant unknown remote problem", out)
+	}
+	if !bytes.Contains(out, []byte("gg upstream -b master REF")) {
+		t.Errorf("gg doctor output:\n%s\nwant hint to run gg upstream", out)
+	}
+}
+
+func TestDoctor_MissingGerritHook(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.writeConfig([]byte("[core]\neditor = " + configEscape(cpPath) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	// No commits have change IDs yet, but the remote is a Gerrit server.
+	if err := env.git.Run(ctx, "remote", "add", "origin", "ssh://review.example.com:29418/project"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "doctor")
+	if err == nil {
+		t.Error("gg doctor did not return error")
+	}
+	if !bytes.Contains(out, []byte("commit-msg hook is not installed")) {
+		t.Errorf("gg doctor output:\n%s\nwant report of missing commit-msg hook", out)
+	}
+}
+
+func TestDoctor_FixDetachedHead(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.writeConfig([]byte("[core]\neditor = " + configEscape(cpPath) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "--detach"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "doctor")
+	if err == nil {
+		t.Error("gg doctor did not return error")
+	}
+	if !bytes.Contains(out, []byte("HEAD is detached")) {
+		t.Errorf("gg doctor output:\n%s\nwant detached HEAD problem", out)
+	}
+	if _, err := env.gg(ctx, env.root, "doctor", "--fix"); err != nil {
+		t.Error("gg doctor --fix:", err)
+	}
+	r, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Ref() != gitobj.BranchRef("master") {
+		t.Errorf("HEAD refers to %s after gg doctor --fix; want %s", r.Ref(), gitobj.BranchRef("master"))
+	}
+}
+
+func TestDoctor_FixHookPermissions(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.writeConfig([]byte("[core]\neditor = " + configEscape(cpPath) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	hookPath := filepath.Join(env.root, ".git", "hooks", "commit-msg")
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(hookPath, []byte("#!/bin/sh\nexit 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "doctor")
+	if err == nil {
+		t.Error("gg doctor did not return error")
+	}
+	if !bytes.Contains(out, []byte("is not executable")) {
+		t.Errorf("gg doctor output:\n%s\nwant hook permission problem", out)
+	}
+	if _, err := env.gg(ctx, env.root, "doctor", "--fix"); err != nil {
+		t.Error("gg doctor --fix:", err)
+	}
+	info, err := os.Stat(hookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&0100 == 0 {
+		t.Errorf("hook mode = %v after gg doctor --fix; want executable", info.Mode())
+	}
+}
+
+func TestParseGitVersion(t *testing.T) {
+	tests := []struct {
+		out     string
+		want    gitVersion
+		wantErr bool
+	}{
+		{out: "git version 2.7.4", want: gitVersion{2, 7, 4}},
+		{out: "git version 2.39.5", want: gitVersion{2, 39, 5}},
+		{out: "git version 2.20", want: gitVersion{2, 20, 0}},
+		{out: "git version 2.17.1.windows.2", want: gitVersion{2, 17, 1}},
+		{out: "git version 2.15.2 (Apple Git-101.1)", want: gitVersion{2, 15, 2}},
+		{out: "git version 2.18.0.rc2", want: gitVersion{2, 18, 0}},
+		{out: "git version 2", wantErr: true},
+		{out: "hub version 2.5.0", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseGitVersion(test.out)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("parseGitVersion(%q) = _, %v; want %v, <nil>", test.out, err, test.want)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("parseGitVersion(%q) = %v, <nil>; want error", test.out, got)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseGitVersion(%q) = %v, <nil>; want %v, <nil>", test.out, got, test.want)
+		}
+	}
+}
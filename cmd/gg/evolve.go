@@ -15,10 +15,8 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 
 	"zombiezen.com/go/gg/internal/flag"
@@ -35,11 +33,19 @@ func evolve(ctx context.Context, cc *cmdContext, args []string) error {
 	evolve finds any ancestors of the destination have the same Gerrit
 	change ID as diverging ancestors of HEAD, it rebases the descendants
 	of the latest shared change onto the corresponding commit in the
-	destination.`)
+	destination.
+
+	evolve also uses the obsolescence markers recorded by commands that
+	rewrite history (see `+"`gg help obslog`"+`) to restack descendants of a
+	rewritten commit onto its latest successor, even if the commits
+	don't have Gerrit change IDs. Such commits are restacked before
+	comparing change IDs. Public revisions (see `+"`gg help phase`"+`) will not be
+	rebased unless `+"`--force`"+` is given.`)
 	dst := f.String("d", "", "`ref` to compare with (defaults to upstream)")
 	f.Alias("d", "dst")
 	list := f.Bool("l", false, "list commits with match change IDs")
 	f.Alias("l", "list")
+	force := f.Bool("force", false, "allow rebasing public revisions")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
 		return nil
@@ -70,6 +76,19 @@ func evolve(ctx context.Context, cc *cmdContext, args []string) error {
 	if err != nil {
 		return err
 	}
+	if orphaned, succ, err := findOrphaned(ctx, cc.git, featureChanges); err != nil {
+		return err
+	} else if orphaned != "" {
+		if *list {
+			fmt.Fprintf(cc.stdout, "< %s\n> %v\n", orphaned, succ)
+			return nil
+		}
+		if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "^"+orphaned); err != nil {
+			return err
+		}
+		return runRewrite(ctx, cc.git, "evolve", succ.String(), []string{gitobj.Head.String(), "^" + orphaned},
+			"rebase", "--onto="+succ.String(), "--no-fork-point", "--", orphaned)
+	}
 	upstreamChanges, err := readChanges(ctx, cc.git, dstRev.Commit().String(), mergeBase)
 	if err != nil {
 		return err
@@ -108,7 +127,36 @@ func evolve(ctx context.Context, cc *cmdContext, args []string) error {
 	if last >= len(featureChanges) {
 		return nil
 	}
-	return cc.git.RunInteractive(ctx, "rebase", "--onto="+submitted[featureChanges[last].id], "--no-fork-point", "--", featureChanges[last].commitHex)
+	if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "^"+featureChanges[last].commitHex); err != nil {
+		return err
+	}
+	onto := submitted[featureChanges[last].id]
+	return runRewrite(ctx, cc.git, "evolve", onto, []string{gitobj.Head.String(), "^" + featureChanges[last].commitHex},
+		"rebase", "--onto="+onto, "--no-fork-point", "--", featureChanges[last].commitHex)
+}
+
+// findOrphaned finds the most recent strict ancestor of HEAD in changes
+// that has been rewritten, returning its hex-encoded hash and its latest
+// successor. It returns an empty string if none of the ancestors have
+// been rewritten.
+func findOrphaned(ctx context.Context, git *gittool.Tool, changes []change) (string, gitobj.Hash, error) {
+	if len(changes) < 2 {
+		return "", gitobj.Hash{}, nil
+	}
+	store, err := readObsStore(ctx, git)
+	if err != nil {
+		return "", gitobj.Hash{}, err
+	}
+	for _, c := range changes[1:] {
+		h, err := gitobj.ParseHash(c.commitHex)
+		if err != nil {
+			return "", gitobj.Hash{}, err
+		}
+		if succ, ok := store.latestSuccessor(h); ok {
+			return c.commitHex, succ, nil
+		}
+	}
+	return "", gitobj.Hash{}, nil
 }
 
 type change struct {
@@ -122,56 +170,26 @@ type change struct {
 func readChanges(ctx context.Context, git *gittool.Tool, head, base string) ([]change, error) {
 	// TODO(soon): this should probably throw an error if there are merge commits.
 
-	// Can't use %(trailers) because it's not supported on 2.7.4.
-	p, err := git.Start(ctx, "log", "--date-order", "--pretty=format:%H%x00%B%x00", head, "^"+base)
+	cr, err := gittool.Log(ctx, git, &gittool.LogOptions{
+		Revs:  []string{head, "^" + base},
+		Order: gittool.DateOrder,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("read changes %s..%s: %v", base, head, err)
 	}
-	defer p.Wait()
-	s := bufio.NewScanner(p)
-	s.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if len(data) == 0 {
-			return 0, nil, nil
-		}
-		i := bytes.IndexByte(data, 0)
-		if i == -1 {
-			if atEOF {
-				return 0, nil, errors.New("EOF without NUL byte")
-			}
-			return 0, nil, nil
-		}
-		return i + 1, data[:i], nil
-	})
 	var changes []change
-	for i := 0; s.Scan(); i++ {
-		hexBytes := s.Bytes()
-		if i > 0 {
-			// log places a newline between entries.
-			hexBytes = bytes.TrimPrefix(hexBytes, []byte{'\n'})
-		}
-		hex := string(hexBytes)
-		if len(hex) != 40 {
-			return nil, fmt.Errorf("read changes %s..%s: parse log: invalid commit hash %q", base, head, hex)
-		}
-		if !s.Scan() {
-			if err := s.Err(); err != nil {
-				return nil, fmt.Errorf("read changes %s..%s: parse log: %v", base, head, err)
-			}
-			if err := p.Wait(); err != nil {
-				return nil, fmt.Errorf("read changes %s..%s: %v", base, head, err)
-			}
-			return nil, fmt.Errorf("read changes %s..%s: parse log: unexpected EOF", base, head)
-		}
-		id := findChangeID(s.Bytes())
+	for cr.Scan() {
+		c := cr.Commit()
 		changes = append(changes, change{
-			id:        id,
-			commitHex: hex,
+			id:        findChangeID([]byte(c.Message)),
+			commitHex: c.Hash.String(),
 		})
 	}
-	if err := s.Err(); err != nil {
-		return nil, fmt.Errorf("read changes %s..%s: parse log: %v", base, head, err)
+	if err := cr.Err(); err != nil {
+		cr.Close()
+		return nil, fmt.Errorf("read changes %s..%s: %v", base, head, err)
 	}
-	if err := p.Wait(); err != nil {
+	if err := cr.Close(); err != nil {
 		return nil, fmt.Errorf("read changes %s..%s: %v", base, head, err)
 	}
 	return changes, nil
@@ -345,6 +345,60 @@ func TestEvolve_AbortIfReordersLocal(t *testing.T) {
 	})
 }
 
+func TestEvolve_ObsMarkers(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "Initial import"); err != nil {
+		t.Fatal(err)
+	}
+	c1, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "Feature one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "feature", "baz.txt", "Feature two"); err != nil {
+		t.Fatal(err)
+	}
+	// Amend the first commit, orphaning the second.
+	if err := env.git.Run(ctx, "checkout", "--quiet", "--detach", c1.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "commit", "--amend", "-m", "Feature one, amended"); err != nil {
+		t.Fatal(err)
+	}
+	amended, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "evolve", "-l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "< " + c1.String() + "\n> " + amended.Commit().String() + "\n"; string(out) != want {
+		t.Errorf("gg evolve -l = %q; want %q", out, want)
+	}
+	if _, err := env.gg(ctx, env.root, "evolve"); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := gittool.ParseRev(ctx, env.git, "feature~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Commit() != amended.Commit() {
+		t.Errorf("feature~1 = %v; want %v (amended commit)", parent.Commit(), amended.Commit())
+	}
+}
+
 func TestFindChangeID(t *testing.T) {
 	tests := []struct {
 		commitMsg string
@@ -0,0 +1,189 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+// externalCommandPrefix is the prefix of executables on the PATH that
+// gg runs for commands it doesn't know about.
+const externalCommandPrefix = "gg-"
+
+// synopsisTimeout is how long gg waits for all of the external commands
+// to print their synopses.
+const synopsisTimeout = 1 * time.Second
+
+// runExternal runs the gg-NAME executable on the PATH, if any. It
+// returns false if there is no such executable.
+//
+// The executable receives the remaining arguments along with the
+// following environment variables:
+//
+//	GG_GIT        path to the git executable gg is using
+//	GG_WORK_TREE  absolute path to the root of the working tree
+//	GG_GIT_DIR    absolute path to the git directory
+//
+// GG_WORK_TREE and GG_GIT_DIR are empty when not run inside a repository.
+func runExternal(ctx context.Context, cc *cmdContext, name string, args []string) (bool, error) {
+	exe := findExternalCommand(cc.env, name)
+	if exe == "" {
+		return false, nil
+	}
+	workTree, _ := gittool.WorkTree(ctx, cc.git)
+	gitDir, _ := gittool.GitDir(ctx, cc.git)
+	c := exec.CommandContext(ctx, exe, args...)
+	c.Dir = cc.dir
+	c.Env = append(cc.env[:len(cc.env):len(cc.env)],
+		"GG_GIT="+cc.git.Path(),
+		"GG_WORK_TREE="+workTree,
+		"GG_GIT_DIR="+gitDir)
+	c.Stdin = cc.stdin
+	c.Stdout = cc.stdout
+	c.Stderr = cc.stderr
+	if err := c.Run(); err != nil {
+		return true, fmt.Errorf("%s: %v", name, err)
+	}
+	return true, nil
+}
+
+// findExternalCommand returns the path of the gg-NAME executable in the
+// PATH of the given environment or the empty string if not found.
+func findExternalCommand(env []string, name string) string {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	for _, dir := range pathDirs(env) {
+		path := filepath.Join(dir, externalCommandPrefix+name)
+		if isExecutable(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// An externalCommand is a gg-NAME executable found on the PATH.
+type externalCommand struct {
+	name string
+	path string
+}
+
+// listExternalCommands returns the gg-NAME executables in the PATH of
+// the given environment, sorted by name. If the same name appears in
+// multiple directories, the one that would be run is returned.
+func listExternalCommands(env []string) []externalCommand {
+	var cmds []externalCommand
+	seen := make(map[string]bool)
+	for _, dir := range pathDirs(env) {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if !strings.HasPrefix(info.Name(), externalCommandPrefix) {
+				continue
+			}
+			name := info.Name()[len(externalCommandPrefix):]
+			path := filepath.Join(dir, info.Name())
+			if name == "" || seen[name] || !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			cmds = append(cmds, externalCommand{name: name, path: path})
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].name < cmds[j].name
+	})
+	return cmds
+}
+
+// externalSynopsis returns the first line printed by
+// `gg-NAME --gg-synopsis`, or the empty string if the command fails.
+func externalSynopsis(ctx context.Context, cc *cmdContext, cmd externalCommand) string {
+	c := exec.CommandContext(ctx, cmd.path, "--gg-synopsis")
+	c.Dir = cc.dir
+	c.Env = cc.env
+	out, err := c.Output()
+	if err != nil {
+		return ""
+	}
+	if i := bytes.IndexByte(out, '\n'); i != -1 {
+		out = out[:i]
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// printExternalHelp writes the list of external commands for `gg help`.
+func printExternalHelp(ctx context.Context, cc *cmdContext) {
+	cmds := listExternalCommands(cc.env)
+	if len(cmds) == 0 {
+		return
+	}
+	// Run the commands concurrently so that slow ones don't add up.
+	ctx, cancel := context.WithTimeout(ctx, synopsisTimeout)
+	defer cancel()
+	synopses := make([]string, len(cmds))
+	var wg sync.WaitGroup
+	for i := range cmds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			synopses[i] = externalSynopsis(ctx, cc, cmds[i])
+		}(i)
+	}
+	wg.Wait()
+	fmt.Fprintln(cc.stdout, "\nexternal commands:")
+	for i, cmd := range cmds {
+		fmt.Fprintf(cc.stdout, "  %-13s %s\n", cmd.name, synopses[i])
+	}
+}
+
+// pathDirs returns the directories listed in the PATH of the given
+// environment.
+func pathDirs(env []string) []string {
+	var path string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			// Later entries take precedence, as in os/exec.
+			path = kv[len("PATH="):]
+		}
+	}
+	var dirs []string
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
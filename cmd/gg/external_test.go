@@ -0,0 +1,115 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExternal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(env.binDir(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	const script = "#!/bin/sh\n" +
+		"if [ \"$1\" = --gg-synopsis ]; then\n" +
+		"  echo 'print the environment'\n" +
+		"  exit 0\n" +
+		"fi\n" +
+		"echo \"git=$GG_GIT\"\n" +
+		"echo \"worktree=$GG_WORK_TREE\"\n" +
+		"echo \"gitdir=$GG_GIT_DIR\"\n" +
+		"echo \"args=$*\"\n"
+	if err := ioutil.WriteFile(filepath.Join(env.binDir(), "gg-printenv"), []byte(script), 0777); err != nil {
+		t.Fatal(err)
+	}
+	// Not executable, so not a command.
+	if err := ioutil.WriteFile(filepath.Join(env.binDir(), "gg-data"), []byte("foo\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "printenv", "foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(env.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "git=" + gitPath + "\n" +
+		"worktree=" + root + "\n" +
+		"gitdir=" + filepath.Join(root, ".git") + "\n" +
+		"args=foo bar\n"
+	if string(out) != want {
+		t.Errorf("gg printenv foo bar output:\n%s\nwant:\n%s", out, want)
+	}
+
+	if _, err := env.gg(ctx, env.root, "data"); err == nil {
+		t.Error("gg data did not return an error")
+	} else if !isUsage(err) {
+		t.Errorf("gg data error = %v; want usage error", err)
+	}
+
+	out, err = env.gg(ctx, env.root, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "\nexternal commands:\n  printenv      print the environment\n") {
+		t.Errorf("gg help does not list external command:\n%s", out)
+	}
+	if strings.Contains(string(out), "  data ") {
+		t.Errorf("gg help lists non-executable file:\n%s", out)
+	}
+
+	// A command that hangs shouldn't hold up the others' synopses.
+	const hang = "#!/bin/sh\nexec sleep 30\n"
+	for _, name := range []string{"gg-hang1", "gg-hang2", "gg-hang3"} {
+		if err := ioutil.WriteFile(filepath.Join(env.binDir(), name), []byte(hang), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	out, err = env.gg(ctx, env.root, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("gg help with hanging external commands took %v", d)
+	}
+	if !strings.Contains(string(out), "\n  hang1         \n") {
+		t.Errorf("gg help does not list hanging external command without a synopsis:\n%s", out)
+	}
+	if !strings.Contains(string(out), "\n  printenv      print the environment\n") {
+		t.Errorf("gg help does not list external command:\n%s", out)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+const filesSynopsis = "list tracked files"
+
+func files(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg files [-0] [-r REV] [PATTERN [...]]", filesSynopsis+`
+
+	Print the files under version control at the given revision (HEAD by
+	default). If patterns are given, only files that match a pattern
+	are printed. Patterns are file or directory paths relative to the
+	current directory. If no patterns are given, all files in the
+	repository are printed.
+
+	Paths are printed relative to the current directory.`)
+	print0 := f.Bool("0", false, "end filenames with NUL, for use with xargs")
+	f.Alias("0", "print0")
+	rev := f.String("r", gitobj.Head.String(), "search the `rev`ision")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	r, err := parseRevArg(ctx, cc.git, *rev)
+	if err != nil {
+		return err
+	}
+	prefix, err := cc.git.RunOneLiner(ctx, '\n', "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+	var pathspecs []string
+	if f.NArg() == 0 {
+		pathspecs = []string{":(top)"}
+	} else {
+		for _, arg := range f.Args() {
+			pathspecs = append(pathspecs, ":(literal)"+arg)
+		}
+	}
+	names, err := listTreeFiles(ctx, cc.git, r, pathspecs)
+	if err != nil {
+		return err
+	}
+	term := byte('\n')
+	if *print0 {
+		term = 0
+	}
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		rel, err := filepath.Rel(filepath.FromSlash(string(prefix)), filepath.FromSlash(name))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(rel)
+		buf.WriteByte(term)
+	}
+	_, err = cc.stdout.Write(buf.Bytes())
+	return err
+}
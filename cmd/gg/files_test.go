@@ -0,0 +1,112 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(env.root, "baz"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo.txt", filepath.Join("baz", "bar.txt")} {
+		err := ioutil.WriteFile(filepath.Join(env.root, name), []byte("content\n"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.git.Run(ctx, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "commit", "-m", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "rm", "--quiet", "foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "commit", "-m", "second"); err != nil {
+		t.Fatal(err)
+	}
+	// Untracked files should not be listed.
+	err = ioutil.WriteFile(filepath.Join(env.root, "untracked.txt"), []byte("content\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		args []string
+		out  string
+	}{
+		{
+			name: "Head",
+			out:  "baz/bar.txt\n",
+		},
+		{
+			name: "Rev",
+			args: []string{"-r", "HEAD~"},
+			out:  "baz/bar.txt\nfoo.txt\n",
+		},
+		{
+			name: "Print0",
+			args: []string{"-0", "-r", "HEAD~"},
+			out:  "baz/bar.txt\x00foo.txt\x00",
+		},
+		{
+			name: "Pattern",
+			args: []string{"-r", "HEAD~", "foo.txt"},
+			out:  "foo.txt\n",
+		},
+		{
+			name: "InSubdir",
+			dir:  "baz",
+			args: []string{"-r", "HEAD~"},
+			out:  "bar.txt\n../foo.txt\n",
+		},
+		{
+			name: "PatternInSubdir",
+			dir:  "baz",
+			args: []string{"-r", "HEAD~", "."},
+			out:  "bar.txt\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"files"}, test.args...)
+			out, err := env.gg(ctx, filepath.Join(env.root, test.dir), args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filepath.ToSlash(string(out)); got != test.out {
+				t.Errorf("output = %q; want %q", got, test.out)
+			}
+		})
+	}
+}
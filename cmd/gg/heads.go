@@ -0,0 +1,86 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/revset"
+)
+
+const headsSynopsis = "show branch heads"
+
+func heads(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg heads [-T TEMPLATE]", headsSynopsis+`
+
+	Show the revisions pointed to by local branches that are not
+	ancestors of any other local branch.
+
+	`+templateHelp+` The keywords are `+commitTemplateKeywords+`.
+	The built-in `+"`compact`"+` style shows one line per revision.`)
+	tmpl := f.String("template", "", "display with `style` or template")
+	f.Alias("template", "T")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	var out *templateOutput
+	if *tmpl != "" {
+		var err error
+		out, err = newTemplateOutput(ctx, cc, *tmpl, logStyles)
+		if err != nil {
+			return err
+		}
+	}
+	branches, err := listBranches(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	if len(branches) == 0 {
+		if out != nil {
+			return out.close()
+		}
+		return nil
+	}
+	expr, err := revset.Parse("heads(ancestors(branch()))")
+	if err != nil {
+		return err
+	}
+	hashes, err := expr.Eval(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	opts := &gittool.LogOptions{NoWalk: true}
+	for _, h := range hashes {
+		opts.Revs = append(opts.Revs, h.String())
+	}
+	if out != nil {
+		if err := readCommitKeywords(ctx, cc.git, opts, out.write); err != nil {
+			return err
+		}
+		return out.close()
+	}
+	logArgs := []string{"log", "--decorate=auto", "--no-walk"}
+	logArgs = append(logArgs, opts.Revs...)
+	logArgs = append(logArgs, "--")
+	return cc.git.RunInteractive(ctx, logArgs...)
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHeads(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty repository
+	out, err := env.gg(ctx, env.root, "heads", "-T", `{node}\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 0 {
+		t.Errorf("gg heads in empty repository = %q; want \"\"", out)
+	}
+
+	// master -- feature
+	//      \
+	//       other
+	// (stale points to master's parent)
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "branch", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "master"); err != nil {
+		t.Fatal(err)
+	}
+	feature, err := dummyRev(ctx, env.git, env.root, "feature", "baz.txt", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := dummyRev(ctx, env.git, env.root, "other", "quux.txt", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = env.gg(ctx, env.root, "heads", "-T", `{node}\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Fields(string(out))
+	sort.Strings(got)
+	want := []string{feature.String(), other.String()}
+	sort.Strings(want)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("gg heads = %q; want %q", got, want)
+	}
+
+	out, err = env.gg(ctx, env.root, "heads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), feature.String()) || !strings.Contains(string(out), other.String()) {
+		t.Errorf("gg heads output does not contain %v and %v. Output:\n%s", feature, other, out)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+// hookConfigPrefix is the prefix of the git configuration settings
+// that define command hooks. The rest of the setting name is
+// "pre-COMMAND" or "post-COMMAND".
+const hookConfigPrefix = "gg.hook."
+
+// commandAliases maps the built-in aliases of commands to the command
+// names used for hooks.
+var commandAliases = map[string]string{
+	"check":    "status",
+	"checkout": "update",
+	"ci":       "commit",
+	"co":       "update",
+	"history":  "log",
+	"rm":       "remove",
+	"sl":       "smartlog",
+	"st":       "status",
+	"up":       "update",
+}
+
+// destinationCommands is the set of commands that run their pre-hook
+// themselves once they have determined where they are sending changes.
+var destinationCommands = map[string]bool{
+	"mail": true,
+	"push": true,
+}
+
+// hooklessCommands is the set of commands that never run hooks, so that
+// they work even if the git configuration can't be read.
+var hooklessCommands = map[string]bool{
+	"doctor": true,
+	"help":   true,
+}
+
+// revFlagCommands is the set of commands whose -r flag names the
+// revisions they operate on. A single -r argument to one of these
+// commands is passed to hooks as GG_HOOK_REV.
+var revFlagCommands = map[string]bool{
+	"branch":  true,
+	"bundle":  true,
+	"cat":     true,
+	"diff":    true,
+	"files":   true,
+	"log":     true,
+	"merge":   true,
+	"obslog":  true,
+	"parents": true,
+	"phase":   true,
+	"recover": true,
+	"revert":  true,
+	"update":  true,
+}
+
+// commandHooks runs the shell commands configured to run before and
+// after a gg command. A nil *commandHooks runs no hooks.
+//
+// Hooks receive the following environment variables:
+//
+//	GG_HOOK_COMMAND  name of the command
+//	GG_HOOK_ARGS     the command's arguments, quoted for the shell
+//	GG_HOOK_REV      the commit being operated on: the commit being
+//	                 sent for push and mail, the commit named by -r,
+//	                 or HEAD otherwise
+//	GG_HOOK_REMOTE   destination repository (push and mail only)
+//	GG_HOOK_REF      destination ref (push and mail only)
+//	GG_HOOK_STATUS   the command's exit status (post-hooks only)
+type commandHooks struct {
+	name      string
+	args      []string
+	pre, post string
+	vars      map[string]string
+	preDone   bool
+}
+
+// loadHooks reads the hooks for the given command from the git
+// configuration. It returns nil if the command has no hooks.
+func loadHooks(ctx context.Context, cc *cmdContext, name string, args []string) (*commandHooks, error) {
+	if canon := commandAliases[name]; canon != "" {
+		name = canon
+	}
+	cfg, err := cc.readConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h := &commandHooks{
+		name: name,
+		args: args,
+		pre:  cfg.Value(hookConfigPrefix + "pre-" + name),
+		post: cfg.Value(hookConfigPrefix + "post-" + name),
+		vars: make(map[string]string),
+	}
+	if h.pre == "" && h.post == "" {
+		return nil, nil
+	}
+	if revFlagCommands[name] {
+		if rev, ok := singleRevFlag(args); ok {
+			// If the revision doesn't name exactly one commit, then
+			// GG_HOOK_REV is empty rather than misleadingly HEAD.
+			h.vars["GG_HOOK_REV"] = ""
+			if r, err := parseRevArg(ctx, cc.git, rev); err == nil {
+				h.vars["GG_HOOK_REV"] = r.Commit().String()
+			}
+		}
+	}
+	return h, nil
+}
+
+// singleRevFlag returns the value of the -r flag in a command's
+// arguments if it is given exactly once.
+func singleRevFlag(args []string) (rev string, ok bool) {
+	n := 0
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		switch {
+		case a == "-r" || a == "--r":
+			if i+1 >= len(args) {
+				return "", false
+			}
+			i++
+			rev = args[i]
+		case strings.HasPrefix(a, "-r=") || strings.HasPrefix(a, "--r="):
+			rev = a[strings.IndexByte(a, '=')+1:]
+		default:
+			continue
+		}
+		n++
+	}
+	return rev, n == 1
+}
+
+// setVar sets an environment variable to pass to the hooks.
+func (h *commandHooks) setVar(key, value string) {
+	if h == nil {
+		return
+	}
+	h.vars[key] = value
+}
+
+// runPre runs the pre-hook if it has not already been run. It returns
+// an error if the hook fails.
+func (h *commandHooks) runPre(ctx context.Context, cc *cmdContext) error {
+	if h == nil || h.preDone {
+		return nil
+	}
+	h.preDone = true
+	if h.pre == "" {
+		return nil
+	}
+	if err := h.run(ctx, cc, h.pre, nil); err != nil {
+		return fmt.Errorf("pre-%s hook failed: %v", h.name, err)
+	}
+	return nil
+}
+
+// runPost runs the post-hook with the exit status the command will
+// have, given its error. It does nothing if the pre-hook was never
+// run.
+func (h *commandHooks) runPost(ctx context.Context, cc *cmdContext, cmdErr error) error {
+	if h == nil || !h.preDone || h.post == "" {
+		return nil
+	}
+	status := "0"
+	switch {
+	case isUsage(cmdErr):
+		status = "64"
+	case cmdErr != nil:
+		status = "1"
+	}
+	if err := h.run(ctx, cc, h.post, []string{"GG_HOOK_STATUS=" + status}); err != nil {
+		return fmt.Errorf("post-%s hook failed: %v", h.name, err)
+	}
+	return nil
+}
+
+func (h *commandHooks) run(ctx context.Context, cc *cmdContext, script string, extraEnv []string) error {
+	quoted := make([]string, len(h.args))
+	for i, a := range h.args {
+		quoted[i] = shellEscape(a)
+	}
+	env := append(cc.env[:len(cc.env):len(cc.env)],
+		"GG_HOOK_COMMAND="+h.name,
+		"GG_HOOK_ARGS="+strings.Join(quoted, " "))
+	if _, ok := h.vars["GG_HOOK_REV"]; !ok {
+		if r, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String()); err == nil {
+			env = append(env, "GG_HOOK_REV="+r.Commit().String())
+		}
+	}
+	for k, v := range h.vars {
+		env = append(env, k+"="+v)
+	}
+	env = append(env, extraEnv...)
+	c := exec.CommandContext(ctx, "sh", "-c", script)
+	c.Dir = cc.dir
+	c.Env = env
+	c.Stdin = cc.stdin
+	c.Stdout = cc.stdout
+	c.Stderr = cc.stderr
+	return c.Run()
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.writeConfig([]byte("[gg \"hook\"]\n" +
+		"\tpre-commit = echo \"pre $GG_HOOK_COMMAND $GG_HOOK_REV $GG_HOOK_ARGS\" && test ! -e block\n" +
+		"\tpost-commit = echo \"post $GG_HOOK_COMMAND $GG_HOOK_REV $GG_HOOK_STATUS\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(env.root, "foo.txt"), []byte("changed\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hooks run for the ci alias too.
+	out, err := env.gg(ctx, env.root, "ci", "-m", "second message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2.Commit() == h1 {
+		t.Fatal("gg ci did not create a commit")
+	}
+	if want := "pre commit " + h1.String() + " -m 'second message'\n"; !strings.HasPrefix(string(out), want) {
+		t.Errorf("gg ci output:\n%s\nwant to start with %q", out, want)
+	}
+	if want := "post commit " + h2.Commit().String() + " 0\n"; !strings.HasSuffix(string(out), want) {
+		t.Errorf("gg ci output:\n%s\nwant to end with %q", out, want)
+	}
+
+	// A failing pre-hook aborts the command.
+	if err := ioutil.WriteFile(filepath.Join(env.root, "block"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(env.root, "foo.txt"), []byte("changed again\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	out, err = env.gg(ctx, env.root, "commit", "-m", "third", "foo.txt")
+	if err == nil {
+		t.Error("gg commit with failing pre-hook did not return an error")
+	} else if !strings.Contains(err.Error(), "pre-commit hook failed") {
+		t.Errorf("gg commit with failing pre-hook error = %v; want pre-commit hook failure", err)
+	}
+	if strings.Contains(string(out), "post ") {
+		t.Errorf("post-hook ran after failing pre-hook:\n%s", out)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "HEAD"); err != nil {
+		t.Fatal(err)
+	} else if r.Commit() != h2.Commit() {
+		t.Error("gg commit with failing pre-hook created a commit")
+	}
+
+	// --no-hooks skips the hooks.
+	out, err = env.gg(ctx, env.root, "--no-hooks", "commit", "-m", "third", "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "pre ") || strings.Contains(string(out), "post ") {
+		t.Errorf("gg --no-hooks commit ran hooks:\n%s", out)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "HEAD"); err != nil {
+		t.Fatal(err)
+	} else if r.Commit() == h2.Commit() {
+		t.Error("gg --no-hooks commit did not create a commit")
+	}
+}
+
+func TestHooks_Push(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	pushEnv, err := stagePushTest(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.writeConfig([]byte("[gg \"hook\"]\n" +
+		"\tpre-push = echo \"pre $GG_HOOK_REMOTE $GG_HOOK_REF $GG_HOOK_REV\"\n" +
+		"\tpost-push = echo \"post $GG_HOOK_STATUS\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, pushEnv.repoA, "push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "pre origin refs/heads/master " + pushEnv.commit2.String() + "\n"; !strings.Contains(string(out), want) {
+		t.Errorf("gg push output:\n%s\nwant to contain %q", out, want)
+	}
+	if want := "post 0\n"; !strings.HasSuffix(string(out), want) {
+		t.Errorf("gg push output:\n%s\nwant to end with %q", out, want)
+	}
+}
+
+func TestHooks_Rev(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second"); err != nil {
+		t.Fatal(err)
+	}
+	err = env.writeConfig([]byte("[gg \"hook\"]\n" +
+		"\tpre-cat = echo \"pre $GG_HOOK_REV\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "cat", "-r", "HEAD~1", "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "pre " + h1.String() + "\n"; !strings.HasPrefix(string(out), want) {
+		t.Errorf("gg cat -r HEAD~1 output:\n%s\nwant to start with %q", out, want)
+	}
+}
+
+func TestHooks_UserAlias(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	err = env.writeConfig([]byte("[gg \"hook\"]\n" +
+		"\tpre-log = echo \"pre $GG_HOOK_COMMAND\" && false\n" +
+		"[gg \"alias\"]\n" +
+		"\tl = log\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hooks of the command that the alias expands to run too.
+	out, err := env.gg(ctx, env.root, "l")
+	if err == nil {
+		t.Error("gg l with failing pre-log hook did not return an error")
+	} else if !strings.Contains(err.Error(), "pre-log hook failed") {
+		t.Errorf("gg l with failing pre-log hook error = %v; want pre-log hook failure", err)
+	}
+	if want := "pre log\n"; !strings.HasPrefix(string(out), want) {
+		t.Errorf("gg l output:\n%s\nwant to start with %q", out, want)
+	}
+}
+
+func TestHooks_BrokenConfig(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.writeConfig([]byte("[gg \"hook\"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "help"); err != nil {
+		t.Errorf("gg help with broken configuration: %v", err)
+	}
+	if out, _ := env.gg(ctx, env.root, "doctor"); !strings.Contains(string(out), "git configuration can't be read") {
+		t.Errorf("gg doctor with broken configuration output:\n%s\nwant to report the configuration", out)
+	}
+	if _, err := env.gg(ctx, env.root, "status"); err == nil {
+		t.Error("gg status with broken configuration did not return an error")
+	}
+}
@@ -16,9 +16,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/revset"
 )
 
 const logSynopsis = "show revision history of entire repository or files"
@@ -26,7 +30,42 @@ const logSynopsis = "show revision history of entire repository or files"
 func log(ctx context.Context, cc *cmdContext, args []string) error {
 	f := flag.NewFlagSet(true, "gg log [OPTION [...]] [FILE]", logSynopsis+`
 
-aliases: history`)
+aliases: history
+
+	Revisions passed with `+"`-r`"+` may be git revisions or ranges, which
+	show the history leading up to the revision, or revsets, which show
+	only the selected revisions. A revset combines git revisions with
+	the operators `+"`and`"+`, `+"`or`"+`, `+"`not`"+`, and `+"`X::Y`"+` (descendants of X
+	that are ancestors of Y; either side may be omitted) and the
+	functions:
+
+	    all()                 every revision
+	    ancestors(SET)        SET and its ancestors
+	    descendants(SET)      SET and revisions in branches that contain it
+	    heads(SET)            members of SET without children in SET
+	    roots(SET)            members of SET without parents in SET
+	    only(SET[, OTHER])    ancestors of SET that aren't ancestors of
+	                          OTHER (all other branches by default)
+	    branch([NAME])        the revision a branch points to
+	    draft()               local revisions that aren't public
+	    public()              revisions reachable from remote branches or
+	                          gg.publicRefs (see `+"`gg help phase`"+`)
+	    author(PATTERN)       revisions by a matching author; `+"`me`"+` matches
+	                          the configured user.email
+	    keyword(STRING)       revisions with STRING in the message or author
+	    date(SPEC)            revisions committed in a date range like
+	                          "<DATE", ">DATE", "DATE to DATE", or "-DAYS"
+	    file(PATH)            revisions that changed PATH
+	    changeid(ID)          revisions with a matching Gerrit change ID
+
+	The revision flags of other commands, like `+"`gg diff -r`"+`, also accept
+	revsets as long as they select exactly one revision.
+
+	`+templateHelp+` The keywords are `+commitTemplateKeywords+`.
+	The built-in `+"`compact`"+` style shows one line per revision,
+	including its phase, and is the default. With `+"`--graph`"+` or
+	`+"`--stat`"+`, log uses git's own log format, which can't show
+	phases.`)
 	follow := f.Bool("follow", false, "follow file history across copies and renames")
 	followFirst := f.Bool("follow-first", false, "only follow the first parent of merge commits")
 	graph := f.Bool("graph", false, "show the revision DAG")
@@ -34,6 +73,8 @@ aliases: history`)
 	rev := f.MultiString("r", "show the specified `rev`ision or range")
 	reverse := f.Bool("reverse", false, "reverse order of commits")
 	stat := f.Bool("stat", false, "include diffstat-style summary of each commit")
+	tmpl := f.String("template", "", "display with `style` or template (default is compact)")
+	f.Alias("template", "T")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
 		return nil
@@ -43,6 +84,12 @@ aliases: history`)
 	if f.NArg() > 1 {
 		return usagef("only one file allowed")
 	}
+	if *tmpl != "" && *graph {
+		return usagef("can't pass --graph with --template")
+	}
+	if *tmpl != "" && *stat {
+		return usagef("can't pass --stat with --template")
+	}
 	var logArgs []string
 	logArgs = append(logArgs, "log", "--decorate=auto")
 	if *follow {
@@ -65,8 +112,82 @@ aliases: history`)
 			return usagef("revisions must not start with '-'")
 		}
 	}
-	logArgs = append(logArgs, *rev...)
+	revs, noWalk, err := logRevArgs(ctx, cc.git, *rev)
+	if err != nil {
+		return err
+	}
+	if *tmpl == "" && !*graph && !*stat {
+		*tmpl = "compact"
+	}
+	if *tmpl != "" {
+		out, err := newTemplateOutput(ctx, cc, *tmpl, logStyles)
+		if err != nil {
+			return err
+		}
+		opts := &gittool.LogOptions{
+			Revs:        revs,
+			Paths:       f.Args(),
+			FirstParent: *followFirst,
+			NoWalk:      noWalk,
+			Follow:      *follow,
+			Reverse:     *reverse,
+		}
+		if err := readCommitKeywords(ctx, cc.git, opts, out.write); err != nil {
+			return err
+		}
+		return out.close()
+	}
+	if noWalk {
+		logArgs = append(logArgs, "--no-walk")
+	}
+	logArgs = append(logArgs, revs...)
 	logArgs = append(logArgs, "--")
 	logArgs = append(logArgs, f.Args()...)
 	return cc.git.RunInteractive(ctx, logArgs...)
 }
+
+// logStyles is the set of built-in styles for log.
+var logStyles = map[string]string{
+	"compact": "{node|short}  {pad(phase, 6)}  {date|shortdate}  {author|person}  {desc|firstline}{if(branches, ' [{join(branches, \", \")}]')}\n",
+}
+
+// logRevArgs converts the -r arguments of log into git log revisions.
+// Plain git revisions are passed through so that git log shows their
+// history. If any argument is a revset, then logRevArgs returns the
+// selected commits and reports that git log should not walk their
+// history.
+func logRevArgs(ctx context.Context, git *gittool.Tool, revs []string) (_ []string, noWalk bool, _ error) {
+	exprs := make([]*revset.Expr, len(revs))
+	hasRevset := false
+	for i, r := range revs {
+		var err error
+		exprs[i], err = parseRevset(ctx, git, r)
+		if err != nil {
+			return nil, false, err
+		}
+		if exprs[i] != nil {
+			hasRevset = true
+		}
+	}
+	if !hasRevset {
+		return revs, false, nil
+	}
+	var args []string
+	seen := make(map[gitobj.Hash]bool)
+	for i, r := range revs {
+		hashes, err := evalParsedRevArg(ctx, git, r, exprs[i])
+		if err != nil {
+			return nil, false, err
+		}
+		for _, h := range hashes {
+			if !seen[h] {
+				seen[h] = true
+				args = append(args, h.String())
+			}
+		}
+	}
+	if len(args) == 0 {
+		return nil, false, fmt.Errorf("no revisions match %s", strings.Join(revs, ", "))
+	}
+	return args, true, nil
+}
@@ -17,7 +17,11 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"zombiezen.com/go/gg/internal/gitobj"
 )
 
 func TestLog(t *testing.T) {
@@ -43,4 +47,178 @@ func TestLog(t *testing.T) {
 	if !bytes.Contains(out, []byte(h.Short())) || !bytes.Contains(out, []byte(wantMsg)) {
 		t.Errorf("log does not contain either %q or %q. Output:\n%s", h.Short(), wantMsg, out)
 	}
+	if !bytes.Contains(out, []byte("draft")) {
+		t.Errorf("log does not show the revision's phase. Output:\n%s", out)
+	}
+}
+
+func TestLog_Revset(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "update-ref", "refs/remotes/origin/master", h1.String()); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := dummyRev(ctx, env.git, env.root, "master", "baz.txt", "third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[gitobj.Hash]string{h1: "first", h2: "second", h3: "third"}
+
+	tests := []struct {
+		rev     string
+		want    []gitobj.Hash
+		notWant []gitobj.Hash
+	}{
+		{
+			rev:     "HEAD~1",
+			want:    []gitobj.Hash{h1, h2},
+			notWant: []gitobj.Hash{h3},
+		},
+		{
+			rev:     "draft()",
+			want:    []gitobj.Hash{h2, h3},
+			notWant: []gitobj.Hash{h1},
+		},
+		{
+			rev:     "HEAD~1 or " + h1.String(),
+			want:    []gitobj.Hash{h1, h2},
+			notWant: []gitobj.Hash{h3},
+		},
+		{
+			rev:     "heads(draft())",
+			want:    []gitobj.Hash{h3},
+			notWant: []gitobj.Hash{h1, h2},
+		},
+	}
+	for _, test := range tests {
+		out, err := env.gg(ctx, env.root, "log", "-r", test.rev)
+		if err != nil {
+			t.Errorf("gg log -r %q: %v", test.rev, err)
+			continue
+		}
+		for _, h := range test.want {
+			if !bytes.Contains(out, []byte(h.Short())) {
+				t.Errorf("gg log -r %q does not contain %s. Output:\n%s", test.rev, prettyCommit(h, names), out)
+			}
+		}
+		for _, h := range test.notWant {
+			if bytes.Contains(out, []byte(h.Short())) {
+				t.Errorf("gg log -r %q contains %s. Output:\n%s", test.rev, prettyCommit(h, names), out)
+			}
+		}
+	}
+}
+
+func TestLog_Template(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second\n\nChange-Id: I0123456789abcdef0123456789abcdef01234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.writeConfig([]byte("[gg \"style\"]\n\tmine = {desc|firstline}:{files}\\n\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{
+			template: `{node|short} {desc|firstline}{if(branches, ' [{branches}]')}\n`,
+			want:     h2.Short() + " second [master]\n" + h1.Short() + " first\n",
+		},
+		{
+			template: `{changeid}|{parents|short}\n`,
+			want:     "I0123456789abcdef0123456789abcdef01234567|" + h1.Short() + "\n|\n",
+		},
+		{
+			template: "mine",
+			want:     "second:bar.txt\nfirst:foo.txt\n",
+		},
+	}
+	for _, test := range tests {
+		out, err := env.gg(ctx, env.root, "log", "-T", test.template)
+		if err != nil {
+			t.Errorf("gg log -T %q: %v", test.template, err)
+			continue
+		}
+		if string(out) != test.want {
+			t.Errorf("gg log -T %q = %q; want %q", test.template, out, test.want)
+		}
+	}
+
+	out, err := env.gg(ctx, env.root, "log", "-T", "json", "-r", "HEAD^..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(out, &records); err != nil {
+		t.Fatalf("gg log -T json output is not JSON: %v\n%s", err, out)
+	}
+	if len(records) != 1 {
+		t.Fatalf("gg log -T json -r HEAD^..HEAD returned %d records; want 1", len(records))
+	}
+	if got := records[0]["node"]; got != h2.String() {
+		t.Errorf("node = %v; want %v", got, h2)
+	}
+	if got := records[0]["desc"]; got != "second\n\nChange-Id: I0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("desc = %q; want second commit message", got)
+	}
+	if _, ok := records[0]["phase"]; ok {
+		t.Error("gg log -T json printed phase, which is only printed on request")
+	}
+
+	out, err = env.gg(ctx, env.root, "log", "-T", "json(node, phase)", "-r", "HEAD^..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = nil
+	if err := json.Unmarshal(out, &records); err != nil {
+		t.Fatalf("gg log -T 'json(node, phase)' output is not JSON: %v\n%s", err, out)
+	}
+	want := []map[string]interface{}{{"node": h2.String(), "phase": "draft"}}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Errorf("gg log -T 'json(node, phase)' (-want +got):\n%s", diff)
+	}
+
+	out, err = env.gg(ctx, env.root, "log", "-T", "compact", "-r", "HEAD^..HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := h2.Short() + "  draft "; !bytes.HasPrefix(out, []byte(want)) {
+		t.Errorf("gg log -T compact -r HEAD^..HEAD = %q; want prefix %q", out, want)
+	}
+
+	if _, err := env.gg(ctx, env.root, "log", "-T", "compact", "--graph"); err == nil {
+		t.Error("gg log -T compact --graph did not return an error")
+	} else if !isUsage(err) {
+		t.Errorf("gg log -T compact --graph error = %v; want usage error", err)
+	}
 }
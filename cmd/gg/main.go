@@ -55,27 +55,44 @@ func run(ctx context.Context, pctx *processContext, args []string) error {
 		"  clone         " + cloneSynopsis + "\n" +
 		"  commit        " + commitSynopsis + "\n" +
 		"  diff          " + diffSynopsis + "\n" +
+		"  files         " + filesSynopsis + "\n" +
+		"  heads         " + headsSynopsis + "\n" +
 		"  init          " + initSynopsis + "\n" +
 		"  log           " + logSynopsis + "\n" +
 		"  merge         " + mergeSynopsis + "\n" +
+		"  parents       " + parentsSynopsis + "\n" +
 		"  pull          " + pullSynopsis + "\n" +
 		"  push          " + pushSynopsis + "\n" +
 		"  remove        " + removeSynopsis + "\n" +
 		"  revert        " + revertSynopsis + "\n" +
+		"  show          " + showSynopsis + "\n" +
+		"  smartlog      " + smartlogSynopsis + "\n" +
 		"  status        " + statusSynopsis + "\n" +
+		"  tags          " + tagsSynopsis + "\n" +
 		"  update        " + updateSynopsis + "\n" +
 		"\nadvanced commands:\n" +
+		"  bundle        " + bundleSynopsis + "\n" +
+		"  doctor        " + doctorSynopsis + "\n" +
 		"  evolve        " + evolveSynopsis + "\n" +
 		"  gerrithook    " + gerrithookSynopsis + "\n" +
 		"  histedit      " + histeditSynopsis + "\n" +
 		"  mail          " + mailSynopsis + "\n" +
+		"  obslog        " + obslogSynopsis + "\n" +
+		"  oplog         " + oplogSynopsis + "\n" +
+		"  phase         " + phaseSynopsis + "\n" +
 		"  rebase        " + rebaseSynopsis + "\n" +
-		"  upstream      " + upstreamSynopsis
+		"  recover       " + recoverSynopsis + "\n" +
+		"  redo          " + redoSynopsis + "\n" +
+		"  unbundle      " + unbundleSynopsis + "\n" +
+		"  undo          " + undoSynopsis + "\n" +
+		"  upstream      " + upstreamSynopsis + "\n" +
+		"  verify        " + verifySynopsis
 
 	globalFlags := flag.NewFlagSet(false, synopsis, description)
 	gitPath := globalFlags.String("git", "", "`path` to git executable")
 	showArgs := globalFlags.Bool("show-git", false, "log git invocations")
 	versionFlag := globalFlags.Bool("version", false, "display version information")
+	noHooks := globalFlags.Bool("no-hooks", false, "don't run hooks set in gg.hook.* configuration settings")
 	if err := globalFlags.Parse(args); flag.IsHelp(err) {
 		globalFlags.Help(pctx.stdout)
 		return nil
@@ -123,7 +140,9 @@ func run(ctx context.Context, pctx *processContext, args []string) error {
 	}
 	cc := &cmdContext{
 		dir:    pctx.dir,
+		env:    pctx.env,
 		git:    git,
+		stdin:  pctx.stdin,
 		stdout: pctx.stdout,
 		stderr: pctx.stderr,
 	}
@@ -134,7 +153,13 @@ func run(ctx context.Context, pctx *processContext, args []string) error {
 			return fmt.Errorf("gg: %v", err)
 		}
 	}
-	err = dispatch(ctx, cc, globalFlags, globalFlags.Arg(0), globalFlags.Args()[1:])
+	name, cmdArgs := globalFlags.Arg(0), globalFlags.Args()[1:]
+	// The configuration is read once for hooks and aliases. If it can't
+	// be read, commands that need it report the error when they read it
+	// again.
+	cc.config, _ = gittool.ReadConfig(ctx, cc.git)
+	cc.noHooks = *noHooks
+	err = runCommand(ctx, cc, globalFlags, name, cmdArgs)
 	if isUsage(err) {
 		return err
 	}
@@ -146,9 +171,17 @@ func run(ctx context.Context, pctx *processContext, args []string) error {
 
 type cmdContext struct {
 	dir string
+	env []string
+
+	git     *gittool.Tool
+	hooks   *commandHooks
+	noHooks bool
 
-	git *gittool.Tool
+	// config is the git configuration as of when gg started, or nil if
+	// it could not be read. Use readConfig to access it.
+	config *gittool.Config
 
+	stdin  io.Reader
 	stdout io.Writer
 	stderr io.Writer
 }
@@ -160,14 +193,70 @@ func (cc *cmdContext) abs(path string) string {
 	return filepath.Join(cc.dir, path)
 }
 
+// readConfig returns the git configuration read when gg started,
+// reading it again if that failed. Commands that change the
+// configuration should call gittool.ReadConfig instead.
+func (cc *cmdContext) readConfig(ctx context.Context) (*gittool.Config, error) {
+	if cc.config != nil {
+		return cc.config, nil
+	}
+	return gittool.ReadConfig(ctx, cc.git)
+}
+
 func (cc *cmdContext) withDir(path string) *cmdContext {
 	path = cc.abs(path)
 	return &cmdContext{
-		dir:    path,
-		git:    cc.git.WithDir(path),
-		stdout: cc.stdout,
-		stderr: cc.stderr,
+		dir:     path,
+		env:     cc.env,
+		git:     cc.git.WithDir(path),
+		hooks:   cc.hooks,
+		noHooks: cc.noHooks,
+		stdin:   cc.stdin,
+		stdout:  cc.stdout,
+		stderr:  cc.stderr,
+	}
+}
+
+func (cc *cmdContext) withHooks(hooks *commandHooks) *cmdContext {
+	cc2 := new(cmdContext)
+	*cc2 = *cc
+	cc2.hooks = hooks
+	return cc2
+}
+
+// runCommand runs a command along with its hooks. It is used for the
+// command on gg's command line as well as for the commands that user
+// aliases expand to.
+func runCommand(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, name string, args []string) error {
+	var hooks *commandHooks
+	if !cc.noHooks && !hooklessCommands[name] {
+		var err error
+		hooks, err = loadHooks(ctx, cc, name, args)
+		if err != nil {
+			return err
+		}
+	}
+	cc = cc.withHooks(hooks)
+	if !destinationCommands[name] {
+		if err := cc.hooks.runPre(ctx, cc); err != nil {
+			return err
+		}
+	}
+	var err error
+	if recordedCommands[name] {
+		err = runRecorded(ctx, cc, append([]string{name}, args...), func() error {
+			return dispatch(ctx, cc, globalFlags, name, args)
+		})
+	} else {
+		err = dispatch(ctx, cc, globalFlags, name, args)
 	}
+	if hookErr := cc.hooks.runPost(ctx, cc, err); hookErr != nil {
+		if err == nil {
+			return hookErr
+		}
+		fmt.Fprintf(cc.stderr, "gg: %v\n", hookErr)
+	}
+	return err
 }
 
 func dispatch(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, name string, args []string) error {
@@ -176,6 +265,8 @@ func dispatch(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, na
 		return add(ctx, cc, args)
 	case "branch":
 		return branch(ctx, cc, args)
+	case "bundle":
+		return bundle(ctx, cc, args)
 	case "cat":
 		return cat(ctx, cc, args)
 	case "clone":
@@ -184,10 +275,16 @@ func dispatch(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, na
 		return commit(ctx, cc, args)
 	case "diff":
 		return diff(ctx, cc, args)
+	case "doctor":
+		return doctor(ctx, cc, args)
 	case "evolve":
 		return evolve(ctx, cc, args)
+	case "files":
+		return files(ctx, cc, args)
 	case "gerrithook":
 		return gerrithook(ctx, cc, args)
+	case "heads":
+		return heads(ctx, cc, args)
 	case "histedit":
 		return histedit(ctx, cc, args)
 	case "init":
@@ -198,6 +295,14 @@ func dispatch(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, na
 		return mail(ctx, cc, args)
 	case "merge":
 		return merge(ctx, cc, args)
+	case "obslog":
+		return obslog(ctx, cc, args)
+	case "oplog":
+		return oplog(ctx, cc, args)
+	case "parents":
+		return parents(ctx, cc, args)
+	case "phase":
+		return phase(ctx, cc, args)
 	case "pull":
 		return pull(ctx, cc, args)
 	case "push":
@@ -206,20 +311,37 @@ func dispatch(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, na
 		return remove(ctx, cc, args)
 	case "rebase":
 		return rebase(ctx, cc, args)
+	case "recover":
+		return recoverCommits(ctx, cc, args)
+	case "redo":
+		return redo(ctx, cc, args)
 	case "revert":
 		return revert(ctx, cc, args)
+	case "show":
+		return show(ctx, cc, args)
+	case "smartlog", "sl":
+		return smartlog(ctx, cc, args)
 	case "status", "st", "check":
 		return status(ctx, cc, args)
+	case "tags":
+		return tags(ctx, cc, args)
+	case "unbundle":
+		return unbundle(ctx, cc, args)
+	case "undo":
+		return undo(ctx, cc, args)
 	case "update", "up", "checkout", "co":
 		return update(ctx, cc, args)
 	case "upstream":
 		return upstream(ctx, cc, args)
+	case "verify":
+		return verify(ctx, cc, args)
 	case "version":
 		return showVersion(ctx, cc)
 	case "help":
 		if len(args) == 0 {
 			globalFlags.Help(cc.stdout)
-			return nil
+			printExternalHelp(ctx, cc)
+			return printAliasHelp(ctx, cc)
 		}
 		if len(args) > 1 || strings.HasPrefix(args[0], "-") {
 			return usagef("help [command]")
@@ -236,7 +358,14 @@ func dispatch(ctx context.Context, cc *cmdContext, globalFlags *flag.FlagSet, na
 		}
 		return nil
 	default:
-		return usagef("unknown command %s", name)
+		if found, err := runExternal(ctx, cc, name, args); found {
+			return err
+		}
+		found, err := runAlias(ctx, cc, globalFlags, name, args)
+		if !found && err == nil {
+			return usagef("unknown command %s", name)
+		}
+		return err
 	}
 }
 
@@ -128,6 +128,12 @@ func (env *testEnv) editorCmd(content []byte) (string, error) {
 	return fmt.Sprintf("%s %s", cpPath, shellEscape(dst)), nil
 }
 
+// binDir returns the path to the directory that is prepended to the
+// PATH of gg commands run with env.gg. It may not exist.
+func (env *testEnv) binDir() string {
+	return filepath.Join(env.topDir, "bin")
+}
+
 func (env *testEnv) cleanup() {
 	if env.tb.Failed() && env.stderr.Len() > 0 {
 		env.tb.Log("stderr:", env.stderr)
@@ -141,7 +147,7 @@ func (env *testEnv) gg(ctx context.Context, dir string, args ...string) ([]byte,
 	out := new(bytes.Buffer)
 	pctx := &processContext{
 		dir:    dir,
-		env:    []string{"GIT_CONFIG_NOSYSTEM=1", "HOME=" + env.topDir},
+		env:    []string{"GIT_CONFIG_NOSYSTEM=1", "HOME=" + env.topDir, "PATH=" + env.binDir() + string(filepath.ListSeparator) + os.Getenv("PATH")},
 		stdout: out,
 		stderr: env.stderr,
 	}
@@ -0,0 +1,106 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+const obslogSynopsis = "show the rewrite history of a revision"
+
+func obslog(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg obslog [-r REV]", obslogSynopsis+`
+
+	Commands that rewrite history (`+"`gg commit --amend`"+`, `+"`gg rebase`"+`,
+	`+"`gg histedit`"+`, and `+"`gg evolve`"+`) record an obsolescence marker
+	from each rewritten commit to the commit that replaced it, so
+	commits folded together in a histedit all point to the result. The
+	markers are stored as git notes under `+"`"+obsMarkersRef+"`"+`.
+
+	obslog shows the revision followed by the revisions it replaced,
+	most recent first. Rewritten revisions are marked with `+"`x`"+`.`)
+	rev := f.String("r", gitobj.Head.String(), "show history of the specified `rev`ision")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	r, err := parseRevArg(ctx, cc.git, *rev)
+	if err != nil {
+		return err
+	}
+	store, err := readObsStore(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+
+	// Walk predecessors breadth-first.
+	history := []gitobj.Hash{r.Commit()}
+	seen := map[gitobj.Hash]bool{r.Commit(): true}
+	for i := 0; i < len(history); i++ {
+		for _, m := range store.predecessors[history[i]] {
+			if !seen[m.pred] {
+				seen[m.pred] = true
+				history = append(history, m.pred)
+			}
+		}
+	}
+	for i, h := range history {
+		marker := "o"
+		if len(store.successors[h]) > 0 {
+			marker = "x"
+		}
+		fmt.Fprintf(cc.stdout, "%s  %s  %s\n", marker, h.Short(), obslogSummary(ctx, cc, h))
+		edge := "|"
+		if i == len(history)-1 {
+			edge = " "
+		}
+		for _, m := range store.successors[h] {
+			fmt.Fprintf(cc.stdout, "%s    rewritten by %s as %s at %s\n", edge, m.op, m.succ.Short(), m.time.Format("2006-01-02 15:04 -0700"))
+		}
+		if i < len(history)-1 {
+			fmt.Fprintln(cc.stdout, "|")
+		}
+	}
+	return nil
+}
+
+// obslogSummary returns the first line of the commit's message. Commits
+// that were rewritten may have been garbage collected, in which case
+// a placeholder is returned.
+func obslogSummary(ctx context.Context, cc *cmdContext, commit gitobj.Hash) string {
+	const unavailable = "(commit not available)"
+	if exists, err := cc.git.Query(ctx, "cat-file", "-e", commit.String()); err != nil || !exists {
+		return unavailable
+	}
+	info, err := readCommitInfo(ctx, cc.git, commit)
+	if err != nil {
+		return unavailable
+	}
+	msg := info.message
+	if i := strings.IndexByte(msg, '\n'); i != -1 {
+		msg = msg[:i]
+	}
+	return msg
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestObslog(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "commit", "--amend", "-m", "amended"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2 := r.Commit()
+	if h2 == h1 {
+		t.Fatal("amend did not change HEAD")
+	}
+
+	out, err := env.gg(ctx, env.root, "obslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := regexp.MustCompile(`^o  ` + h2.Short() + `  amended\n` +
+		`\|\n` +
+		`x  ` + h1.Short() + `  first\n` +
+		`     rewritten by amend as ` + h2.Short() + ` at [-0-9: +]+\n$`)
+	if !want.Match(out) {
+		t.Errorf("gg obslog output:\n%s\nwant match for:\n%v", out, want)
+	}
+
+	// The predecessor has no predecessors of its own.
+	out, err = env.gg(ctx, env.root, "obslog", "-r", h1.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = regexp.MustCompile(`^x  ` + h1.Short() + `  first\n` +
+		`     rewritten by amend as ` + h2.Short() + ` at [-0-9: +]+\n$`)
+	if !want.Match(out) {
+		t.Errorf("gg obslog -r %v output:\n%s\nwant match for:\n%v", h1, out, want)
+	}
+}
+
+func TestObslog_Rebase(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "base"); err != nil {
+		t.Fatal(err)
+	}
+	f1, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "feature one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := dummyRev(ctx, env.git, env.root, "feature", "baz.txt", "feature two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "quux.txt", "upstream"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "rebase"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		rev  string
+		pred string
+	}{
+		{"HEAD", f2.Short()},
+		{"HEAD~1", f1.Short()},
+	} {
+		r, err := gittool.ParseRev(ctx, env.git, test.rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := env.gg(ctx, env.root, "obslog", "-r", test.rev)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		want := regexp.MustCompile(`(?m)^x  ` + test.pred + `  .*\n +rewritten by rebase as ` + r.Commit().Short() + ` `)
+		if !want.Match(out) {
+			t.Errorf("gg obslog -r %s output:\n%s\nwant match for:\n%v", test.rev, out, want)
+		}
+	}
+}
+
+func TestObslog_HisteditFold(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	base, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f1, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "feature one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := dummyRev(ctx, env.git, env.root, "feature", "baz.txt", "feature two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebaseEditor, err := env.editorCmd([]byte("pick " + f1.String() + "\nsquash " + f2.String() + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgEditor, err := env.editorCmd([]byte("folded feature\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf("[sequence]\neditor = %s\n[core]\neditor = %s\n",
+		configEscape(rebaseEditor), configEscape(msgEditor))
+	if err := env.writeConfig([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := env.gg(ctx, env.root, "histedit", base.String()); err != nil {
+		t.Fatalf("histedit failed: %v; output:\n%s", err, out)
+	}
+	head, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := env.gg(ctx, env.root, "obslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pred := range []gitobj.Hash{f1, f2} {
+		want := regexp.MustCompile(`(?m)^x  ` + pred.Short() + `  .*\n[ |]+rewritten by histedit as ` + head.Commit().Short() + ` `)
+		if !want.Match(out) {
+			t.Errorf("gg obslog output:\n%s\nwant match for:\n%v", out, want)
+		}
+	}
+	if err := env.git.Run(ctx, "rev-parse", "-q", "--verify", rewriteNotesRef); err == nil {
+		t.Errorf("%s still exists after histedit", rewriteNotesRef)
+	}
+}
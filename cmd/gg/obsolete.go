@@ -0,0 +1,371 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+// obsMarkersRef is the notes ref that stores obsolescence markers. Each
+// note is attached to a rewritten commit (the predecessor) and has a
+// line for each of its successors of the form:
+//
+//	SUCCESSOR OPERATION UNIX-TIME
+const obsMarkersRef = "refs/notes/gg-obsmarkers"
+
+// An obsMarker records that a commit was rewritten.
+type obsMarker struct {
+	pred gitobj.Hash
+	succ gitobj.Hash
+	op   string // amend, rebase, histedit, or evolve
+	time time.Time
+}
+
+// recordObsMarkers adds the markers to the repository.
+func recordObsMarkers(ctx context.Context, git *gittool.Tool, markers []obsMarker) error {
+	for _, m := range markers {
+		line := fmt.Sprintf("%v %s %d", m.succ, m.op, m.time.Unix())
+		if err := git.Run(ctx, "notes", "--ref="+obsMarkersRef, "append", "-m", line, m.pred.String()); err != nil {
+			return fmt.Errorf("record obsolescence marker for %v: %v", m.pred, err)
+		}
+	}
+	return nil
+}
+
+// An obsStore is the set of obsolescence markers in a repository.
+type obsStore struct {
+	successors   map[gitobj.Hash][]obsMarker
+	predecessors map[gitobj.Hash][]obsMarker
+}
+
+// readObsStore reads all of the obsolescence markers in the repository.
+func readObsStore(ctx context.Context, git *gittool.Tool) (*obsStore, error) {
+	store := &obsStore{
+		successors:   make(map[gitobj.Hash][]obsMarker),
+		predecessors: make(map[gitobj.Hash][]obsMarker),
+	}
+	err := scanObsNotes(ctx, git, func(path, line string) error {
+		pred, err := gitobj.ParseHash(strings.Replace(path, "/", "", -1))
+		if err != nil {
+			return fmt.Errorf("note %s: %v", path, err)
+		}
+		m, err := parseObsMarker(pred, line)
+		if err != nil {
+			return fmt.Errorf("note for %v: %v", pred, err)
+		}
+		store.successors[m.pred] = append(store.successors[m.pred], m)
+		store.predecessors[m.succ] = append(store.predecessors[m.succ], m)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read obsolescence markers: %v", err)
+	}
+	return store, nil
+}
+
+// scanObsNotes calls f for each non-blank line of the notes in
+// obsMarkersRef, along with the path of the note in the notes tree.
+// It stops at the first error that f returns.
+func scanObsNotes(ctx context.Context, git *gittool.Tool, f func(path, line string) error) error {
+	return scanNotes(ctx, git, obsMarkersRef, f)
+}
+
+// scanNotes calls f for each non-blank line of the notes in the given
+// notes ref, along with the path of the note in the notes tree. It
+// stops at the first error that f returns.
+func scanNotes(ctx context.Context, git *gittool.Tool, ref string, f func(path, line string) error) error {
+	if exists, err := git.Query(ctx, "rev-parse", "-q", "--verify", ref); err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+	// Grepping the notes tree reads every note in a single process.
+	p, err := git.Start(ctx, "-c", "grep.lineNumber=false", "grep", "--no-color", "--full-name", "-z", "-e", "", ref, "--", ":/")
+	if err != nil {
+		return err
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	prefix := []byte(ref + ":")
+	for s.Scan() {
+		line := s.Bytes()
+		i := bytes.IndexByte(line, 0)
+		if i == -1 || !bytes.HasPrefix(line, prefix) {
+			return fmt.Errorf("parse git grep: malformed line %q", line)
+		}
+		if i+1 == len(line) {
+			// Blank line between appended notes.
+			continue
+		}
+		if err := f(string(line[len(prefix):i]), string(line[i+1:])); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+func parseObsMarker(pred gitobj.Hash, line string) (obsMarker, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return obsMarker{}, fmt.Errorf("malformed marker %q", line)
+	}
+	succ, err := gitobj.ParseHash(fields[0])
+	if err != nil {
+		return obsMarker{}, fmt.Errorf("malformed marker %q: %v", line, err)
+	}
+	sec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return obsMarker{}, fmt.Errorf("malformed marker %q: %v", line, err)
+	}
+	return obsMarker{
+		pred: pred,
+		succ: succ,
+		op:   fields[1],
+		time: time.Unix(sec, 0),
+	}, nil
+}
+
+// latestSuccessor follows the most recent markers from the given commit
+// until it reaches a commit that has not been rewritten. It returns
+// false if the commit has not been rewritten.
+func (store *obsStore) latestSuccessor(commit gitobj.Hash) (gitobj.Hash, bool) {
+	visited := map[gitobj.Hash]bool{commit: true}
+	curr := commit
+	for {
+		markers := store.successors[curr]
+		if len(markers) == 0 {
+			break
+		}
+		latest := markers[0]
+		for _, m := range markers[1:] {
+			if !m.time.Before(latest.time) {
+				latest = m
+			}
+		}
+		if visited[latest.succ] {
+			break
+		}
+		visited[latest.succ] = true
+		curr = latest.succ
+	}
+	return curr, curr != commit
+}
+
+// pendingRewriteFile is the name of the file in the git directory that
+// records the commits being rewritten by an in-progress rebase.
+const pendingRewriteFile = "gg-rewrite"
+
+// rewriteNotesRef is the notes ref that tracks the commits being
+// rewritten by an in-progress rebase. Before the rebase, each commit is
+// given a note containing its own hash. git rebase copies the notes in
+// the refs named by notes.rewriteRef to the commits that replace them,
+// concatenating them when commits are squashed together, so afterward
+// each note lists the exact commits that a new commit replaced.
+const rewriteNotesRef = "refs/notes/gg-rewrite"
+
+// rewriteConfig is the git configuration that rebases started by
+// runRewrite, along with their continuations, must run with.
+var rewriteConfig = []string{"-c", "notes.rewriteRef=" + rewriteNotesRef}
+
+// runRewrite runs a git rebase command that rewrites the commits
+// selected by revListArgs onto the given commit. Once the rebase
+// finishes, whether in this command or in a later `--continue`,
+// obsolescence markers are recorded for the rewritten commits.
+func runRewrite(ctx context.Context, git *gittool.Tool, op string, onto string, revListArgs []string, rebaseArgs ...string) error {
+	ontoRev, err := gittool.ParseRev(ctx, git, onto)
+	if err != nil {
+		return err
+	}
+	old, err := revList(ctx, git, revListArgs...)
+	if err != nil {
+		return err
+	}
+	gitDir, err := gittool.GitDir(ctx, git)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %v\n", op, ontoRev.Commit())
+	for _, h := range old {
+		fmt.Fprintln(buf, h)
+	}
+	if err := ioutil.WriteFile(filepath.Join(gitDir, pendingRewriteFile), buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	if err := writeRewriteNotes(ctx, git, old); err != nil {
+		abortRewrite(ctx, git)
+		return err
+	}
+	if err := git.RunInteractive(ctx, append(rewriteConfig, rebaseArgs...)...); err != nil {
+		if inProgress, _ := rebaseInProgress(gitDir); !inProgress {
+			abortRewrite(ctx, git)
+		}
+		return err
+	}
+	return finishRewrite(ctx, git)
+}
+
+// finishRewrite records obsolescence markers for a rebase started by
+// runRewrite if it has finished.
+func finishRewrite(ctx context.Context, git *gittool.Tool) error {
+	gitDir, err := gittool.GitDir(ctx, git)
+	if err != nil {
+		return err
+	}
+	if inProgress, err := rebaseInProgress(gitDir); err != nil || inProgress {
+		return err
+	}
+	path := filepath.Join(gitDir, pendingRewriteFile)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	defer deleteRewriteNotes(ctx, git)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	header := strings.Fields(lines[0])
+	if len(header) != 2 {
+		return fmt.Errorf("record rewritten commits: malformed %s", pendingRewriteFile)
+	}
+	op := header[0]
+	var old []gitobj.Hash
+	for _, line := range lines[1:] {
+		h, err := gitobj.ParseHash(line)
+		if err != nil {
+			return fmt.Errorf("record rewritten commits: malformed %s: %v", pendingRewriteFile, err)
+		}
+		old = append(old, h)
+	}
+	rewritten, err := revList(ctx, git, gitobj.Head.String(), "^"+header[1])
+	if err != nil {
+		return fmt.Errorf("record rewritten commits: %v", err)
+	}
+	markers, err := readRewriteNotes(ctx, git, op, old, rewritten)
+	if err != nil {
+		return fmt.Errorf("record rewritten commits: %v", err)
+	}
+	return recordObsMarkers(ctx, git, markers)
+}
+
+// writeRewriteNotes replaces the notes in rewriteNotesRef with a note
+// for each of the commits that contains the commit's hash.
+func writeRewriteNotes(ctx context.Context, git *gittool.Tool, commits []gitobj.Hash) error {
+	// fast-import writes all of the notes in a single process.
+	input := new(bytes.Buffer)
+	fmt.Fprintf(input, "commit %s\ncommitter gg <gg> %d +0000\ndata 0\n", rewriteNotesRef, time.Now().Unix())
+	for _, h := range commits {
+		note := h.String() + "\n"
+		fmt.Fprintf(input, "N inline %v\ndata %d\n%s", h, len(note), note)
+	}
+	p, err := git.StartWithInput(ctx, input, "fast-import", "--quiet", "--force")
+	if err != nil {
+		return fmt.Errorf("mark rewritten commits: %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, p); err != nil {
+		p.Wait()
+		return fmt.Errorf("mark rewritten commits: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return fmt.Errorf("mark rewritten commits: %v", err)
+	}
+	return nil
+}
+
+// readRewriteNotes returns markers from the old commits to the
+// rewritten commits that git rebase copied their notes in
+// rewriteNotesRef to.
+func readRewriteNotes(ctx context.Context, git *gittool.Tool, op string, old, rewritten []gitobj.Hash) ([]obsMarker, error) {
+	isOld := make(map[gitobj.Hash]bool, len(old))
+	for _, h := range old {
+		isOld[h] = true
+	}
+	isRewritten := make(map[gitobj.Hash]bool, len(rewritten))
+	for _, h := range rewritten {
+		isRewritten[h] = true
+	}
+	now := time.Now()
+	var markers []obsMarker
+	err := scanNotes(ctx, git, rewriteNotesRef, func(path, line string) error {
+		succ, err := gitobj.ParseHash(strings.Replace(path, "/", "", -1))
+		if err != nil {
+			return fmt.Errorf("note %s: %v", path, err)
+		}
+		pred, err := gitobj.ParseHash(strings.TrimSpace(line))
+		if err != nil {
+			return fmt.Errorf("note for %v: %v", succ, err)
+		}
+		if isRewritten[succ] && isOld[pred] && pred != succ {
+			markers = append(markers, obsMarker{pred: pred, succ: succ, op: op, time: now})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return markers, nil
+}
+
+// deleteRewriteNotes removes rewriteNotesRef.
+func deleteRewriteNotes(ctx context.Context, git *gittool.Tool) error {
+	if exists, err := git.Query(ctx, "rev-parse", "-q", "--verify", rewriteNotesRef); err != nil || !exists {
+		return err
+	}
+	return git.Run(ctx, "update-ref", "-d", rewriteNotesRef)
+}
+
+// abortRewrite discards the state saved by runRewrite.
+func abortRewrite(ctx context.Context, git *gittool.Tool) error {
+	gitDir, err := gittool.GitDir(ctx, git)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(gitDir, pendingRewriteFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return deleteRewriteNotes(ctx, git)
+}
+
+func rebaseInProgress(gitDir string) (bool, error) {
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(gitDir, name)); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,493 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+// oplogFile is the name of the file in the git directory that stores
+// the operation log. Each line is a JSON-encoded opEntry.
+const oplogFile = "gg-oplog"
+
+// recordedCommands is the set of commands (including aliases) whose
+// effects on refs are recorded in the operation log.
+var recordedCommands = map[string]bool{
+	"branch":   true,
+	"checkout": true,
+	"ci":       true,
+	"co":       true,
+	"commit":   true,
+	"evolve":   true,
+	"histedit": true,
+	"merge":    true,
+	"pull":     true,
+	"rebase":   true,
+	"recover":  true,
+	"unbundle": true,
+	"up":       true,
+	"update":   true,
+}
+
+// An opEntry is a single operation in the log.
+type opEntry struct {
+	ID     int
+	Time   time.Time
+	Args   []string
+	Before *refSnapshot
+	After  *refSnapshot
+
+	// Undoes is the list of operations that an undo restored the
+	// state from before.
+	Undoes []int `json:",omitempty"`
+	// Redoes is the list of operations that a redo restored the state
+	// from after.
+	Redoes []int `json:",omitempty"`
+}
+
+// A refSnapshot is the state of the refs that gg manages.
+type refSnapshot struct {
+	// Head is either the ref that HEAD points to or a commit hash if
+	// HEAD is detached.
+	Head string
+	Refs map[gitobj.Ref]gitobj.Hash
+}
+
+func (snap *refSnapshot) equal(other *refSnapshot) bool {
+	if snap.Head != other.Head || len(snap.Refs) != len(other.Refs) {
+		return false
+	}
+	for ref, h := range snap.Refs {
+		if h2, ok := other.Refs[ref]; !ok || h != h2 {
+			return false
+		}
+	}
+	return true
+}
+
+// headCommit returns the commit that HEAD points to in the snapshot.
+func (snap *refSnapshot) headCommit() (gitobj.Hash, bool) {
+	if h, err := gitobj.ParseHash(snap.Head); err == nil {
+		return h, true
+	}
+	h, ok := snap.Refs[gitobj.Ref(snap.Head)]
+	return h, ok
+}
+
+// takeSnapshot records the current values of HEAD, the local branches,
+// and gg's own refs.
+func takeSnapshot(ctx context.Context, git *gittool.Tool) (*refSnapshot, error) {
+	snap := &refSnapshot{Refs: make(map[gitobj.Ref]gitobj.Hash)}
+	head, err := git.RunOneLiner(ctx, '\n', "symbolic-ref", "-q", gitobj.Head.String())
+	if err == nil {
+		snap.Head = string(head)
+	} else {
+		r, err := gittool.ParseRev(ctx, git, gitobj.Head.String())
+		if err != nil {
+			return nil, fmt.Errorf("snapshot refs: %v", err)
+		}
+		snap.Head = r.Commit().String()
+	}
+	p, err := git.Start(ctx, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads/", obsMarkersRef)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot refs: %v", err)
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		line := s.Text()
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil, errors.New("snapshot refs: parse git for-each-ref: line must start with commit hash")
+		}
+		h, err := gitobj.ParseHash(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("snapshot refs: parse git for-each-ref: %v", err)
+		}
+		snap.Refs[gitobj.Ref(line[i+1:])] = h
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("snapshot refs: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("snapshot refs: %v", err)
+	}
+	return snap, nil
+}
+
+// runRecorded runs a command, adding an entry to the operation log if
+// the command changed any refs. Failing to record the operation is
+// reported but does not fail the command.
+func runRecorded(ctx context.Context, cc *cmdContext, args []string, run func() error) error {
+	before, err := takeSnapshot(ctx, cc.git)
+	if err != nil {
+		// Probably not in a repository or in one without commits yet.
+		return run()
+	}
+	runErr := run()
+	after, err := takeSnapshot(ctx, cc.git)
+	if err != nil || after.equal(before) {
+		return runErr
+	}
+	err = appendOplog(ctx, cc.git, &opEntry{
+		Time:   time.Now(),
+		Args:   args,
+		Before: before,
+		After:  after,
+	})
+	if err != nil {
+		fmt.Fprintf(cc.stderr, "gg: %v\n", err)
+	}
+	return runErr
+}
+
+// readOplog reads all the entries in the operation log, oldest first.
+func readOplog(ctx context.Context, git *gittool.Tool) ([]*opEntry, error) {
+	var entries []*opEntry
+	err := scanOplog(ctx, git, func(lineno int, line []byte) error {
+		e := new(opEntry)
+		if err := json.Unmarshal(line, e); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read operation log: %v", err)
+	}
+	return entries, nil
+}
+
+// scanOplog calls f for each non-blank line of the operation log along
+// with its 1-based line number. It stops at the first error that f
+// returns. A missing log is treated as empty.
+func scanOplog(ctx context.Context, git *gittool.Tool, f func(lineno int, line []byte) error) error {
+	gitDir, err := gittool.GitDir(ctx, git)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Join(gitDir, oplogFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	s := bufio.NewScanner(file)
+	s.Buffer(nil, 1<<26)
+	for lineno := 1; s.Scan(); lineno++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		if err := f(lineno, s.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// appendOplog adds an entry to the end of the operation log, assigning
+// it the next ID.
+func appendOplog(ctx context.Context, git *gittool.Tool, e *opEntry) error {
+	entries, err := readOplog(ctx, git)
+	if err != nil {
+		return err
+	}
+	e.ID = 1
+	if len(entries) > 0 {
+		e.ID = entries[len(entries)-1].ID + 1
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("record operation: %v", err)
+	}
+	data = append(data, '\n')
+	gitDir, err := gittool.GitDir(ctx, git)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(gitDir, oplogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("record operation: %v", err)
+	}
+	_, err = f.Write(data)
+	closeErr := f.Close()
+	if err != nil {
+		return fmt.Errorf("record operation: %v", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("record operation: %v", closeErr)
+	}
+	return nil
+}
+
+// undoneOps returns the set of operations that are currently undone.
+func undoneOps(entries []*opEntry) map[int]bool {
+	undone := make(map[int]bool)
+	for _, e := range entries {
+		for _, id := range e.Undoes {
+			undone[id] = true
+		}
+		for _, id := range e.Redoes {
+			delete(undone, id)
+		}
+	}
+	return undone
+}
+
+const oplogSynopsis = "show the operation log"
+
+func oplog(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg oplog [-l N]", oplogSynopsis+`
+
+	gg records the state of HEAD, local branches, and gg's own metadata
+	before and after each command that changes them. oplog lists these
+	operations, most recent first. Use `+"`gg undo`"+` to restore the state
+	from before an operation and `+"`gg redo`"+` to reapply an undone
+	operation.`)
+	limit := f.Int("l", 0, "show at most `N` operations")
+	f.Alias("l", "limit")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	entries, err := readOplog(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	undone := undoneOps(entries)
+	n := 0
+	for i := len(entries) - 1; i >= 0 && (*limit <= 0 || n < *limit); i-- {
+		e := entries[i]
+		n++
+		var note string
+		switch {
+		case len(e.Undoes) > 0:
+			note = "  (undid " + formatOpIDs(e.Undoes) + ")"
+		case len(e.Redoes) > 0:
+			note = "  (redid " + formatOpIDs(e.Redoes) + ")"
+		case undone[e.ID]:
+			note = "  (undone)"
+		}
+		quoted := make([]string, len(e.Args))
+		for j, a := range e.Args {
+			quoted[j] = shellEscape(a)
+		}
+		fmt.Fprintf(cc.stdout, "%d  %s  gg %s%s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04:05 -0700"), strings.Join(quoted, " "), note)
+	}
+	return nil
+}
+
+func formatOpIDs(ids []int) string {
+	sorted := append([]int(nil), ids...)
+	sort.Ints(sorted)
+	s := make([]string, len(sorted))
+	for i, id := range sorted {
+		s[i] = fmt.Sprint(id)
+	}
+	return strings.Join(s, ", ")
+}
+
+const undoSynopsis = "undo the last operation"
+
+func undo(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg undo [-n N]", undoSynopsis+`
+
+	Restore HEAD, local branches, and gg's metadata to their state from
+	before the most recent operation that has not already been undone
+	(see `+"`gg oplog`"+`), and update the working copy to match. Passing
+	`+"`-n`"+` undoes that many operations. The working copy must not have
+	any uncommitted changes.`)
+	n := f.Int("n", 1, "undo the last `N` operations")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	if *n < 1 {
+		return usagef("-n must be at least 1")
+	}
+	entries, err := readOplog(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	undone := undoneOps(entries)
+	var ops []*opEntry
+	for i := len(entries) - 1; i >= 0 && len(ops) < *n; i-- {
+		e := entries[i]
+		if len(e.Undoes) == 0 && len(e.Redoes) == 0 && !undone[e.ID] {
+			ops = append(ops, e)
+		}
+	}
+	if len(ops) == 0 {
+		return errors.New("nothing to undo")
+	}
+	if len(ops) < *n {
+		return fmt.Errorf("only %d operations can be undone", len(ops))
+	}
+	target := ops[len(ops)-1].Before
+	ids := make([]int, len(ops))
+	for i, op := range ops {
+		ids[i] = op.ID
+	}
+	return restoreSnapshot(ctx, cc, target, &opEntry{Args: append([]string{"undo"}, args...), Undoes: ids})
+}
+
+const redoSynopsis = "redo the last undone operation"
+
+func redo(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg redo", redoSynopsis+`
+
+	Reverse the most recent `+"`gg undo`"+`, as long as no other operations
+	have happened since. The working copy must not have any uncommitted
+	changes.`)
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	entries, err := readOplog(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	undone := undoneOps(entries)
+	byID := make(map[int]*opEntry, len(entries))
+	for _, e := range entries {
+		byID[e.ID] = e
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if len(e.Undoes) == 0 && len(e.Redoes) == 0 {
+			// A new operation happened after the undo.
+			break
+		}
+		if len(e.Undoes) == 0 || !undone[e.Undoes[0]] {
+			continue
+		}
+		// Undoes is ordered newest first.
+		newest := byID[e.Undoes[0]]
+		if newest == nil {
+			return fmt.Errorf("operation %d missing from log", e.Undoes[0])
+		}
+		return restoreSnapshot(ctx, cc, newest.After, &opEntry{Args: append([]string{"redo"}, args...), Redoes: e.Undoes})
+	}
+	return errors.New("nothing to redo")
+}
+
+// restoreSnapshot sets the refs to the state in the snapshot, updates
+// the working copy, and records the given entry in the operation log.
+func restoreSnapshot(ctx context.Context, cc *cmdContext, target *refSnapshot, entry *opEntry) error {
+	gitDir, err := gittool.GitDir(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	if inProgress, err := rebaseInProgress(gitDir); err != nil {
+		return err
+	} else if inProgress {
+		return errors.New("rebase in progress; run `gg rebase --abort` first")
+	}
+	if err := cc.git.Run(ctx, "update-index", "-q", "--refresh"); err != nil {
+		return err
+	}
+	if clean, err := cc.git.Query(ctx, "diff-index", "--quiet", gitobj.Head.String(), "--"); err != nil {
+		return err
+	} else if !clean {
+		return errors.New("working copy has uncommitted changes")
+	}
+	before, err := takeSnapshot(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	oldHead, _ := before.headCommit()
+	newHead, ok := target.headCommit()
+	if !ok {
+		return fmt.Errorf("restore: HEAD (%s) missing from snapshot", target.Head)
+	}
+	for ref, h := range target.Refs {
+		if exists, err := cc.git.Query(ctx, "cat-file", "-e", h.String()); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("restore: %s points to %v, which no longer exists", ref, h)
+		}
+	}
+
+	// Update the working copy first: it is the step most likely to fail.
+	if oldHead != newHead {
+		if err := cc.git.Run(ctx, "read-tree", "-m", "-u", oldHead.String(), newHead.String()); err != nil {
+			return err
+		}
+	}
+	for ref := range before.Refs {
+		if _, keep := target.Refs[ref]; !keep {
+			if err := cc.git.Run(ctx, "update-ref", "-m", "gg "+entry.Args[0], "-d", ref.String()); err != nil {
+				return err
+			}
+		}
+	}
+	for ref, h := range target.Refs {
+		if before.Refs[ref] == h {
+			continue
+		}
+		if err := cc.git.Run(ctx, "update-ref", "-m", "gg "+entry.Args[0], ref.String(), h.String()); err != nil {
+			return err
+		}
+	}
+	if _, err := gitobj.ParseHash(target.Head); err == nil {
+		err = cc.git.Run(ctx, "update-ref", "-m", "gg "+entry.Args[0], "--no-deref", gitobj.Head.String(), target.Head)
+		if err != nil {
+			return err
+		}
+	} else if target.Head != before.Head {
+		if err := cc.git.Run(ctx, "symbolic-ref", "-m", "gg "+entry.Args[0], gitobj.Head.String(), target.Head); err != nil {
+			return err
+		}
+	}
+
+	entry.Time = time.Now()
+	entry.Before = before
+	entry.After, err = takeSnapshot(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	return appendOplog(ctx, cc.git, entry)
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestUndo(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(env.root, "bar.txt"), []byte("bar\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "add", "bar.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "commit", "-m", "second"); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "branch", "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Undo the branch creation and the commit.
+	if _, err := env.gg(ctx, env.root, "undo", "-n", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "HEAD"); err != nil {
+		t.Fatal(err)
+	} else {
+		if r.Commit() != h1 {
+			t.Errorf("after undo, HEAD = %v; want %v", r.Commit(), h1)
+		}
+		if r.Ref() != gitobj.BranchRef("master") {
+			t.Errorf("after undo, HEAD ref = %s; want refs/heads/master", r.Ref())
+		}
+	}
+	if _, err := gittool.ParseRev(ctx, env.git, "refs/heads/feature"); err == nil {
+		t.Error("after undo, feature branch exists")
+	}
+	if _, err := os.Stat(filepath.Join(env.root, "bar.txt")); !os.IsNotExist(err) {
+		t.Errorf("after undo, bar.txt exists (err = %v)", err)
+	}
+	out, err := env.gg(ctx, env.root, "oplog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("gg oplog = %q; want 3 lines", out)
+	}
+	if !strings.HasPrefix(lines[0], "3  ") || !strings.HasSuffix(lines[0], "gg undo -n 2  (undid 1, 2)") {
+		t.Errorf("gg oplog line 1 = %q; want undo entry", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "gg branch feature  (undone)") {
+		t.Errorf("gg oplog line 2 = %q; want undone branch entry", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "gg commit -m second  (undone)") {
+		t.Errorf("gg oplog line 3 = %q; want undone commit entry", lines[2])
+	}
+
+	// Redo both operations.
+	if _, err := env.gg(ctx, env.root, "redo"); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "HEAD"); err != nil {
+		t.Fatal(err)
+	} else if r.Commit() != h2.Commit() {
+		t.Errorf("after redo, HEAD = %v; want %v", r.Commit(), h2.Commit())
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "refs/heads/feature"); err != nil {
+		t.Error("after redo:", err)
+	} else if r.Commit() != h2.Commit() {
+		t.Errorf("after redo, feature = %v; want %v", r.Commit(), h2.Commit())
+	}
+	if _, err := os.Stat(filepath.Join(env.root, "bar.txt")); err != nil {
+		t.Error("after redo:", err)
+	}
+	if _, err := env.gg(ctx, env.root, "redo"); err == nil {
+		t.Error("second gg redo did not return an error")
+	}
+}
+
+func TestUndo_Dirty(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "branch", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(env.root, "foo.txt"), []byte("changed\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.gg(ctx, env.root, "undo"); err == nil {
+		t.Error("gg undo with a modified file did not return an error")
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "refs/heads/feature"); err != nil {
+		t.Error("after failed undo:", err)
+	} else if r.Commit() != h1 {
+		t.Errorf("after failed undo, feature = %v; want %v", r.Commit(), h1)
+	}
+}
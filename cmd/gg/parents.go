@@ -0,0 +1,130 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+const parentsSynopsis = "show the parents of the working directory or revision"
+
+func parents(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg parents [-r REV] [FILE]", parentsSynopsis+`
+
+	Print the working directory's parent revisions. If a revision is
+	given with `+"`-r`"+`, the parents of that revision are printed. If a
+	file is given, the revision in which the file was last changed (at
+	or before the working directory's parent or the revision given by
+	`+"`-r`"+`) is printed.`)
+	rev := f.String("r", "", "show parents of the specified `rev`ision")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 1 {
+		return usagef("can't pass more than one file")
+	}
+	var hashes []gitobj.Hash
+	switch {
+	case f.NArg() == 1:
+		target := *rev
+		if target == "" {
+			target = gitobj.Head.String()
+		}
+		r, err := parseRevArg(ctx, cc.git, target)
+		if err != nil {
+			return err
+		}
+		h, err := lastChange(ctx, cc.git, r, f.Arg(0))
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, h)
+	case *rev != "":
+		r, err := parseRevArg(ctx, cc.git, *rev)
+		if err != nil {
+			return err
+		}
+		hashes, err = commitParents(ctx, cc.git, r.Commit())
+		if err != nil {
+			return err
+		}
+	default:
+		r, err := gittool.ParseRev(ctx, cc.git, gitobj.Head.String())
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, r.Commit())
+		if merging, err := cc.git.Query(ctx, "cat-file", "-e", "MERGE_HEAD"); err == nil && merging {
+			mergeHead, err := gittool.ParseRev(ctx, cc.git, "MERGE_HEAD")
+			if err != nil {
+				return err
+			}
+			hashes = append(hashes, mergeHead.Commit())
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	logArgs := []string{"log", "--decorate=auto", "--no-walk=unsorted"}
+	for _, h := range hashes {
+		logArgs = append(logArgs, h.String())
+	}
+	logArgs = append(logArgs, "--")
+	return cc.git.RunInteractive(ctx, logArgs...)
+}
+
+// commitParents returns the parents of the given commit in order.
+func commitParents(ctx context.Context, git *gittool.Tool, commit gitobj.Hash) ([]gitobj.Hash, error) {
+	line, err := git.RunOneLiner(ctx, '\n', "log", "--max-count=1", "--pretty=tformat:%P", commit.String(), "--")
+	if err != nil {
+		return nil, fmt.Errorf("parents of %v: %v", commit, err)
+	}
+	var hashes []gitobj.Hash
+	for _, p := range strings.Fields(string(line)) {
+		h, err := gitobj.ParseHash(p)
+		if err != nil {
+			return nil, fmt.Errorf("parents of %v: %v", commit, err)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+// lastChange returns the most recent ancestor of rev (inclusive) that
+// changed the given file.
+func lastChange(ctx context.Context, git *gittool.Tool, rev *gittool.Rev, path string) (gitobj.Hash, error) {
+	topPath, err := findTreeFile(ctx, git, rev, path)
+	if err != nil {
+		return gitobj.Hash{}, err
+	}
+	line, err := git.RunOneLiner(ctx, '\n', "log", "--max-count=1", "--pretty=tformat:%H", rev.Commit().String(), "--", ":(top,literal)"+topPath)
+	if err != nil {
+		return gitobj.Hash{}, err
+	}
+	h, err := gitobj.ParseHash(string(line))
+	if err != nil {
+		return gitobj.Hash{}, fmt.Errorf("last change to %s: %v", path, err)
+	}
+	return h, nil
+}
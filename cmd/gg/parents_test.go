@@ -0,0 +1,110 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+func TestParents(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := dummyRev(ctx, env.git, env.root, "master", "baz.txt", "third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[gitobj.Hash]string{
+		first:  "first",
+		second: "second",
+		third:  "third",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    gitobj.Hash
+		notWant []gitobj.Hash
+	}{
+		{
+			name:    "WorkingCopy",
+			want:    third,
+			notWant: []gitobj.Hash{first, second},
+		},
+		{
+			name:    "Rev",
+			args:    []string{"-r", "HEAD"},
+			want:    second,
+			notWant: []gitobj.Hash{first, third},
+		},
+		{
+			name:    "File",
+			args:    []string{"bar.txt"},
+			want:    second,
+			notWant: []gitobj.Hash{first, third},
+		},
+		{
+			name:    "FileWithRev",
+			args:    []string{"-r", "HEAD~2", "foo.txt"},
+			want:    first,
+			notWant: []gitobj.Hash{second, third},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"parents"}, test.args...)
+			out, err := env.gg(ctx, env.root, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(out, []byte(test.want.String())) {
+				t.Errorf("output does not contain %s. Output:\n%s", prettyCommit(test.want, names), out)
+			}
+			for _, h := range test.notWant {
+				if bytes.Contains(out, []byte(h.String())) {
+					t.Errorf("output contains %s. Output:\n%s", prettyCommit(h, names), out)
+				}
+			}
+		})
+	}
+
+	t.Run("Root", func(t *testing.T) {
+		out, err := env.gg(ctx, env.root, "parents", "-r", first.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) > 0 {
+			t.Errorf("output = %q; want empty", out)
+		}
+	})
+}
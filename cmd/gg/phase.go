@@ -0,0 +1,228 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/revset"
+)
+
+const phaseSynopsis = "show the phase of revisions"
+
+func phase(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg phase [-r REV [...]]", phaseSynopsis+`
+
+	A revision is public if it is reachable from a remote-tracking
+	branch or from a ref matched by the whitespace-separated
+	`+"`gg.publicRefs`"+` git configuration setting (like
+	`+"`refs/heads/main refs/tags/`"+`). Other revisions are drafts.
+
+	Commands that rewrite history, like `+"`gg rebase`"+` and
+	`+"`gg commit --amend`"+`, refuse to rewrite public revisions unless
+	passed `+"`--force`"+`.`)
+	revs := f.MultiString("r", "show the phase of the specified `rev`isions (default is the working directory's parent)")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	if len(*revs) == 0 {
+		*revs = []string{gitobj.Head.String()}
+	}
+	var commits []gitobj.Hash
+	for _, r := range *revs {
+		if strings.HasPrefix(r, "-") {
+			return usagef("revisions must not start with '-'")
+		}
+		hashes, err := evalRevArg(ctx, cc.git, r)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, hashes...)
+	}
+	phases := &phaseReader{git: cc.git}
+	for _, c := range commits {
+		phases.revs = append(phases.revs, c.String())
+	}
+	for _, c := range commits {
+		p, err := phases.phase(ctx, c)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cc.stdout, "%s: %s\n", c.Short(), p)
+	}
+	return nil
+}
+
+// publicTips returns the commits pointed to by public refs.
+func publicTips(ctx context.Context, git *gittool.Tool) ([]gitobj.Hash, error) {
+	cfg, err := gittool.ReadConfig(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"for-each-ref", "--format=%(*objecttype) %(*objectname) %(objecttype) %(objectname)"}
+	args = append(args, revset.PublicRefs(cfg)...)
+	p, err := git.Start(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list public refs: %v", err)
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	var tips []gitobj.Hash
+	for s.Scan() {
+		// The peeled fields are empty unless the ref is an annotated tag,
+		// so the first two fields are always the object to use.
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 && len(fields) != 4 {
+			return nil, fmt.Errorf("list public refs: parse git for-each-ref: wrong number of fields")
+		}
+		if fields[0] != "commit" {
+			continue
+		}
+		h, err := gitobj.ParseHash(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("list public refs: parse git for-each-ref: %v", err)
+		}
+		tips = append(tips, h)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("list public refs: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("list public refs: %v", err)
+	}
+	return tips, nil
+}
+
+// findPublic returns the commits selected by the git rev-list
+// arguments that are public.
+func findPublic(ctx context.Context, git *gittool.Tool, revListArgs ...string) ([]gitobj.Hash, error) {
+	tips, err := publicTips(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	if len(tips) == 0 {
+		return nil, nil
+	}
+	all, err := revList(ctx, git, revListArgs...)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := excludeAncestors(ctx, git, tips, revListArgs...)
+	if err != nil {
+		return nil, err
+	}
+	isDraft := make(map[gitobj.Hash]bool, len(drafts))
+	for _, d := range drafts {
+		isDraft[d] = true
+	}
+	var public []gitobj.Hash
+	for _, c := range all {
+		if !isDraft[c] {
+			public = append(public, c)
+		}
+	}
+	return public, nil
+}
+
+// excludeAncestors runs git rev-list with the given arguments,
+// excluding any ancestors of the given commits. The commits are passed
+// on stdin, since there may be more than fit on a command line.
+func excludeAncestors(ctx context.Context, git *gittool.Tool, exclude []gitobj.Hash, revListArgs ...string) ([]gitobj.Hash, error) {
+	input := new(bytes.Buffer)
+	for _, h := range exclude {
+		fmt.Fprintf(input, "^%v\n", h)
+	}
+	return revListWithInput(ctx, git, input, append([]string{"--stdin"}, revListArgs...)...)
+}
+
+// checkRewrite returns an error if any of the commits selected by the
+// git rev-list arguments are public, unless force is true.
+func checkRewrite(ctx context.Context, git *gittool.Tool, force bool, revListArgs ...string) error {
+	if force {
+		return nil
+	}
+	public, err := findPublic(ctx, git, revListArgs...)
+	if err != nil {
+		return err
+	}
+	switch len(public) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("refusing to rewrite public revision %s (use --force to override)", public[0].Short())
+	default:
+		return fmt.Errorf("refusing to rewrite %d public revisions, including %s (use --force to override)", len(public), public[0].Short())
+	}
+}
+
+// phaseReader computes the phases of commits reachable from a list of
+// revisions. On first use, it lists the draft revisions among their
+// ancestors with a single git rev-list, so every other reachable commit
+// is public.
+type phaseReader struct {
+	git *gittool.Tool
+
+	// revs is the list of git revisions whose ancestors are read. If it
+	// is empty, HEAD is used.
+	revs []string
+
+	drafts map[gitobj.Hash]bool
+}
+
+// phase returns the phase of a commit, which must be reachable from
+// pr.revs.
+func (pr *phaseReader) phase(ctx context.Context, commit gitobj.Hash) (string, error) {
+	if pr.drafts == nil {
+		tips, err := publicTips(ctx, pr.git)
+		if err != nil {
+			return "", err
+		}
+		input := new(bytes.Buffer)
+		for _, r := range pr.revs {
+			fmt.Fprintln(input, r)
+		}
+		if len(pr.revs) == 0 {
+			fmt.Fprintln(input, gitobj.Head)
+		}
+		for _, h := range tips {
+			fmt.Fprintf(input, "^%v\n", h)
+		}
+		drafts, err := revListWithInput(ctx, pr.git, input, "--stdin")
+		if err != nil {
+			return "", fmt.Errorf("find draft revisions: %v", err)
+		}
+		pr.drafts = make(map[gitobj.Hash]bool, len(drafts))
+		for _, d := range drafts {
+			pr.drafts[d] = true
+		}
+	}
+	if pr.drafts[commit] {
+		return "draft", nil
+	}
+	return "public", nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestPhase(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "update-ref", "refs/remotes/origin/master", h1.String()); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := dummyRev(ctx, env.git, env.root, "feature", "baz.txt", "third")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "phase", "-r", "master~1", "-r", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := h1.Short() + ": public\n" + h2.Short() + ": draft\n"
+	if string(out) != want {
+		t.Errorf("gg phase -r master~1 -r master = %q; want %q", out, want)
+	}
+	out, err = env.gg(ctx, env.root, "phase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := h3.Short() + ": draft\n"; string(out) != want {
+		t.Errorf("gg phase = %q; want %q", out, want)
+	}
+
+	// Protect master.
+	if err := env.writeConfig([]byte("[gg]\n\tpublicRefs = refs/heads/master\n")); err != nil {
+		t.Fatal(err)
+	}
+	out, err = env.gg(ctx, env.root, "log", "-T", `{node|short} {phase}\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = h3.Short() + " draft\n" + h2.Short() + " public\n" + h1.Short() + " public\n"
+	if string(out) != want {
+		t.Errorf("gg log -T '{node|short} {phase}' = %q; want %q", out, want)
+	}
+}
+
+func TestRewritePublic(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "update-ref", "refs/remotes/origin/master", h2.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = env.gg(ctx, env.root, "commit", "--amend", "-m", "amended")
+	if err == nil || !strings.Contains(err.Error(), "public") {
+		t.Errorf("gg commit --amend of public revision error = %v; want refusal", err)
+	}
+	_, err = env.gg(ctx, env.root, "histedit", "HEAD~1")
+	if err == nil || !strings.Contains(err.Error(), "public") {
+		t.Errorf("gg histedit of public revision error = %v; want refusal", err)
+	}
+	_, err = env.gg(ctx, env.root, "rebase", "--base=HEAD~1", "--dst=HEAD~1")
+	if err == nil || !strings.Contains(err.Error(), "public") {
+		t.Errorf("gg rebase of public revision error = %v; want refusal", err)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "HEAD"); err != nil {
+		t.Fatal(err)
+	} else if r.Commit() != h2 {
+		t.Fatal("HEAD changed after refused rewrites")
+	}
+
+	if _, err := env.gg(ctx, env.root, "commit", "--amend", "--force", "-m", "amended"); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "HEAD"); err != nil {
+		t.Fatal(err)
+	} else if r.Commit() == h2 {
+		t.Error("HEAD did not change after gg commit --amend --force")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"zombiezen.com/go/gg/internal/flag"
 	"zombiezen.com/go/gg/internal/gitobj"
 	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/terminal"
 )
 
 const pullSynopsis = "pull changes from the specified source"
@@ -30,7 +31,8 @@ const pullSynopsis = "pull changes from the specified source"
 func pull(ctx context.Context, cc *cmdContext, args []string) error {
 	f := flag.NewFlagSet(true, "gg pull [-u] [-r REF] [SOURCE]", pullSynopsis+`
 
-	The fetched reference is written to FETCH_HEAD.
+	The fetched reference is written to FETCH_HEAD. SOURCE may be a URL,
+	the name of a remote, or a bundle file created by `+"`gg bundle`"+`.
 
 	If no source repository is given and a branch with a remote tracking
 	branch is currently checked out, then that remote is used. Otherwise,
@@ -89,8 +91,24 @@ func pull(ctx context.Context, cc *cmdContext, args []string) error {
 	if *tags {
 		gitArgs = append(gitArgs, "--tags")
 	}
+	if terminal.IsTerminal(cc.stderr) {
+		// gg inspects git's stderr, so git sees a pipe instead of the
+		// terminal.
+		gitArgs = append(gitArgs, "--progress")
+	}
 	gitArgs = append(gitArgs, "--", repo, remoteRef.String()+":")
-	return cc.git.Run(ctx, gitArgs...)
+	if err := cc.git.Run(ctx, gitArgs...); err != nil {
+		switch gittool.Cause(err) {
+		case gittool.ErrNonFastForward:
+			return fmt.Errorf("pulled %v, but it has diverged from the working copy; run `gg merge` or `gg rebase` to combine them", remoteRef)
+		case gittool.ErrAuth:
+			return fmt.Errorf("authentication to %s failed; check your credentials", repo)
+		case gittool.ErrRefNotFound:
+			return fmt.Errorf("%s does not have %v; use -r to pull a different ref", repo, remoteRef)
+		}
+		return err
+	}
+	return nil
 }
 
 func currentBranch(ctx context.Context, cc *cmdContext) string {
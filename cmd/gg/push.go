@@ -71,7 +71,7 @@ func push(ctx context.Context, cc *cmdContext, args []string) error {
 	if f.NArg() > 1 {
 		return usagef("can't pass multiple destinations")
 	}
-	src, err := gittool.ParseRev(ctx, cc.git, *rev)
+	src, err := parseRevArg(ctx, cc.git, *rev)
 	if err != nil {
 		return err
 	}
@@ -110,6 +110,12 @@ func push(ctx context.Context, cc *cmdContext, args []string) error {
 			return err
 		}
 	}
+	cc.hooks.setVar("GG_HOOK_REV", src.Commit().String())
+	cc.hooks.setVar("GG_HOOK_REMOTE", dstRepo)
+	cc.hooks.setVar("GG_HOOK_REF", dstRef.String())
+	if err := cc.hooks.runPre(ctx, cc); err != nil {
+		return err
+	}
 	var pushArgs []string
 	pushArgs = append(pushArgs, "push")
 	if *force {
@@ -158,7 +164,7 @@ func mail(ctx context.Context, cc *cmdContext, args []string) error {
 	if gopts.notify != "" && gopts.notify != "NONE" && gopts.notify != "OWNER" && gopts.notify != "OWNER_REVIEWERS" && gopts.notify != "ALL" {
 		return usagef(`--notify must be one of "none", "owner", "owner_reviewers", or "all"`)
 	}
-	src, err := gittool.ParseRev(ctx, cc.git, *rev)
+	src, err := parseRevArg(ctx, cc.git, *rev)
 	if err != nil {
 		return err
 	}
@@ -209,6 +215,12 @@ func mail(ctx context.Context, cc *cmdContext, args []string) error {
 		*dstBranch = strings.TrimPrefix(*dstBranch, "refs/for/")
 	}
 	ref := gerritPushRef(*dstBranch, gopts)
+	cc.hooks.setVar("GG_HOOK_REV", src.Commit().String())
+	cc.hooks.setVar("GG_HOOK_REMOTE", dstRepo)
+	cc.hooks.setVar("GG_HOOK_REF", ref.String())
+	if err := cc.hooks.runPre(ctx, cc); err != nil {
+		return err
+	}
 	return cc.git.RunInteractive(ctx, "push", "--", dstRepo, src.Commit().String()+":"+ref.String())
 }
 
@@ -308,10 +320,13 @@ func verifyPushRemoteRef(ctx context.Context, git *gittool.Tool, remote string,
 	refBytes := []byte(ref)
 	s := bufio.NewScanner(p)
 	for s.Scan() {
-		const tabLoc = 40
 		line := s.Bytes()
-		if tabLoc >= len(line) || line[tabLoc] != '\t' || !isHex(line[:tabLoc]) {
-			return errors.New("parse git ls-remote: line must start with SHA1")
+		tabLoc := bytes.IndexByte(line, '\t')
+		if tabLoc == -1 {
+			return errors.New("parse git ls-remote: line must start with object hash")
+		}
+		if _, err := gitobj.ParseHash(string(line[:tabLoc])); err != nil {
+			return fmt.Errorf("parse git ls-remote: %v", err)
 		}
 		remoteRef := line[tabLoc+1:]
 		if bytes.Equal(remoteRef, refBytes) {
@@ -52,6 +52,50 @@ func TestPush(t *testing.T) {
 	}
 }
 
+func TestPush_SHA256(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	repoA := filepath.Join(env.root, "repoA")
+	if err := env.git.Run(ctx, "init", "--object-format=sha256", repoA); err != nil {
+		t.Skip("git does not support SHA-256 repositories:", err)
+	}
+	repoB := filepath.Join(env.root, "repoB")
+	if err := env.git.Run(ctx, "init", "--bare", "--object-format=sha256", repoB); err != nil {
+		t.Fatal(err)
+	}
+	gitA := env.git.WithDir(repoA)
+	if _, err := dummyRev(ctx, gitA, repoA, "master", "foo.txt", "initial commit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Run(ctx, "remote", "add", "origin", repoB); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitA.Run(ctx, "push", "--set-upstream", "origin", "master"); err != nil {
+		t.Fatal(err)
+	}
+	commit2, err := dummyRev(ctx, gitA, repoA, "master", "bar.txt", "second commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit2.Format() != gitobj.SHA256 {
+		t.Fatalf("commit hash %v is not SHA-256", commit2)
+	}
+
+	if _, err := env.gg(ctx, repoA, "push"); err != nil {
+		t.Fatal(err)
+	}
+	gitB := env.git.WithDir(repoB)
+	if r, err := gittool.ParseRev(ctx, gitB, "refs/heads/master"); err != nil {
+		t.Error(err)
+	} else if r.Commit() != commit2 {
+		t.Errorf("refs/heads/master = %v; want %v", r.Commit(), commit2)
+	}
+}
+
 func TestPush_Arg(t *testing.T) {
 	ctx := context.Background()
 	env, err := newTestEnv(ctx, t)
@@ -35,12 +35,16 @@ func rebase(ctx context.Context, cc *cmdContext, args []string) error {
 	revision and set the current branch to the final revision.
 
 	If neither `+"`--src`"+` or `+"`--base`"+` is specified, it acts as if
-	`+"`--base=@{upstream}`"+` was specified.`)
+	`+"`--base=@{upstream}`"+` was specified.
+
+	Public revisions (see `+"`gg help phase`"+`) will not be rebased unless
+	`+"`--force`"+` is given.`)
 	base := f.String("base", "", "rebase everything from branching point of specified `rev`ision")
 	dst := f.String("dst", "@{upstream}", "rebase onto the specified `rev`ision")
 	src := f.String("src", "", "rebase the specified `rev`ision and descendants")
 	abort := f.Bool("abort", false, "abort an interrupted rebase")
 	continue_ := f.Bool("continue", false, "continue an interrupted rebase")
+	force := f.Bool("force", false, "allow rebasing public revisions")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
 		return nil
@@ -57,16 +61,33 @@ func rebase(ctx context.Context, cc *cmdContext, args []string) error {
 		return usagef("can't specify other options with --abort or --continue")
 	}
 	if *abort {
-		return cc.git.RunInteractive(ctx, "rebase", "--abort")
+		if err := cc.git.RunInteractive(ctx, "rebase", "--abort"); err != nil {
+			return err
+		}
+		return abortRewrite(ctx, cc.git)
 	}
 	if *continue_ {
 		return continueRebase(ctx, cc.git)
 	}
+	for _, r := range []*string{base, dst, src} {
+		if *r == "" {
+			continue
+		}
+		var err error
+		*r, err = revArgString(ctx, cc.git, *r)
+		if err != nil {
+			return err
+		}
+	}
 	switch {
 	case *base != "" && *src != "":
 		return usagef("can't specify both -s and -b")
 	case *base != "":
-		return cc.git.RunInteractive(ctx, "rebase", "--onto="+*dst, "--no-fork-point", "--", *base)
+		if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "^"+*base); err != nil {
+			return err
+		}
+		return runRewrite(ctx, cc.git, "rebase", *dst, []string{gitobj.Head.String(), "^" + *base},
+			"rebase", "--onto="+*dst, "--no-fork-point", "--", *base)
 	case *src != "":
 		if strings.HasPrefix(*src, "-") {
 			return fmt.Errorf("revision cannot start with '-'")
@@ -77,7 +98,11 @@ func rebase(ctx context.Context, cc *cmdContext, args []string) error {
 		}
 		if ancestor {
 			// Simple case: this is an ancestor revision.
-			return cc.git.RunInteractive(ctx, "rebase", "--onto="+*dst, "--no-fork-point", "--", *src+"~")
+			if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "^"+*src+"~"); err != nil {
+				return err
+			}
+			return runRewrite(ctx, cc.git, "rebase", *dst, []string{gitobj.Head.String(), "^" + *src + "~"},
+				"rebase", "--onto="+*dst, "--no-fork-point", "--", *src+"~")
 		}
 
 		// More complicated: this is on an unrelated branch.
@@ -94,10 +119,13 @@ func rebase(ctx context.Context, cc *cmdContext, args []string) error {
 		if len(descend) > 1 {
 			return fmt.Errorf("%s is in multiple branches", *src)
 		}
+		if err := checkRewrite(ctx, cc.git, *force, descend[0].String(), "^"+*src+"~"); err != nil {
+			return err
+		}
 		editorCmd := fmt.Sprintf(
 			"%s log --reverse --first-parent --pretty='tformat:pick %%H' %s~..%s >",
 			shellEscape(cc.git.Path()), shellEscape(*src), shellEscape(descend[0].String()))
-		return cc.git.RunInteractive(ctx,
+		return runRewrite(ctx, cc.git, "rebase", *dst, []string{descend[0].String(), "^" + *src + "~"},
 			"-c", "sequence.editor="+editorCmd,
 			"rebase",
 			"-i",
@@ -105,7 +133,11 @@ func rebase(ctx context.Context, cc *cmdContext, args []string) error {
 			"--no-fork-point",
 			gitobj.Head.String())
 	default:
-		return cc.git.RunInteractive(ctx, "rebase", "--onto="+*dst, "--no-fork-point")
+		if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "^@{upstream}"); err != nil {
+			return err
+		}
+		return runRewrite(ctx, cc.git, "rebase", *dst, []string{gitobj.Head.String(), "^@{upstream}"},
+			"rebase", "--onto="+*dst, "--no-fork-point")
 	}
 }
 
@@ -121,10 +153,14 @@ func histedit(ctx context.Context, cc *cmdContext, args []string) error {
 
 	Unlike `+"`git rebase -i`"+`, continuing a `+"`histedit`"+` will automatically
 	amend the current commit if any changes are made. In most cases,
-	you do not need to run `+"`commit --amend`"+` yourself.`)
+	you do not need to run `+"`commit --amend`"+` yourself.
+
+	Public revisions (see `+"`gg help phase`"+`) will not be edited unless
+	`+"`--force`"+` is given.`)
 	abort := f.Bool("abort", false, "abort an edit already in progress")
 	continue_ := f.Bool("continue", false, "continue an edit already in progress")
 	editPlan := f.Bool("edit-plan", false, "edit remaining actions list")
+	force := f.Bool("force", false, "allow editing public revisions")
 	exec := f.MultiString("exec", "execute the shell `command` after each line creating a commit (can be specified multiple times)")
 	if err := f.Parse(args); flag.IsHelp(err) {
 		f.Help(cc.stdout)
@@ -152,17 +188,23 @@ func histedit(ctx context.Context, cc *cmdContext, args []string) error {
 		if err != nil {
 			return fmt.Errorf("parse merge base: %v", err)
 		}
+		if err := checkRewrite(ctx, cc.git, *force, gitobj.Head.String(), "^"+mergeBase.String()); err != nil {
+			return err
+		}
 		rebaseArgs := []string{"rebase", "-i", "--onto=" + mergeBase.String(), "--no-fork-point"}
 		for _, cmd := range *exec {
 			rebaseArgs = append(rebaseArgs, "--exec="+cmd)
 		}
 		rebaseArgs = append(rebaseArgs, "--", mergeBase.String())
-		return cc.git.RunInteractive(ctx, rebaseArgs...)
+		return runRewrite(ctx, cc.git, "histedit", mergeBase.String(), []string{gitobj.Head.String(), "^" + mergeBase.String()}, rebaseArgs...)
 	case *abort && !*continue_ && !*editPlan:
 		if f.NArg() != 0 {
 			return usagef("can't pass arguments with --abort")
 		}
-		return cc.git.RunInteractive(ctx, "rebase", "--abort")
+		if err := cc.git.RunInteractive(ctx, "rebase", "--abort"); err != nil {
+			return err
+		}
+		return abortRewrite(ctx, cc.git)
 	case !*abort && *continue_ && !*editPlan:
 		if f.NArg() != 0 {
 			return usagef("can't pass arguments with --continue")
@@ -193,7 +235,10 @@ func continueRebase(ctx context.Context, git *gittool.Tool) error {
 			return err
 		}
 	}
-	return git.RunInteractive(ctx, "rebase", "--continue")
+	if err := git.RunInteractive(ctx, append(rewriteConfig, "rebase", "--continue")...); err != nil {
+		return err
+	}
+	return finishRewrite(ctx, git)
 }
 
 // findDescendants returns the set of distinct heads under refs/heads/
@@ -0,0 +1,345 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+const recoverSynopsis = "find and restore lost revisions"
+
+func recoverCommits(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg recover [-r REV [--branch NAME]]", recoverSynopsis+`
+
+	Without arguments, recover lists revisions that are no longer
+	reachable from any branch, tag, or remote-tracking branch. These are
+	found in the reflogs of HEAD and the local branches and among the
+	repository's dangling commits. Only the most recent revision of each
+	lost line of history is shown, along with the operation that
+	orphaned it, if known.
+
+	With `+"`-r`"+`, recover creates a branch pointing to the given revision.
+	The branch is named `+"`recovered-HASH`"+` unless `+"`--branch`"+` is given.`)
+	rev := f.String("r", "", "`rev`ision to restore")
+	branchName := f.String("branch", "", "`name` of the branch to create")
+	f.Alias("branch", "b")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	if *rev == "" {
+		if *branchName != "" {
+			return usagef("--branch requires -r")
+		}
+		return listLost(ctx, cc)
+	}
+	r, err := gittool.ParseRev(ctx, cc.git, *rev)
+	if err != nil {
+		return err
+	}
+	name := *branchName
+	if name == "" {
+		name = "recovered-" + r.Commit().Short()
+	}
+	ref := gitobj.BranchRef(name)
+	if !ref.IsValid() {
+		return fmt.Errorf("invalid branch name %q", name)
+	}
+	if exists, err := cc.git.Query(ctx, "rev-parse", "-q", "--verify", ref.String()); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("branch %s already exists", name)
+	}
+	if err := cc.git.Run(ctx, "update-ref", "-m", "gg recover", ref.String(), r.Commit().String(), ""); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(cc.stdout, "recovered %s as branch %s\n", r.Commit().Short(), name)
+	return err
+}
+
+// A lostCommit is a commit that is no longer reachable from any ref.
+type lostCommit struct {
+	commit gitobj.Hash
+	cause  string // description of what orphaned the commit, if known
+}
+
+func listLost(ctx context.Context, cc *cmdContext) error {
+	lost, err := findLost(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	commits := make([]gitobj.Hash, len(lost))
+	for i, l := range lost {
+		commits[i] = l.commit
+	}
+	kws, err := commitKeywordsFor(ctx, cc.git, commits)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(lost, func(i, j int) bool {
+		di := kws[lost[i].commit]["commitdate"].(time.Time)
+		dj := kws[lost[j].commit]["commitdate"].(time.Time)
+		return di.After(dj)
+	})
+	for _, l := range lost {
+		kw := kws[l.commit]
+		desc := kw["desc"].(string)
+		if i := strings.IndexByte(desc, '\n'); i != -1 {
+			desc = desc[:i]
+		}
+		fmt.Fprintf(cc.stdout, "%s  %s  %s\n", l.commit.Short(), kw["commitdate"].(time.Time).Format("2006-01-02 15:04 -0700"), desc)
+		if l.cause != "" {
+			fmt.Fprintf(cc.stdout, "    orphaned by %s\n", l.cause)
+		}
+	}
+	return nil
+}
+
+// findLost returns the tips of the lines of history that are not
+// reachable from any ref.
+func findLost(ctx context.Context, git *gittool.Tool) ([]lostCommit, error) {
+	causes := make(map[gitobj.Hash]string)
+	var candidates []gitobj.Hash
+	addCandidate := func(h gitobj.Hash, cause string) {
+		if _, seen := causes[h]; seen {
+			return
+		}
+		causes[h] = cause
+		candidates = append(candidates, h)
+	}
+
+	// Commits in the reflogs. The cause is the subject of the next
+	// entry, which moved the ref away from the commit.
+	refs := []string{gitobj.Head.String()}
+	branches, err := listBranches(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		refs = append(refs, b.name.String())
+	}
+	for _, ref := range refs {
+		entries, err := readReflog(ctx, git, ref)
+		if err != nil {
+			return nil, err
+		}
+		for i, e := range entries {
+			cause := ""
+			if i > 0 {
+				cause = entries[i-1].subject
+			}
+			addCandidate(e.commit, cause)
+		}
+	}
+	dangling, err := danglingCommits(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range dangling {
+		addCandidate(h, "")
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// Find the candidates' history that isn't reachable from a ref.
+	// HEAD is excluded too, since it may be detached. The candidates
+	// are passed on stdin, since a long reflog can have more entries
+	// than fit on a command line.
+	input := new(bytes.Buffer)
+	for _, h := range candidates {
+		input.WriteString(h.String())
+		input.WriteByte('\n')
+	}
+	p, err := git.StartWithInput(ctx, input, "rev-list", "--parents", "--stdin", "--not", "--branches", "--tags", "--remotes", gitobj.Head.String())
+	if err != nil {
+		return nil, fmt.Errorf("find lost revisions: %v", err)
+	}
+	defer p.Wait()
+	unreachable := make(map[gitobj.Hash]bool)
+	hasChild := make(map[gitobj.Hash]bool)
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		for i, field := range fields {
+			h, err := gitobj.ParseHash(field)
+			if err != nil {
+				return nil, fmt.Errorf("find lost revisions: parse git rev-list: %v", err)
+			}
+			if i == 0 {
+				unreachable[h] = true
+			} else {
+				hasChild[h] = true
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("find lost revisions: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("find lost revisions: %v", err)
+	}
+
+	opCauses, err := oplogCauses(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	var lost []lostCommit
+	for _, h := range candidates {
+		if !unreachable[h] || hasChild[h] {
+			continue
+		}
+		cause := causes[h]
+		if op := opCauses[h]; op != "" {
+			cause = op
+		}
+		lost = append(lost, lostCommit{commit: h, cause: cause})
+	}
+	return lost, nil
+}
+
+type reflogEntry struct {
+	commit  gitobj.Hash
+	subject string
+}
+
+// readReflog returns the entries in a ref's reflog, newest first.
+func readReflog(ctx context.Context, git *gittool.Tool, ref string) ([]reflogEntry, error) {
+	if exists, err := git.Query(ctx, "rev-parse", "-q", "--verify", ref); err != nil {
+		return nil, fmt.Errorf("read reflog for %s: %v", ref, err)
+	} else if !exists {
+		return nil, nil
+	}
+	p, err := git.Start(ctx, "log", "--walk-reflogs", "--pretty=tformat:%H %gs", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("read reflog for %s: %v", ref, err)
+	}
+	defer p.Wait()
+	var entries []reflogEntry
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		line := s.Text()
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			i = len(line)
+		}
+		h, err := gitobj.ParseHash(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("read reflog for %s: %v", ref, err)
+		}
+		e := reflogEntry{commit: h}
+		if i < len(line) {
+			e.subject = line[i+1:]
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read reflog for %s: %v", ref, err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("read reflog for %s: %v", ref, err)
+	}
+	return entries, nil
+}
+
+// danglingCommits returns the commits that git fsck reports as
+// dangling.
+func danglingCommits(ctx context.Context, git *gittool.Tool) ([]gitobj.Hash, error) {
+	p, err := git.Start(ctx, "fsck", "--no-progress", "--dangling", "--connectivity-only")
+	if err != nil {
+		return nil, fmt.Errorf("find dangling commits: %v", err)
+	}
+	defer p.Wait()
+	var commits []gitobj.Hash
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		const prefix = "dangling commit "
+		line := s.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		h, err := gitobj.ParseHash(strings.TrimSpace(line[len(prefix):]))
+		if err != nil {
+			return nil, fmt.Errorf("find dangling commits: parse git fsck: %v", err)
+		}
+		commits = append(commits, h)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("find dangling commits: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("find dangling commits: %v", err)
+	}
+	return commits, nil
+}
+
+// oplogCauses returns the command line of the most recent operation
+// in the operation log that moved a ref away from each commit.
+func oplogCauses(ctx context.Context, git *gittool.Tool) (map[gitobj.Hash]string, error) {
+	entries, err := readOplog(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	causes := make(map[gitobj.Hash]string)
+	for _, e := range entries {
+		if e.Before == nil || e.After == nil {
+			continue
+		}
+		after := make(map[gitobj.Hash]bool)
+		for _, h := range e.After.Refs {
+			after[h] = true
+		}
+		if h, ok := e.After.headCommit(); ok {
+			after[h] = true
+		}
+		before := make([]gitobj.Hash, 0, len(e.Before.Refs)+1)
+		for _, h := range e.Before.Refs {
+			before = append(before, h)
+		}
+		if h, ok := e.Before.headCommit(); ok {
+			before = append(before, h)
+		}
+		quoted := make([]string, len(e.Args))
+		for i, a := range e.Args {
+			quoted[i] = shellEscape(a)
+		}
+		desc := "gg " + strings.Join(quoted, " ")
+		for _, h := range before {
+			if !after[h] {
+				// Later operations overwrite earlier ones.
+				causes[h] = desc
+			}
+		}
+	}
+	return causes, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "lost feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "branch", "-D", "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "recover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], h2.Short()+"  ") || !strings.HasSuffix(lines[0], "  lost feature") || lines[1] != "    orphaned by checkout: moving from feature to master" {
+		t.Errorf("gg recover output:\n%s\nwant %s with summary and checkout cause", out, h2.Short())
+	}
+
+	out, err = env.gg(ctx, env.root, "recover", "-r", h2.String(), "--branch", "restored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "recovered " + h2.Short() + " as branch restored\n"; string(out) != want {
+		t.Errorf("gg recover -r output = %q; want %q", out, want)
+	}
+	if r, err := gittool.ParseRev(ctx, env.git, "refs/heads/restored"); err != nil {
+		t.Error(err)
+	} else if r.Commit() != h2 {
+		t.Errorf("refs/heads/restored = %v; want %v", r.Commit(), h2)
+	}
+	out, err = env.gg(ctx, env.root, "recover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 0 {
+		t.Errorf("gg recover after restoring = %q; want empty", out)
+	}
+	if _, err := env.gg(ctx, env.root, "recover", "-r", h2.String(), "--branch", "restored"); err == nil {
+		t.Error("gg recover onto existing branch did not return an error")
+	}
+}
+
+func TestRecover_Oplog(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "commit", "--amend", "-m", "amended"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "recover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], h2.Short()+"  ") || lines[1] != "    orphaned by gg commit --amend -m amended" {
+		t.Errorf("gg recover output:\n%s\nwant %s orphaned by gg commit --amend", out, h2.Short())
+	}
+}
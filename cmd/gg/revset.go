@@ -0,0 +1,130 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/revset"
+)
+
+// parseRevset parses a revision flag argument as a revset. It returns
+// nil if the argument is a plain git revision, which should be passed
+// to git unmodified.
+func parseRevset(ctx context.Context, git *gittool.Tool, arg string) (*revset.Expr, error) {
+	if strings.HasPrefix(arg, "-") || !hasRevsetSyntax(arg) {
+		return nil, nil
+	}
+	if ok, _ := git.Query(ctx, "rev-parse", "-q", "--verify", arg); ok {
+		// Even if it parses as a revset, the git interpretation wins.
+		return nil, nil
+	}
+	expr, err := revset.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if _, isSymbol := expr.Symbol(); isSymbol {
+		return nil, nil
+	}
+	return expr, nil
+}
+
+// hasRevsetSyntax reports whether arg contains any of the operators,
+// parentheses, or quotes that distinguish a revset from a single git
+// revision.
+func hasRevsetSyntax(arg string) bool {
+	return strings.ContainsAny(arg, "()&|'\" \t\n\r") || strings.Contains(arg, "::")
+}
+
+// evalRevArg evaluates a revision flag argument. A plain git revision
+// selects a single commit or, if it is a range like "A..B", the
+// commits in the range.
+func evalRevArg(ctx context.Context, git *gittool.Tool, arg string) ([]gitobj.Hash, error) {
+	expr, err := parseRevset(ctx, git, arg)
+	if err != nil {
+		return nil, err
+	}
+	return evalParsedRevArg(ctx, git, arg, expr)
+}
+
+// evalParsedRevArg is like evalRevArg, but takes the result of calling
+// parseRevset on arg.
+func evalParsedRevArg(ctx context.Context, git *gittool.Tool, arg string, expr *revset.Expr) ([]gitobj.Hash, error) {
+	if expr != nil {
+		return expr.Eval(ctx, git)
+	}
+	if strings.Contains(arg, "..") {
+		return revList(ctx, git, arg, "--")
+	}
+	rev, err := gittool.ParseRev(ctx, git, arg)
+	if err != nil {
+		return nil, err
+	}
+	return []gitobj.Hash{rev.Commit()}, nil
+}
+
+// parseRevArg resolves a revision flag argument that must name exactly
+// one commit.
+func parseRevArg(ctx context.Context, git *gittool.Tool, arg string) (*gittool.Rev, error) {
+	expr, err := parseRevset(ctx, git, arg)
+	if err != nil {
+		return nil, err
+	}
+	if expr == nil {
+		return gittool.ParseRev(ctx, git, arg)
+	}
+	h, err := evalSingleRevset(ctx, git, expr)
+	if err != nil {
+		return nil, err
+	}
+	return gittool.ParseRev(ctx, git, h.String())
+}
+
+// revArgString resolves a revision flag argument that must name exactly
+// one commit to a string suitable for passing to git. Plain git
+// revisions are returned unmodified.
+func revArgString(ctx context.Context, git *gittool.Tool, arg string) (string, error) {
+	expr, err := parseRevset(ctx, git, arg)
+	if err != nil {
+		return "", err
+	}
+	if expr == nil {
+		return arg, nil
+	}
+	h, err := evalSingleRevset(ctx, git, expr)
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+func evalSingleRevset(ctx context.Context, git *gittool.Tool, expr *revset.Expr) (gitobj.Hash, error) {
+	hashes, err := expr.Eval(ctx, git)
+	if err != nil {
+		return gitobj.Hash{}, err
+	}
+	switch len(hashes) {
+	case 0:
+		return gitobj.Hash{}, fmt.Errorf("revset %v does not match any revisions", expr)
+	case 1:
+		return hashes[0], nil
+	default:
+		return gitobj.Hash{}, fmt.Errorf("revset %v matches %d revisions; must match exactly one", expr, len(hashes))
+	}
+}
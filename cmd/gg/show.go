@@ -0,0 +1,176 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+const showSynopsis = "show a revision's metadata and changes"
+
+func show(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg show [options] [REV]", showSynopsis+`
+
+	Print the given revision (HEAD by default) along with its parents,
+	author, committer, full commit message, and Gerrit change ID
+	(if any), followed by the changes it introduced.`)
+	opts := new(diffOptions)
+	f.BoolVar(&opts.ignoreSpaceChange, "b", false, "ignore changes in amount of whitespace")
+	f.Alias("b", "ignore-space-change")
+	f.BoolVar(&opts.ignoreBlankLines, "B", false, "ignore changes whose lines are all blank")
+	f.Alias("B", "ignore-blank-lines")
+	nameOnly := f.Bool("name-only", false, "show only names of changed files")
+	f.IntVar(&opts.ncontext, "U", 3, "number of lines of context to show")
+	stat := f.Bool("stat", false, "output diffstat-style summary of changes")
+	f.BoolVar(&opts.ignoreAllSpace, "w", false, "ignore whitespace when comparing lines")
+	f.Alias("w", "ignore-all-space")
+	f.BoolVar(&opts.ignoreSpaceAtEOL, "Z", false, "ignore changes in whitespace at EOL")
+	f.Alias("Z", "ignore-space-at-eol")
+	f.StringVar(&opts.renames, "M", "50%", "report new files with the set `percent`age of similarity to a removed file as renamed")
+	f.StringVar(&opts.copies, "C", "50%", "report new files with the set `percent`age of similarity as copied")
+	f.BoolVar(&opts.copiesUnmodified, "copies-unmodified", true, "whether to check unmodified files when detecting copies (can be expensive)")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 1 {
+		return usagef("can only pass one revision")
+	}
+	if *stat && *nameOnly {
+		return usagef("can't pass both --stat and --name-only")
+	}
+	revArg := f.Arg(0)
+	if revArg == "" {
+		revArg = gitobj.Head.String()
+	}
+	rev, err := gittool.ParseRev(ctx, cc.git, revArg)
+	if err != nil {
+		return err
+	}
+	info, err := readCommitInfo(ctx, cc.git, rev.Commit())
+	if err != nil {
+		return err
+	}
+	// Passing the header as the format string lets git handle paging
+	// and separate the header from the changes.
+	header := strings.Replace(string(info.format()), "%", "%%", -1)
+	showArgs := []string{"show", "--pretty=format:" + header}
+	switch {
+	case *stat:
+		showArgs = append(showArgs, "--stat")
+	case *nameOnly:
+		showArgs = append(showArgs, "--name-only")
+	}
+	showArgs = opts.appendArgs(showArgs, !*stat && !*nameOnly)
+	showArgs = append(showArgs, rev.Commit().String(), "--")
+	return cc.git.RunInteractive(ctx, showArgs...)
+}
+
+// commitInfo is the metadata of a single commit.
+type commitInfo struct {
+	hash        gitobj.Hash
+	parents     []gitobj.Hash
+	decorations string
+	author      string
+	authorDate  string
+	committer   string
+	commitDate  string
+	message     string
+}
+
+// readCommitInfo reads the metadata for the given commit.
+func readCommitInfo(ctx context.Context, git *gittool.Tool, commit gitobj.Hash) (*commitInfo, error) {
+	p, err := git.Start(ctx, "log", "--max-count=1", "--pretty=format:%H%x00%P%x00%D%x00%an <%ae>%x00%ad%x00%cn <%ce>%x00%cd%x00%B", commit.String(), "--")
+	if err != nil {
+		return nil, fmt.Errorf("read commit %v: %v", commit, err)
+	}
+	out, readErr := ioutil.ReadAll(p)
+	waitErr := p.Wait()
+	if readErr != nil {
+		return nil, fmt.Errorf("read commit %v: %v", commit, readErr)
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("read commit %v: %v", commit, waitErr)
+	}
+	fields := bytes.SplitN(out, []byte{0}, 8)
+	if len(fields) != 8 {
+		return nil, fmt.Errorf("read commit %v: parse log: unexpected EOF", commit)
+	}
+	info := &commitInfo{
+		decorations: string(fields[2]),
+		author:      string(fields[3]),
+		authorDate:  string(fields[4]),
+		committer:   string(fields[5]),
+		commitDate:  string(fields[6]),
+		message:     string(fields[7]),
+	}
+	info.hash, err = gitobj.ParseHash(string(fields[0]))
+	if err != nil {
+		return nil, fmt.Errorf("read commit %v: parse log: %v", commit, err)
+	}
+	for _, p := range strings.Fields(string(fields[1])) {
+		h, err := gitobj.ParseHash(p)
+		if err != nil {
+			return nil, fmt.Errorf("read commit %v: parse log: %v", commit, err)
+		}
+		info.parents = append(info.parents, h)
+	}
+	return info, nil
+}
+
+// format returns the header printed by show, ending in a newline.
+func (info *commitInfo) format() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("commit ")
+	buf.WriteString(info.hash.String())
+	if info.decorations != "" {
+		buf.WriteString(" (")
+		buf.WriteString(info.decorations)
+		buf.WriteString(")")
+	}
+	buf.WriteByte('\n')
+	for _, p := range info.parents {
+		fmt.Fprintf(buf, "Parent:     %v\n", p)
+	}
+	fmt.Fprintf(buf, "Author:     %s\n", info.author)
+	fmt.Fprintf(buf, "AuthorDate: %s\n", info.authorDate)
+	fmt.Fprintf(buf, "Commit:     %s\n", info.committer)
+	fmt.Fprintf(buf, "CommitDate: %s\n", info.commitDate)
+	if id := findChangeID([]byte(info.message)); id != "" {
+		fmt.Fprintf(buf, "Change-Id:  %s\n", id)
+	}
+	buf.WriteByte('\n')
+	msg := strings.TrimRight(info.message, "\n")
+	for _, line := range strings.Split(msg, "\n") {
+		if line == "" {
+			buf.WriteByte('\n')
+			continue
+		}
+		buf.WriteString("    ")
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestShow(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(env.root, "foo.txt"), []byte("dummy  content"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const msg = "Add more space\n\nChange-Id: I0123456789abcdef0123456789abcdef01234567\n"
+	if err := env.git.Run(ctx, "commit", "-a", "-m", msg); err != nil {
+		t.Fatal(err)
+	}
+	second, err := gittool.ParseRev(ctx, env.git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Patch", func(t *testing.T) {
+		out, err := env.gg(ctx, env.root, "show")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"commit " + second.Commit().String(),
+			"Parent:     " + first.String(),
+			"Author:     User <foo@example.com>",
+			"Change-Id:  I0123456789abcdef0123456789abcdef01234567\n",
+			"    Add more space\n",
+			"+dummy  content",
+		} {
+			if !bytes.Contains(out, []byte(want)) {
+				t.Errorf("output does not contain %q. Output:\n%s", want, out)
+			}
+		}
+	})
+	t.Run("IgnoreAllSpace", func(t *testing.T) {
+		out, err := env.gg(ctx, env.root, "show", "-w", "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(out, []byte("    Add more space\n")) {
+			t.Errorf("output does not contain message. Output:\n%s", out)
+		}
+		if bytes.Contains(out, []byte("+dummy")) {
+			t.Errorf("output contains whitespace change. Output:\n%s", out)
+		}
+	})
+	t.Run("Stat", func(t *testing.T) {
+		out, err := env.gg(ctx, env.root, "show", "--stat", first.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(out, []byte("commit "+first.String())) {
+			t.Errorf("output does not contain commit hash. Output:\n%s", out)
+		}
+		if bytes.Contains(out, []byte("Parent:")) {
+			t.Errorf("output contains parent for root commit. Output:\n%s", out)
+		}
+		if !bytes.Contains(out, []byte("1 file changed")) {
+			t.Errorf("output does not contain diffstat. Output:\n%s", out)
+		}
+	})
+	t.Run("NameOnly", func(t *testing.T) {
+		out, err := env.gg(ctx, env.root, "show", "--name-only")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(out, []byte("\n\nfoo.txt\n")) {
+			t.Errorf("output does not end with file name. Output:\n%s", out)
+		}
+	})
+}
@@ -0,0 +1,491 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/template"
+)
+
+const smartlogSynopsis = "show revisions being worked on"
+
+func smartlog(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg smartlog", smartlogSynopsis+`
+
+aliases: sl
+
+	Show a graph of the local branches that have not been merged into
+	their upstreams, their ancestors back to where they diverged from
+	their upstreams, and the upstream branches themselves. Branches
+	without an upstream are shown back to where they diverged from
+	published history or, if nothing has been published, from the other
+	local branches. The working copy's parent is marked with `+"`@`"+`. Stretches of published history
+	between the revisions shown are collapsed into a `+"`:`"+` line.
+
+	Each unpublished revision is annotated with its Gerrit change ID,
+	if any, and the number of revisions it is ahead of and behind its
+	branch's upstream.`)
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	g, err := buildSmartlog(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	return g.render(cc.stdout)
+}
+
+// smartlogGraph is the subset of the commit graph shown by smartlog.
+type smartlogGraph struct {
+	head  gitobj.Hash
+	nodes map[gitobj.Hash]*smartlogNode
+	order []*smartlogNode
+}
+
+type smartlogNode struct {
+	commit   gitobj.Hash
+	kw       template.Keywords
+	draft    bool
+	parent   *smartlogNode
+	elided   bool // whether revisions between the node and its parent are hidden
+	children []*smartlogNode
+
+	// Upstream comparison. Only set for drafts of branches with an upstream.
+	hasUpstream   bool
+	upstream      gitobj.Hash
+	ahead, behind int
+}
+
+func (g *smartlogGraph) add(commit gitobj.Hash, draft bool) *smartlogNode {
+	if n := g.nodes[commit]; n != nil {
+		return n
+	}
+	n := &smartlogNode{commit: commit, draft: draft}
+	g.nodes[commit] = n
+	g.order = append(g.order, n)
+	return n
+}
+
+func buildSmartlog(ctx context.Context, git *gittool.Tool) (*smartlogGraph, error) {
+	g := &smartlogGraph{
+		nodes: make(map[gitobj.Hash]*smartlogNode),
+	}
+	if head, err := gittool.ParseRev(ctx, git, gitobj.Head.String()); err == nil {
+		g.head = head.Commit()
+	} else if exists, qerr := git.Query(ctx, "rev-parse", "--verify", "--quiet", gitobj.Head.String()); qerr != nil {
+		return nil, qerr
+	} else if exists {
+		return nil, err
+	}
+	// Otherwise, HEAD is a branch with no commits yet and the graph
+	// only contains the other branches, if any.
+	branches, err := listBranches(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+	public, err := publicTips(ctx, git)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find draft revisions and upstream tips.
+	for _, b := range branches {
+		up, err := gittool.ParseRev(ctx, git, b.name.Branch()+"@{upstream}")
+		var drafts []gitobj.Hash
+		if err == nil {
+			if merged, err := git.Query(ctx, "merge-base", "--is-ancestor", b.commit.String(), up.Commit().String()); err != nil {
+				return nil, err
+			} else if merged {
+				continue
+			}
+			drafts, err = revList(ctx, git, b.commit.String(), "--not", up.Commit().String())
+			if err != nil {
+				return nil, err
+			}
+			g.add(up.Commit(), false)
+		} else {
+			// Without an upstream, the branch diverged from published
+			// history. If nothing has been published, stop at the other
+			// branches instead of showing the whole history.
+			exclude := public
+			if len(exclude) == 0 {
+				for _, other := range branches {
+					if other.name != b.name {
+						exclude = append(exclude, other.commit)
+					}
+				}
+			}
+			drafts, err = excludeAncestors(ctx, git, exclude, b.commit.String())
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, d := range drafts {
+			if g.nodes[d] != nil {
+				continue
+			}
+			n := g.add(d, true)
+			if up != nil {
+				n.hasUpstream = true
+				n.upstream = up.Commit()
+			}
+		}
+	}
+	if g.head != (gitobj.Hash{}) && g.nodes[g.head] == nil {
+		// Detached HEAD or a branch that has already been merged.
+		exclude := append([]gitobj.Hash(nil), public...)
+		for _, b := range branches {
+			exclude = append(exclude, b.commit)
+		}
+		drafts, err := excludeAncestors(ctx, git, exclude, g.head.String())
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range drafts {
+			g.add(d, true)
+		}
+		g.add(g.head, false)
+	}
+	if err := g.loadKeywords(ctx, git); err != nil {
+		return nil, err
+	}
+
+	// Connect drafts to their first parents, adding the revisions where
+	// they diverge from published history.
+	var drafts []*smartlogNode
+	for _, n := range g.order {
+		if n.draft {
+			drafts = append(drafts, n)
+		}
+	}
+	for _, n := range drafts {
+		parents := n.kw["parents"].([]gitobj.Hash)
+		if len(parents) == 0 {
+			continue
+		}
+		n.parent = g.add(parents[0], false)
+	}
+	if err := g.loadKeywords(ctx, git); err != nil {
+		return nil, err
+	}
+
+	// Connect published revisions to their nearest shown ancestors.
+	var publicNodes []*smartlogNode
+	var publicCommits []gitobj.Hash
+	for _, n := range g.order {
+		if !n.draft {
+			publicNodes = append(publicNodes, n)
+			publicCommits = append(publicCommits, n.commit)
+		}
+	}
+	anc, err := readAncestry(ctx, git, publicCommits)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range publicNodes {
+		var candidates []*smartlogNode
+		for _, c := range publicNodes {
+			if c != n && anc.isAncestor(c.commit, n.commit) {
+				candidates = append(candidates, c)
+			}
+		}
+	findNearest:
+		for _, c := range candidates {
+			for _, d := range candidates {
+				if c != d && anc.isAncestor(c.commit, d.commit) {
+					continue findNearest
+				}
+			}
+			n.parent = c
+			n.elided = true
+			for _, p := range n.kw["parents"].([]gitobj.Hash) {
+				if p == c.commit {
+					n.elided = false
+				}
+			}
+			break
+		}
+	}
+	for _, n := range g.order {
+		if n.parent != nil {
+			n.parent.children = append(n.parent.children, n)
+		}
+	}
+
+	// Compare drafts to their upstreams.
+	for _, n := range drafts {
+		if !n.hasUpstream {
+			continue
+		}
+		out, err := git.RunOneLiner(ctx, '\n', "rev-list", "--left-right", "--count", n.upstream.String()+"..."+n.commit.String())
+		if err != nil {
+			return nil, err
+		}
+		counts := strings.Fields(string(out))
+		if len(counts) != 2 {
+			return nil, fmt.Errorf("parse git rev-list --count output %q", out)
+		}
+		if n.behind, err = strconv.Atoi(counts[0]); err != nil {
+			return nil, fmt.Errorf("parse git rev-list --count output: %v", err)
+		}
+		if n.ahead, err = strconv.Atoi(counts[1]); err != nil {
+			return nil, fmt.Errorf("parse git rev-list --count output: %v", err)
+		}
+	}
+	return g, nil
+}
+
+// ancestry records which of a set of commits are ancestors of each
+// other.
+type ancestry struct {
+	index map[gitobj.Hash]int      // position of each commit in the set
+	anc   map[gitobj.Hash][]uint64 // bit set of ancestors in the set
+}
+
+// readAncestry finds the ancestry of the given commits with a single
+// walk of the history between them.
+func readAncestry(ctx context.Context, git *gittool.Tool, commits []gitobj.Hash) (*ancestry, error) {
+	a := &ancestry{
+		index: make(map[gitobj.Hash]int, len(commits)),
+		anc:   make(map[gitobj.Hash][]uint64),
+	}
+	for _, c := range commits {
+		if _, ok := a.index[c]; !ok {
+			a.index[c] = len(a.index)
+		}
+	}
+	if len(a.index) < 2 {
+		return a, nil
+	}
+	args := []string{"rev-list", "--topo-order", "--parents"}
+	for _, c := range commits {
+		args = append(args, c.String())
+	}
+	// Nothing before the commits' common ancestor can be in the set.
+	mergeBaseArgs := append([]string{"merge-base", "--octopus"}, args[3:]...)
+	if base, err := git.RunOneLiner(ctx, '\n', mergeBaseArgs...); err == nil {
+		args = append(args, "--not", string(base)+"^@")
+	} else if !gittool.IsExitError(err) {
+		return nil, err
+	}
+	// Otherwise, the commits don't have a common ancestor.
+
+	p, err := git.Start(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Wait()
+	type walked struct {
+		commit  gitobj.Hash
+		parents []gitobj.Hash
+	}
+	var walk []walked
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("parse git rev-list output: empty line")
+		}
+		hashes := make([]gitobj.Hash, len(fields))
+		for i, f := range fields {
+			var err error
+			hashes[i], err = gitobj.ParseHash(f)
+			if err != nil {
+				return nil, fmt.Errorf("parse git rev-list output: %v", err)
+			}
+		}
+		walk = append(walk, walked{commit: hashes[0], parents: hashes[1:]})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Topological order lists children before their parents, so
+	// walking it backward visits parents first.
+	words := (len(a.index) + 63) / 64
+	for i := len(walk) - 1; i >= 0; i-- {
+		w := walk[i]
+		set := make([]uint64, words)
+		for _, parent := range w.parents {
+			for j, bits := range a.anc[parent] {
+				set[j] |= bits
+			}
+			if k, ok := a.index[parent]; ok {
+				set[k/64] |= 1 << uint(k%64)
+			}
+		}
+		a.anc[w.commit] = set
+	}
+	return a, nil
+}
+
+// isAncestor reports whether x is a proper ancestor of y. Both must be
+// in the set passed to readAncestry.
+func (a *ancestry) isAncestor(x, y gitobj.Hash) bool {
+	k, ok := a.index[x]
+	if !ok {
+		return false
+	}
+	set := a.anc[y]
+	return k/64 < len(set) && set[k/64]&(1<<uint(k%64)) != 0
+}
+
+// loadKeywords reads the commit information for any nodes that don't
+// have it yet.
+func (g *smartlogGraph) loadKeywords(ctx context.Context, git *gittool.Tool) error {
+	var commits []gitobj.Hash
+	for _, n := range g.order {
+		if n.kw == nil {
+			commits = append(commits, n.commit)
+		}
+	}
+	kws, err := commitKeywordsFor(ctx, git, commits)
+	if err != nil {
+		return err
+	}
+	for _, c := range commits {
+		kw := kws[c]
+		if kw == nil {
+			return fmt.Errorf("read commit %v: not found", c)
+		}
+		g.nodes[c].kw = kw
+	}
+	return nil
+}
+
+// revList returns the commits listed by git rev-list in topological
+// order.
+func revList(ctx context.Context, git *gittool.Tool, args ...string) ([]gitobj.Hash, error) {
+	return revListWithInput(ctx, git, nil, args...)
+}
+
+// revListWithInput is like revList, but connects git rev-list's stdin
+// to input for use with --stdin.
+func revListWithInput(ctx context.Context, git *gittool.Tool, input io.Reader, args ...string) ([]gitobj.Hash, error) {
+	p, err := git.StartWithInput(ctx, input, append([]string{"rev-list", "--topo-order"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	var hashes []gitobj.Hash
+	for s.Scan() {
+		h, err := gitobj.ParseHash(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("parse git rev-list output: %v", err)
+		}
+		hashes = append(hashes, h)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func (g *smartlogGraph) render(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, n := range g.order {
+		if n.parent == nil {
+			g.renderNode(bw, n, "")
+		}
+	}
+	return bw.Flush()
+}
+
+// renderNode writes the subgraph rooted at n. Descendants are written
+// before n: the first child continues n's column and the others are
+// written one column to the right.
+func (g *smartlogGraph) renderNode(w *bufio.Writer, n *smartlogNode, prefix string) {
+	children := make([]*smartlogNode, 0, len(n.children))
+	for _, c := range n.children {
+		if !c.draft {
+			children = append(children, c)
+		}
+	}
+	for _, c := range n.children {
+		if c.draft {
+			children = append(children, c)
+		}
+	}
+	if len(children) > 0 {
+		edge := "|"
+		if children[0].elided {
+			edge = ":"
+		}
+		g.renderNode(w, children[0], prefix)
+		fmt.Fprintf(w, "%s%s\n", prefix, edge)
+		for _, c := range children[1:] {
+			g.renderNode(w, c, prefix+edge+" ")
+			fmt.Fprintf(w, "%s%s/\n", prefix, edge)
+		}
+	}
+
+	marker := "o"
+	if n.commit == g.head {
+		marker = "@"
+	}
+	fmt.Fprintf(w, "%s%s  %s", prefix, marker, n.commit.Short())
+	if branches := n.kw["branches"].([]string); len(branches) > 0 {
+		fmt.Fprintf(w, "  [%s]", strings.Join(branches, ", "))
+	}
+	if desc := n.kw["desc"].(string); desc != "" {
+		if i := strings.IndexByte(desc, '\n'); i != -1 {
+			desc = desc[:i]
+		}
+		fmt.Fprintf(w, "  %s", desc)
+	}
+	w.WriteString("\n")
+	if !n.draft {
+		return
+	}
+	var notes []string
+	if id := n.kw["changeid"].(string); id != "" {
+		if len(id) > 9 {
+			id = id[:9]
+		}
+		notes = append(notes, "Change-Id "+id)
+	}
+	if n.hasUpstream {
+		notes = append(notes, fmt.Sprintf("%d ahead, %d behind", n.ahead, n.behind))
+	}
+	if len(notes) > 0 {
+		edge := " "
+		if n.parent != nil {
+			edge = "|"
+		}
+		fmt.Fprintf(w, "%s%s  %s\n", prefix, edge, strings.Join(notes, ", "))
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSmartlog(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	// m1 -- m2 -- m3 -- m4 (master)
+	//   \
+	//    f1 -- f2 (feature, HEAD)
+	m1, err := dummyRev(ctx, env.git, env.root, "master", "m1.txt", "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f1, err := dummyRev(ctx, env.git, env.root, "feature", "f1.txt", "f1\n\nChange-Id: I0123456789abcdef0123456789abcdef01234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := dummyRev(ctx, env.git, env.root, "feature", "f2.txt", "f2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"m2", "m3"} {
+		if _, err := dummyRev(ctx, env.git, env.root, "master", name+".txt", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m4, err := dummyRev(ctx, env.git, env.root, "master", "m4.txt", "m4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Publish master so that it is not considered a draft.
+	if err := env.git.Run(ctx, "update-ref", "refs/remotes/origin/master", m4.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "smartlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "o  " + m4.Short() + "  [master]  m4\n" +
+		":\n" +
+		": @  " + f2.Short() + "  [feature]  f2\n" +
+		": |  2 ahead, 3 behind\n" +
+		": |\n" +
+		": o  " + f1.Short() + "  f1\n" +
+		": |  Change-Id I01234567, 1 ahead, 3 behind\n" +
+		":/\n" +
+		"o  " + m1.Short() + "  m1\n"
+	if string(out) != want {
+		t.Errorf("gg smartlog output:\n%s\nwant:\n%s", out, want)
+	}
+
+	// Once feature has been merged, only master is shown.
+	if err := env.git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "branch", "--force", "feature", "master"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = env.gg(ctx, env.root, "sl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "@  " + m4.Short() + "  [feature, master]  m4\n"
+	if string(out) != want {
+		t.Errorf("gg sl after merge output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestSmartlog_NoRemotes(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	// m1 -- m2 (master) -- f1 (feature, HEAD)
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "m1.txt", "m1"); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := dummyRev(ctx, env.git, env.root, "master", "m2.txt", "m2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "checkout", "--quiet", "-b", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	f1, err := dummyRev(ctx, env.git, env.root, "feature", "f1.txt", "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "smartlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "@  " + f1.Short() + "  [feature]  f1\n" +
+		"|\n" +
+		"o  " + m2.Short() + "  [master]  m2\n"
+	if string(out) != want {
+		t.Errorf("gg smartlog output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestSmartlog_Unborn(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "smartlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 0 {
+		t.Errorf("gg smartlog output = %q; want empty", out)
+	}
+}
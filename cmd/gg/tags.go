@@ -0,0 +1,119 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+const tagsSynopsis = "list repository tags"
+
+func tags(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg tags [-T TEMPLATE]", tagsSynopsis+`
+
+	List the repository's tags and the revisions they point to.
+
+	`+templateHelp+` The keywords are tag and the commit keywords
+	`+commitTemplateKeywords+`.`)
+	tmpl := f.String("template", "default", "display with `style` or template")
+	f.Alias("template", "T")
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() > 0 {
+		return usagef("no arguments expected")
+	}
+	out, err := newTemplateOutput(ctx, cc, *tmpl, tagStyles)
+	if err != nil {
+		return err
+	}
+	tagList, err := listTags(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	commits := make([]gitobj.Hash, 0, len(tagList))
+	for _, t := range tagList {
+		commits = append(commits, t.commit)
+	}
+	commitKeywords, err := commitKeywordsFor(ctx, cc.git, commits)
+	if err != nil {
+		return err
+	}
+	for _, t := range tagList {
+		kw := copyKeywords(commitKeywords[t.commit])
+		kw["tag"] = t.name.Tag()
+		if err := out.write(kw); err != nil {
+			return err
+		}
+	}
+	return out.close()
+}
+
+// tagStyles is the set of built-in styles for tags.
+var tagStyles = map[string]string{
+	"default": "{pad(tag, 30)} {node|short}\n",
+	"compact": "{tag}\n",
+}
+
+// listTags returns the tags in the repository that point to commits,
+// sorted by name. Annotated tags are peeled to the commit they point to.
+func listTags(ctx context.Context, git *gittool.Tool) (refList, error) {
+	p, err := git.Start(ctx, "for-each-ref", "--format=%(objectname) %(*objectname) %(*objecttype) %(objecttype) %(refname)", "refs/tags/")
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %v", err)
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	var refs refList
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 5)
+		if len(parts) != 5 {
+			return nil, errors.New("list tags: parse git for-each-ref: wrong number of fields")
+		}
+		target, typ := parts[0], parts[3]
+		if parts[1] != "" {
+			target, typ = parts[1], parts[2]
+		}
+		if typ != "commit" {
+			continue
+		}
+		h, err := gitobj.ParseHash(target)
+		if err != nil {
+			return nil, fmt.Errorf("list tags: parse git for-each-ref: %v", err)
+		}
+		refs = append(refs, refListEntry{
+			name:   gitobj.Ref(parts[4]),
+			commit: h,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("list tags: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("list tags: %v", err)
+	}
+	return refs, nil
+}
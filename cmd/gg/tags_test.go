@@ -0,0 +1,68 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	h1, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "tag", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := dummyRev(ctx, env.git, env.root, "master", "bar.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "tag", "-a", "-m", "Release 2", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "tag", "tree", "HEAD^{tree}"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "v1                             " + h1.Short() + "\n" +
+		"v2                             " + h2.Short() + "\n"
+	if string(out) != want {
+		t.Errorf("gg tags = %q; want %q", out, want)
+	}
+
+	out, err = env.gg(ctx, env.root, "tags", "-T", `{tag}={desc|firstline}\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "v1=first\nv2=second\n"
+	if string(out) != want {
+		t.Errorf("gg tags -T ... = %q; want %q", out, want)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+	"zombiezen.com/go/gg/internal/template"
+)
+
+// templateHelp is the help text shared by commands that accept -T.
+const templateHelp = `The ` + "`-T`" + ` flag takes either a style name or a template. A
+	template is literal text with keywords in braces, like
+	` + "`{node|short} {desc|firstline}\\n`" + `. Keywords can be passed through
+	filters (short, firstline, isodate, shortdate, rfc3339date, person,
+	email, json, lower, upper, strip, count) and functions (if, ifeq,
+	join, pad). The style ` + "`json`" + ` prints the keywords as JSON, except
+	for the ones that run extra git commands for each record, like files
+	and phase. ` + "`json(KEYWORD, ...)`" + ` prints only the listed keywords.
+	Other styles can be defined with the git configuration setting
+	` + "`gg.style.NAME`" + `.`
+
+// commitTemplateKeywords is the list of keywords available for commits.
+const commitTemplateKeywords = `node, parents, author, date,
+	committer, commitdate, desc, branches, tags, changeid, files, and phase`
+
+// templateOutput writes records formatted with a template or as JSON.
+type templateOutput struct {
+	w    io.Writer
+	tmpl *template.Template
+	json bool
+	n    int
+
+	// jsonKeys is the list of keywords to print as JSON. If it is nil,
+	// then all of the keywords that don't need to be computed lazily are
+	// printed.
+	jsonKeys []string
+}
+
+// newTemplateOutput resolves the argument to a -T flag. The argument is
+// either "json", "json(KEYWORD, ...)", the name of a style set in the gg.style.NAME git
+// configuration setting, the name of one of the command's built-in
+// styles, or a template.
+func newTemplateOutput(ctx context.Context, cc *cmdContext, arg string, styles map[string]string) (*templateOutput, error) {
+	if arg == "json" {
+		return &templateOutput{w: cc.stdout, json: true}, nil
+	}
+	if strings.HasPrefix(arg, "json(") && strings.HasSuffix(arg, ")") {
+		out := &templateOutput{w: cc.stdout, json: true, jsonKeys: []string{}}
+		for _, k := range strings.Split(arg[len("json("):len(arg)-1], ",") {
+			k = strings.TrimSpace(k)
+			if k == "" {
+				return nil, fmt.Errorf("template: empty keyword in %s", arg)
+			}
+			out.jsonKeys = append(out.jsonKeys, k)
+		}
+		return out, nil
+	}
+	text := arg
+	if isStyleName(arg) {
+		cfg, err := gittool.ReadConfig(ctx, cc.git)
+		if err != nil {
+			return nil, err
+		}
+		if s := cfg.Value("gg.style." + arg); s != "" {
+			text = s
+		} else if s := styles[arg]; s != "" {
+			text = s
+		}
+	}
+	tmpl, err := template.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template: %v", err)
+	}
+	return &templateOutput{w: cc.stdout, tmpl: tmpl}, nil
+}
+
+// isStyleName reports whether s could be the name of a style.
+func isStyleName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// write formats a single record.
+func (out *templateOutput) write(kw template.Keywords) error {
+	if !out.json {
+		if err := out.tmpl.Execute(out.w, kw); err != nil {
+			return fmt.Errorf("template: %v", err)
+		}
+		return nil
+	}
+	kw, err := out.jsonKeywords(kw)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(kw, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if out.n == 0 {
+		sep = "[\n  "
+	}
+	out.n++
+	if _, err := io.WriteString(out.w, sep); err != nil {
+		return err
+	}
+	_, err = out.w.Write(data)
+	return err
+}
+
+// jsonKeywords returns the subset of kw to print as JSON.
+func (out *templateOutput) jsonKeywords(kw template.Keywords) (template.Keywords, error) {
+	sub := make(template.Keywords)
+	if out.jsonKeys == nil {
+		for k, v := range kw {
+			if _, lazy := v.(func() (interface{}, error)); !lazy {
+				sub[k] = v
+			}
+		}
+		return sub, nil
+	}
+	for _, k := range out.jsonKeys {
+		v, ok := kw[k]
+		if !ok {
+			return nil, fmt.Errorf("template: unknown keyword %q", k)
+		}
+		sub[k] = v
+	}
+	return sub, nil
+}
+
+// close finishes the output. It must be called after all records have
+// been written.
+func (out *templateOutput) close() error {
+	if !out.json {
+		return nil
+	}
+	end := "\n]\n"
+	if out.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(out.w, end)
+	return err
+}
+
+// readCommitKeywords calls f with the template keywords for each commit
+// that git log lists with the given options.
+func readCommitKeywords(ctx context.Context, git *gittool.Tool, opts *gittool.LogOptions, f func(template.Keywords) error) error {
+	decorations, err := readDecorations(ctx, git)
+	if err != nil {
+		return err
+	}
+	cr, err := gittool.Log(ctx, git, opts)
+	if err != nil {
+		return fmt.Errorf("read commits: %v", err)
+	}
+	phases := &phaseReader{git: git, revs: opts.Revs}
+	for cr.Scan() {
+		if err := f(commitKeywords(ctx, git, cr.Commit(), decorations, phases)); err != nil {
+			cr.Close()
+			return err
+		}
+	}
+	if err := cr.Err(); err != nil {
+		cr.Close()
+		return fmt.Errorf("read commits: %v", err)
+	}
+	if err := cr.Close(); err != nil {
+		return fmt.Errorf("read commits: %v", err)
+	}
+	return nil
+}
+
+// commitKeywords builds the template keywords for a commit.
+func commitKeywords(ctx context.Context, git *gittool.Tool, c *gittool.CommitInfo, decorations map[gitobj.Hash]*decoration, phases *phaseReader) template.Keywords {
+	node := c.Hash
+	var branches, tags []string
+	if d := decorations[node]; d != nil {
+		branches = d.branches
+		tags = d.tags
+	}
+	return template.Keywords{
+		"node":       node,
+		"parents":    c.Parents,
+		"author":     c.Author.Name + " <" + c.Author.Email + ">",
+		"date":       c.Author.Time,
+		"committer":  c.Committer.Name + " <" + c.Committer.Email + ">",
+		"commitdate": c.Committer.Time,
+		"desc":       strings.TrimRight(c.Message, "\n"),
+		"branches":   branches,
+		"tags":       tags,
+		"changeid":   findChangeID([]byte(c.Message)),
+		"files": func() (interface{}, error) {
+			return commitFiles(ctx, git, node)
+		},
+		"phase": func() (interface{}, error) {
+			return phases.phase(ctx, node)
+		},
+	}
+}
+
+// commitFiles returns the paths of the files changed in a commit
+// relative to its first parent.
+func commitFiles(ctx context.Context, git *gittool.Tool, commit gitobj.Hash) ([]string, error) {
+	p, err := git.Start(ctx, "diff-tree", "--no-commit-id", "--name-only", "-r", "-z", "--root", commit.String())
+	if err != nil {
+		return nil, fmt.Errorf("list files in %v: %v", commit, err)
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	s.Split(splitNUL)
+	var files []string
+	for s.Scan() {
+		files = append(files, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("list files in %v: %v", commit, err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("list files in %v: %v", commit, err)
+	}
+	return files, nil
+}
+
+// A decoration is the set of branches and tags that point to a commit.
+type decoration struct {
+	branches []string
+	tags     []string
+}
+
+// readDecorations returns the branches and tags that point to each
+// commit.
+func readDecorations(ctx context.Context, git *gittool.Tool) (map[gitobj.Hash]*decoration, error) {
+	p, err := git.Start(ctx, "for-each-ref", "--format=%(objectname) %(*objectname) %(refname)", "refs/heads/", "refs/tags/")
+	if err != nil {
+		return nil, fmt.Errorf("read refs: %v", err)
+	}
+	defer p.Wait()
+	decorations := make(map[gitobj.Hash]*decoration)
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 3)
+		if len(parts) != 3 {
+			return nil, errors.New("read refs: parse git for-each-ref: wrong number of fields")
+		}
+		target := parts[0]
+		if parts[1] != "" {
+			// Annotated tag.
+			target = parts[1]
+		}
+		h, err := gitobj.ParseHash(target)
+		if err != nil {
+			return nil, fmt.Errorf("read refs: parse git for-each-ref: %v", err)
+		}
+		d := decorations[h]
+		if d == nil {
+			d = new(decoration)
+			decorations[h] = d
+		}
+		ref := gitobj.Ref(parts[2])
+		switch {
+		case ref.IsBranch():
+			d.branches = append(d.branches, ref.Branch())
+		case ref.IsTag():
+			d.tags = append(d.tags, ref.Tag())
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read refs: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, fmt.Errorf("read refs: %v", err)
+	}
+	return decorations, nil
+}
+
+// commitKeywordsFor returns the template keywords for each of the given
+// commits. Callers must copy the keywords before adding to them, since
+// a commit's keywords are shared.
+func commitKeywordsFor(ctx context.Context, git *gittool.Tool, commits []gitobj.Hash) (map[gitobj.Hash]template.Keywords, error) {
+	m := make(map[gitobj.Hash]template.Keywords, len(commits))
+	if len(commits) == 0 {
+		return m, nil
+	}
+	opts := &gittool.LogOptions{NoWalk: true}
+	for _, c := range commits {
+		opts.Revs = append(opts.Revs, c.String())
+	}
+	err := readCommitKeywords(ctx, git, opts, func(kw template.Keywords) error {
+		m[kw["node"].(gitobj.Hash)] = kw
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// copyKeywords returns a shallow copy of kw.
+func copyKeywords(kw template.Keywords) template.Keywords {
+	kw2 := make(template.Keywords, len(kw))
+	for k, v := range kw {
+		kw2[k] = v
+	}
+	return kw2
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"errors"
 
 	"zombiezen.com/go/gg/internal/flag"
 	"zombiezen.com/go/gg/internal/gittool"
@@ -39,7 +40,11 @@ func update(ctx context.Context, cc *cmdContext, args []string) error {
 	switch {
 	case f.NArg() == 0 && *rev == "":
 		// TODO(someday): how to apply --merge?
-		return cc.git.Run(ctx, "merge", "--quiet", "--ff-only")
+		err := cc.git.Run(ctx, "merge", "--quiet", "--ff-only")
+		if gittool.Cause(err) == gittool.ErrNonFastForward {
+			return errors.New("upstream has diverged from the current branch; run `gg merge` or `gg rebase` to combine them")
+		}
+		return err
 	case f.NArg() == 0 && *rev != "":
 		var err error
 		r, err = gittool.ParseRev(ctx, cc.git, *rev)
@@ -0,0 +1,308 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/flag"
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+const verifySynopsis = "verify the integrity of the repository"
+
+func verify(ctx context.Context, cc *cmdContext, args []string) error {
+	f := flag.NewFlagSet(true, "gg verify", verifySynopsis+`
+
+	verify checks that every object reachable from the repository's refs
+	is present, that each branch's upstream exists, and that the Gerrit
+	change IDs of each branch's unpushed commits are well-formed and
+	unique. It also checks that gg's obsolescence markers and operation
+	log can be read. Problems are grouped by branch, along with
+	suggestions on how to recover.`)
+	if err := f.Parse(args); flag.IsHelp(err) {
+		f.Help(cc.stdout)
+		return nil
+	} else if err != nil {
+		return usagef("%v", err)
+	}
+	if f.NArg() != 0 {
+		return usagef("no arguments expected")
+	}
+
+	damaged, err := fsckConnectivity(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	branches, err := listBranches(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	cfg, err := gittool.ReadConfig(ctx, cc.git)
+	if err != nil {
+		return err
+	}
+	var groups []verifyGroup
+	if len(damaged) > 0 {
+		groups = append(groups, verifyGroup{
+			name: "repository",
+			problems: []verifyProblem{{
+				problem: strings.Join(damaged, "\n"),
+				hint:    "run `gg clone` to make a fresh copy of the repository and `gg bundle` to move intact changes into it (`git fsck --full` lists the damaged objects)",
+			}},
+		})
+	}
+	if ok, err := cc.git.Query(ctx, "rev-parse", "-q", "--verify", gitobj.Head.String()); err != nil {
+		return err
+	} else if !ok && len(branches) > 0 {
+		groups = append(groups, verifyGroup{
+			name: "HEAD",
+			problems: []verifyProblem{{
+				problem: "HEAD does not point to a valid commit",
+				hint:    "run `gg update BRANCH` to switch to a branch",
+			}},
+		})
+	}
+	if problems, err := verifyObsMarkers(ctx, cc.git); err != nil {
+		return err
+	} else if len(problems) > 0 {
+		groups = append(groups, verifyGroup{
+			name:     "obsolescence markers",
+			problems: problems,
+		})
+	}
+	if problems, err := verifyOplog(ctx, cc.git); err != nil {
+		return err
+	} else if len(problems) > 0 {
+		groups = append(groups, verifyGroup{
+			name:     "operation log",
+			problems: problems,
+		})
+	}
+	for _, b := range branches {
+		problems, err := verifyBranch(ctx, cc.git, cfg, b, len(damaged) > 0)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			groups = append(groups, verifyGroup{
+				name:     "branch " + b.name.Branch(),
+				problems: problems,
+			})
+		}
+	}
+
+	n := 0
+	for _, g := range groups {
+		fmt.Fprintf(cc.stdout, "%s:\n", g.name)
+		for _, p := range g.problems {
+			n++
+			fmt.Fprintf(cc.stdout, "  %s\n", strings.Replace(p.problem, "\n", "\n  ", -1))
+			if p.hint != "" {
+				fmt.Fprintf(cc.stdout, "    hint: %s\n", p.hint)
+			}
+		}
+	}
+	switch n {
+	case 0:
+		fmt.Fprintln(cc.stdout, "no problems found")
+		return nil
+	case 1:
+		return errors.New("found 1 problem")
+	default:
+		return fmt.Errorf("found %d problems", n)
+	}
+}
+
+// verifyGroup is a set of problems found by gg verify about the same
+// part of the repository.
+type verifyGroup struct {
+	name     string
+	problems []verifyProblem
+}
+
+type verifyProblem struct {
+	problem string
+	hint    string
+}
+
+// verifyBranch checks a single branch. checkObjects indicates whether
+// the repository has missing objects, so the branch's history should be
+// checked for completeness.
+func verifyBranch(ctx context.Context, git *gittool.Tool, cfg *gittool.Config, b refListEntry, checkObjects bool) ([]verifyProblem, error) {
+	name := b.name.Branch()
+	remote := cfg.Value("branch." + name + ".remote")
+	merge := cfg.Value("branch." + name + ".merge")
+	hasUpstream := remote != "" && merge != ""
+	var problems []verifyProblem
+	if checkObjects {
+		ok, err := git.Query(ctx, "rev-list", "--objects", "--quiet", b.name.String(), "--")
+		if !ok || err != nil {
+			problems = append(problems, verifyProblem{
+				problem: "history is missing objects",
+				hint:    "run `gg clone` to make a fresh copy of the repository and `gg bundle` to move the branch's intact changes into it",
+			})
+			// Further checks read history, which would fail.
+			return problems, nil
+		}
+	}
+	if !hasUpstream {
+		return problems, nil
+	}
+	upstream := name + "@{upstream}"
+	if ok, err := git.Query(ctx, "rev-parse", "-q", "--verify", upstream); err != nil || !ok {
+		hint := fmt.Sprintf("run `gg upstream -b %s REF` to track a different branch", shellEscape(name))
+		if remote != "." {
+			hint = "run `gg pull` to fetch it or " + hint
+		}
+		problems = append(problems, verifyProblem{
+			problem: fmt.Sprintf("upstream %s from %s does not exist", merge, remote),
+			hint:    hint,
+		})
+		return problems, nil
+	}
+	changes, err := readChanges(ctx, git, b.name.String(), upstream)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]string)
+	for _, c := range changes {
+		if c.id == "" {
+			continue
+		}
+		if !isChangeID(c.id) {
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("commit %s has malformed Change-Id %q", c.commitHex[:7], c.id),
+				hint:    "run `gg histedit` to fix the commit message",
+			})
+			continue
+		}
+		if other := seen[c.id]; other != "" {
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("commits %s and %s have the same Change-Id %s", c.commitHex[:7], other[:7], c.id),
+				hint:    "run `gg histedit` to remove the Change-Id from one of the commits",
+			})
+			continue
+		}
+		seen[c.id] = c.commitHex
+	}
+	return problems, nil
+}
+
+// verifyObsMarkers checks that every obsolescence marker recorded by
+// amend, rebase, histedit, and evolve can be parsed.
+func verifyObsMarkers(ctx context.Context, git *gittool.Tool) ([]verifyProblem, error) {
+	var problems []verifyProblem
+	err := scanObsNotes(ctx, git, func(path, line string) error {
+		pred, err := gitobj.ParseHash(strings.Replace(path, "/", "", -1))
+		if err != nil {
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("note %s is not attached to a commit", path),
+				hint:    fmt.Sprintf("run `git update-ref -d %s` to discard all markers", obsMarkersRef),
+			})
+			return nil
+		}
+		if _, err := parseObsMarker(pred, line); err != nil {
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("commit %s has a %v", pred.Short(), err),
+				hint:    fmt.Sprintf("run `git notes --ref=%s edit %v` to fix or remove it", obsMarkersRef, pred),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify obsolescence markers: %v", err)
+	}
+	return problems, nil
+}
+
+// verifyOplog checks that every entry in the operation log can be
+// parsed and that the entries are in order.
+func verifyOplog(ctx context.Context, git *gittool.Tool) ([]verifyProblem, error) {
+	gitDir, err := gittool.GitDir(ctx, git)
+	if err != nil {
+		return nil, fmt.Errorf("verify operation log: %v", err)
+	}
+	hint := fmt.Sprintf("remove the line from %s to stop undo from using it", filepath.Join(gitDir, oplogFile))
+	var problems []verifyProblem
+	lastID := 0
+	err = scanOplog(ctx, git, func(lineno int, line []byte) error {
+		e := new(opEntry)
+		if err := json.Unmarshal(line, e); err != nil {
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("line %d is malformed: %v", lineno, err),
+				hint:    hint,
+			})
+			return nil
+		}
+		switch {
+		case e.Before == nil || e.After == nil:
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("operation %d on line %d is missing its snapshots", e.ID, lineno),
+				hint:    hint,
+			})
+		case e.ID <= lastID:
+			problems = append(problems, verifyProblem{
+				problem: fmt.Sprintf("operation %d on line %d is out of order", e.ID, lineno),
+				hint:    hint,
+			})
+		}
+		if e.ID > lastID {
+			lastID = e.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify operation log: %v", err)
+	}
+	return problems, nil
+}
+
+// fsckConnectivity checks that all objects reachable from the
+// repository's refs are present, returning the problems reported by
+// git fsck.
+func fsckConnectivity(ctx context.Context, git *gittool.Tool) ([]string, error) {
+	p, err := git.Start(ctx, "fsck", "--connectivity-only", "--no-dangling", "--no-progress")
+	if err != nil {
+		return nil, err
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	var damaged []string
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			damaged = append(damaged, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("verify: %v", err)
+	}
+	if err := p.Wait(); err != nil && len(damaged) == 0 {
+		return nil, err
+	}
+	return damaged, nil
+}
+
+// isChangeID reports whether s is a well-formed Gerrit change ID.
+func isChangeID(s string) bool {
+	return len(s) == 41 && s[0] == 'I' && isHex([]byte(s[1:]))
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "branch", "--track", "feature", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "second\n\nChange-Id: I0123456789abcdef0123456789abcdef01234567"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "verify")
+	if err != nil {
+		t.Fatalf("gg verify: %v; output:\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("no problems found")) {
+		t.Errorf("gg verify output:\n%s\nwant \"no problems found\"", out)
+	}
+}
+
+func TestVerify_MissingObject(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "second"); err != nil {
+		t.Fatal(err)
+	}
+	// dummyRev always writes the same content, so remove the tree that
+	// is unique to feature.
+	tree, err := env.git.RunOneLiner(ctx, '\n', "rev-parse", "feature^{tree}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	treePath := filepath.Join(env.root, ".git", "objects", string(tree[:2]), string(tree[2:]))
+	if err := os.Remove(treePath); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "verify")
+	if err == nil {
+		t.Error("gg verify did not return error")
+	}
+	if !bytes.Contains(out, []byte("missing tree "+string(tree))) {
+		t.Errorf("gg verify output:\n%s\nwant missing tree %s", out, tree)
+	}
+	if !bytes.Contains(out, []byte("branch feature:\n  history is missing objects\n")) {
+		t.Errorf("gg verify output:\n%s\nwant feature branch to be reported", out)
+	}
+	if bytes.Contains(out, []byte("branch master:")) {
+		t.Errorf("gg verify output:\n%s\nwant master branch to not be reported", out)
+	}
+}
+
+func TestVerify_Branches(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "branch", "--track", "feature", "master"); err != nil {
+		t.Fatal(err)
+	}
+	const changeID = "I0123456789abcdef0123456789abcdef01234567"
+	if _, err := dummyRev(ctx, env.git, env.root, "feature", "bar.txt", "second\n\nChange-Id: "+changeID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "feature", "baz.txt", "third\n\nChange-Id: "+changeID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "feature", "quux.txt", "fourth\n\nChange-Id: Ibad"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "config", "branch.master.remote", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "config", "branch.master.merge", "refs/heads/gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "verify")
+	if err == nil {
+		t.Error("gg verify did not return error")
+	}
+	if !bytes.Contains(out, []byte("branch master:\n  upstream refs/heads/gone from . does not exist\n")) {
+		t.Errorf("gg verify output:\n%s\nwant missing upstream of master", out)
+	}
+	if !bytes.Contains(out, []byte(`has malformed Change-Id "Ibad"`)) {
+		t.Errorf("gg verify output:\n%s\nwant malformed Change-Id", out)
+	}
+	if !bytes.Contains(out, []byte("have the same Change-Id "+changeID)) {
+		t.Errorf("gg verify output:\n%s\nwant duplicate Change-Id", out)
+	}
+}
+
+func TestVerify_Metadata(t *testing.T) {
+	ctx := context.Background()
+	env, err := newTestEnv(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dummyRev(ctx, env.git, env.root, "master", "foo.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	// Commit a change through gg so that the operation log has a valid
+	// entry before the corrupted one.
+	if err := ioutil.WriteFile(filepath.Join(env.root, "foo.txt"), []byte("changed\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.gg(ctx, env.root, "commit", "-m", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.git.Run(ctx, "notes", "--ref="+obsMarkersRef, "add", "-m", "not a marker", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	oplog, err := os.OpenFile(filepath.Join(env.root, ".git", oplogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = oplog.WriteString("{\"ID\": 1,\n")
+	if closeErr := oplog.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.gg(ctx, env.root, "verify")
+	if err == nil {
+		t.Error("gg verify did not return error")
+	}
+	if !bytes.Contains(out, []byte("obsolescence markers:\n")) || !bytes.Contains(out, []byte(`malformed marker "not a marker"`)) {
+		t.Errorf("gg verify output:\n%s\nwant malformed obsolescence marker", out)
+	}
+	if !bytes.Contains(out, []byte("operation log:\n")) || !bytes.Contains(out, []byte("line 2 is malformed")) {
+		t.Errorf("gg verify output:\n%s\nwant malformed operation log entry on line 2", out)
+	}
+	gitDir, err := gittool.GitDir(ctx, env.git.WithDir(env.root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "remove the line from " + filepath.Join(gitDir, oplogFile); !bytes.Contains(out, []byte(want)) {
+		t.Errorf("gg verify output:\n%s\nwant hint %q", out, want)
+	}
+}
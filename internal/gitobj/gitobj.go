@@ -21,32 +21,114 @@ import (
 	"strings"
 )
 
-// hashSize is the number of bytes in a hash.
-const hashSize = 20
+// An ObjectFormat is the hash algorithm a repository uses to name its
+// objects. The zero value is SHA1.
+type ObjectFormat int8
 
-// A Hash is the SHA-1 hash of a Git object.
-type Hash [hashSize]byte
+// Object formats.
+const (
+	SHA1 ObjectFormat = iota
+	SHA256
+)
+
+// maxHashSize is the number of bytes in the largest supported hash.
+const maxHashSize = 32
+
+// Size returns the number of bytes in a hash of the format.
+func (f ObjectFormat) Size() int {
+	if f == SHA256 {
+		return 32
+	}
+	return 20
+}
+
+// String returns the format's name, like "sha1".
+func (f ObjectFormat) String() string {
+	switch f {
+	case SHA1:
+		return "sha1"
+	case SHA256:
+		return "sha256"
+	default:
+		return fmt.Sprintf("ObjectFormat(%d)", int8(f))
+	}
+}
+
+// A Hash is the SHA-1 or SHA-256 hash of a Git object. The zero value
+// is the all-zeroes SHA-1 hash. Hashes are comparable and hashes of
+// different formats are never equal.
+type Hash struct {
+	b      [maxHashSize]byte
+	format ObjectFormat
+}
 
-// ParseHash parses a hex-encoded hash.
+// ParseHash parses a hex-encoded hash. The format is determined by the
+// length of the string: 40 digits for SHA-1 and 64 digits for SHA-256.
 func ParseHash(s string) (Hash, error) {
-	if len(s) != hex.EncodedLen(hashSize) {
+	var h Hash
+	switch len(s) {
+	case hex.EncodedLen(SHA1.Size()):
+		h.format = SHA1
+	case hex.EncodedLen(SHA256.Size()):
+		h.format = SHA256
+	default:
 		return Hash{}, fmt.Errorf("parse hash %q: wrong size", s)
 	}
-	var h Hash
-	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+	if _, err := hex.Decode(h.b[:], []byte(s)); err != nil {
 		return Hash{}, fmt.Errorf("parse hash %q: %v", s, err)
 	}
 	return h, nil
 }
 
+// NewHash returns the hash of the given format with the given raw bytes.
+func NewHash(f ObjectFormat, b []byte) (Hash, error) {
+	if f != SHA1 && f != SHA256 {
+		return Hash{}, fmt.Errorf("new hash: unknown %v", f)
+	}
+	if len(b) != f.Size() {
+		return Hash{}, fmt.Errorf("new hash: %d bytes is wrong size for %v", len(b), f)
+	}
+	h := Hash{format: f}
+	copy(h.b[:], b)
+	return h, nil
+}
+
+// Format returns the hash's object format.
+func (h Hash) Format() ObjectFormat {
+	return h.format
+}
+
+// Bytes returns the raw bytes of the hash.
+func (h Hash) Bytes() []byte {
+	return append([]byte(nil), h.b[:h.format.Size()]...)
+}
+
 // String returns the hex-encoded hash.
 func (h Hash) String() string {
-	return hex.EncodeToString(h[:])
+	return hex.EncodeToString(h.b[:h.format.Size()])
 }
 
 // Short returns the first 4 hex-encoded bytes of the hash.
 func (h Hash) Short() string {
-	return hex.EncodeToString(h[:4])
+	return hex.EncodeToString(h.b[:4])
+}
+
+// Equal reports whether h and h2 are the same hash. It is equivalent to
+// h == h2.
+func (h Hash) Equal(h2 Hash) bool {
+	return h == h2
+}
+
+// MarshalText returns the hex-encoded hash.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText parses a hex-encoded hash.
+func (h *Hash) UnmarshalText(text []byte) error {
+	var err error
+	*h, err = ParseHash(string(text))
+	return err
 }
 
 // A Ref is a Git reference to a commit.
@@ -28,40 +28,78 @@ func TestHash(t *testing.T) {
 			short: "00000000",
 		},
 		{
-			h: Hash{
+			h: mustNewHash(SHA1, []byte{
 				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
 				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
 				0x01, 0x23, 0x45, 0x67,
-			},
+			}),
 			s:     "0123456789abcdef0123456789abcdef01234567",
 			short: "01234567",
 		},
+		{
+			h: mustNewHash(SHA256, []byte{
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+			}),
+			s:     "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			short: "01234567",
+		},
 	}
 	for _, test := range tests {
 		if got := test.h.String(); got != test.s {
-			t.Errorf("Hash(%x).String() = %q; want %q", test.h[:], got, test.s)
+			t.Errorf("Hash(%x).String() = %q; want %q", test.h.Bytes(), got, test.s)
 		}
 		if got := test.h.Short(); got != test.short {
-			t.Errorf("Hash(%x).Short() = %q; want %q", test.h[:], got, test.short)
+			t.Errorf("Hash(%x).Short() = %q; want %q", test.h.Bytes(), got, test.short)
+		}
+		text, err := test.h.MarshalText()
+		if err != nil {
+			t.Errorf("Hash(%x).MarshalText(): %v", test.h.Bytes(), err)
+			continue
+		}
+		var h Hash
+		if err := h.UnmarshalText(text); err != nil {
+			t.Errorf("UnmarshalText(%q): %v", text, err)
+		} else if h != test.h {
+			t.Errorf("UnmarshalText(%q) = %v; want %v", text, h, test.h)
 		}
 	}
 }
 
 func TestParseHash(t *testing.T) {
 	tests := []struct {
-		s       string
-		want    Hash
-		wantErr bool
+		s          string
+		want       Hash
+		wantFormat ObjectFormat
+		wantErr    bool
 	}{
 		{s: "", wantErr: true},
-		{s: "0000000000000000000000000000000000000000", want: Hash{}},
+		{s: "0000000000000000000000000000000000000000", want: Hash{}, wantFormat: SHA1},
 		{
 			s: "0123456789abcdef0123456789abcdef01234567",
-			want: Hash{
+			want: mustNewHash(SHA1, []byte{
 				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
 				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
 				0x01, 0x23, 0x45, 0x67,
-			},
+			}),
+			wantFormat: SHA1,
+		},
+		{
+			s:          "0000000000000000000000000000000000000000000000000000000000000000",
+			want:       mustNewHash(SHA256, make([]byte, 32)),
+			wantFormat: SHA256,
+		},
+		{
+			s: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			want: mustNewHash(SHA256, []byte{
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+				0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+			}),
+			wantFormat: SHA256,
 		},
 		{
 			s:       "0123456789abcdef0123456789abcdef0123456",
@@ -71,6 +109,10 @@ func TestParseHash(t *testing.T) {
 			s:       "0123456789abcdef0123456789abcdef012345678",
 			wantErr: true,
 		},
+		{
+			s:       "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcde",
+			wantErr: true,
+		},
 		{
 			s:       "01234567",
 			wantErr: true,
@@ -80,12 +122,34 @@ func TestParseHash(t *testing.T) {
 		switch got, err := ParseHash(test.s); {
 		case err == nil && !test.wantErr && got != test.want:
 			t.Errorf("ParseHash(%q) = %v, <nil>; want %v, <nil>", test.s, got, test.want)
+		case err == nil && !test.wantErr && got.Format() != test.wantFormat:
+			t.Errorf("ParseHash(%q).Format() = %v; want %v", test.s, got.Format(), test.wantFormat)
 		case err == nil && test.wantErr:
 			t.Errorf("ParseHash(%q) = %v, <nil>; want error", test.s, got)
 		case err != nil && !test.wantErr:
 			t.Errorf("ParseHash(%q) = _, %v; want %v, <nil>", test.s, err, test.want)
 		}
 	}
+	if mustNewHash(SHA256, make([]byte, 32)) == (Hash{}) {
+		t.Error("zero SHA-1 hash == zero SHA-256 hash")
+	}
+}
+
+func TestNewHash(t *testing.T) {
+	if _, err := NewHash(SHA1, make([]byte, 32)); err == nil {
+		t.Error("NewHash(SHA1, 32 bytes) did not return an error")
+	}
+	if _, err := NewHash(SHA256, make([]byte, 20)); err == nil {
+		t.Error("NewHash(SHA256, 20 bytes) did not return an error")
+	}
+}
+
+func mustNewHash(f ObjectFormat, b []byte) Hash {
+	h, err := NewHash(f, b)
+	if err != nil {
+		panic(err)
+	}
+	return h
 }
 
 func TestRef(t *testing.T) {
@@ -0,0 +1,504 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitobj
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Signature identifies the person who authored, committed, or tagged
+// an object along with when they did it.
+type Signature struct {
+	Name  string
+	Email string
+
+	// Time is the time of the signature, in the signer's time zone.
+	// A zone named "-0000" is written as "-0000", which git uses to
+	// mean that the zone is unknown.
+	Time time.Time
+}
+
+// ParseSignature parses a signature in the form
+// "Name <email> 1136239445 -0700". The name may be empty, as git
+// permits committing with an empty user.name.
+func ParseSignature(s string) (Signature, error) {
+	lt := strings.IndexByte(s, '<')
+	if lt < 1 || s[lt-1] != ' ' {
+		return Signature{}, fmt.Errorf("parse signature %q: missing name", s)
+	}
+	gt := strings.IndexByte(s[lt:], '>')
+	if gt == -1 {
+		return Signature{}, fmt.Errorf("parse signature %q: missing email", s)
+	}
+	gt += lt
+	rest := s[gt+1:]
+	if !strings.HasPrefix(rest, " ") {
+		return Signature{}, fmt.Errorf("parse signature %q: missing time", s)
+	}
+	rest = rest[1:]
+	sp := strings.IndexByte(rest, ' ')
+	if sp == -1 {
+		return Signature{}, fmt.Errorf("parse signature %q: missing time zone", s)
+	}
+	secs, tz := rest[:sp], rest[sp+1:]
+	if secs == "" || (len(secs) > 1 && secs[0] == '0') || strings.TrimLeft(secs, "0123456789") != "" {
+		return Signature{}, fmt.Errorf("parse signature %q: invalid time", s)
+	}
+	unix, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("parse signature %q: invalid time", s)
+	}
+	loc, err := parseTimeZone(tz)
+	if err != nil {
+		return Signature{}, fmt.Errorf("parse signature %q: %v", s, err)
+	}
+	sig := Signature{
+		Name:  s[:lt-1],
+		Email: s[lt+1 : gt],
+		Time:  time.Unix(unix, 0).In(loc),
+	}
+	return sig, nil
+}
+
+func parseTimeZone(tz string) (*time.Location, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') || strings.TrimLeft(tz[1:], "0123456789") != "" {
+		return nil, fmt.Errorf("invalid time zone %q", tz)
+	}
+	hh, _ := strconv.Atoi(tz[1:3])
+	mm, _ := strconv.Atoi(tz[3:])
+	if mm >= 60 {
+		return nil, fmt.Errorf("invalid time zone %q", tz)
+	}
+	offset := hh*60*60 + mm*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	if tz == "-0000" {
+		return time.FixedZone(tz, 0), nil
+	}
+	return time.FixedZone("", offset), nil
+}
+
+// String returns the signature in the form used in git objects.
+func (sig Signature) String() string {
+	name, offset := sig.Time.Zone()
+	tz := name
+	if name != "-0000" || offset != 0 {
+		sign := byte('+')
+		if offset < 0 {
+			sign = '-'
+			offset = -offset
+		}
+		tz = fmt.Sprintf("%c%02d%02d", sign, offset/(60*60), offset/60%60)
+	}
+	return fmt.Sprintf("%s <%s> %d %s", sig.Name, sig.Email, sig.Time.Unix(), tz)
+}
+
+func (sig Signature) validate() error {
+	if strings.ContainsAny(sig.Name, "<\n") {
+		return fmt.Errorf("invalid name %q", sig.Name)
+	}
+	if strings.ContainsAny(sig.Email, ">\n") {
+		return fmt.Errorf("invalid email %q", sig.Email)
+	}
+	if sig.Time.Unix() < 0 {
+		return fmt.Errorf("time %v before 1970", sig.Time)
+	}
+	return nil
+}
+
+// A Header is a header of a commit or tag object that gitobj does not
+// interpret, like "encoding" or "gpgsig". Multi-line values are
+// separated by newlines.
+type Header struct {
+	Key   string
+	Value string
+}
+
+// A Commit is a parsed git commit object.
+type Commit struct {
+	Tree      Hash
+	Parents   []Hash
+	Author    Signature
+	Committer Signature
+
+	// ExtraHeaders are the headers after the committer, in order.
+	ExtraHeaders []Header
+
+	// Message is the commit message, including its trailing newline.
+	Message string
+}
+
+// ParseCommit parses the content of a commit object. Any commit that
+// git fsck considers well-formed will be reproduced exactly by
+// MarshalBinary.
+func ParseCommit(data []byte) (*Commit, error) {
+	headers, msg, err := splitHeaders(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse commit: %v", err)
+	}
+	c := new(Commit)
+	i := 0
+	next := func(key string) (string, bool) {
+		if i < len(headers) && headers[i].Key == key {
+			i++
+			return headers[i-1].Value, true
+		}
+		return "", false
+	}
+	tree, ok := next("tree")
+	if !ok {
+		return nil, errors.New("parse commit: missing tree")
+	}
+	if c.Tree, err = ParseHash(tree); err != nil {
+		return nil, fmt.Errorf("parse commit: tree: %v", err)
+	}
+	for {
+		p, ok := next("parent")
+		if !ok {
+			break
+		}
+		h, err := ParseHash(p)
+		if err != nil {
+			return nil, fmt.Errorf("parse commit: parent: %v", err)
+		}
+		c.Parents = append(c.Parents, h)
+	}
+	author, ok := next("author")
+	if !ok {
+		return nil, errors.New("parse commit: missing author")
+	}
+	if c.Author, err = ParseSignature(author); err != nil {
+		return nil, fmt.Errorf("parse commit: author: %v", err)
+	}
+	committer, ok := next("committer")
+	if !ok {
+		return nil, errors.New("parse commit: missing committer")
+	}
+	if c.Committer, err = ParseSignature(committer); err != nil {
+		return nil, fmt.Errorf("parse commit: committer: %v", err)
+	}
+	c.ExtraHeaders = headers[i:]
+	c.Message = msg
+	return c, nil
+}
+
+// MarshalBinary returns the content of the commit object.
+func (c *Commit) MarshalBinary() ([]byte, error) {
+	if err := c.Author.validate(); err != nil {
+		return nil, fmt.Errorf("marshal commit: author: %v", err)
+	}
+	if err := c.Committer.validate(); err != nil {
+		return nil, fmt.Errorf("marshal commit: committer: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "tree %v\n", c.Tree)
+	for _, p := range c.Parents {
+		fmt.Fprintf(buf, "parent %v\n", p)
+	}
+	fmt.Fprintf(buf, "author %v\n", c.Author)
+	fmt.Fprintf(buf, "committer %v\n", c.Committer)
+	if err := writeHeaders(buf, c.ExtraHeaders); err != nil {
+		return nil, fmt.Errorf("marshal commit: %v", err)
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(c.Message)
+	return buf.Bytes(), nil
+}
+
+// Header returns the value of the first extra header with the given key.
+func (c *Commit) Header(key string) (string, bool) {
+	for _, h := range c.ExtraHeaders {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// Summary returns the first line of the commit message.
+func (c *Commit) Summary() string {
+	msg := strings.TrimLeft(c.Message, "\n")
+	if i := strings.IndexByte(msg, '\n'); i != -1 {
+		return msg[:i]
+	}
+	return msg
+}
+
+// A Trailer is a "Key: value" line at the end of a commit message,
+// like "Change-Id: I123" or "Signed-off-by: Name <email>".
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// Trailers returns the trailers in the last paragraph of the commit
+// message. Lines that begin with whitespace continue the previous
+// trailer's value. If any line in the last paragraph is not a trailer,
+// then Trailers returns nil.
+func (c *Commit) Trailers() []Trailer {
+	msg := strings.TrimRight(c.Message, "\n")
+	start := strings.LastIndex(msg, "\n\n")
+	if start == -1 {
+		// The subject line can't hold trailers.
+		return nil
+	}
+	var trailers []Trailer
+	for _, line := range strings.Split(msg[start+2:], "\n") {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			if len(trailers) == 0 {
+				return nil
+			}
+			trailers[len(trailers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 || !isTrailerKey(line[:i]) {
+			return nil
+		}
+		trailers = append(trailers, Trailer{
+			Key:   line[:i],
+			Value: strings.TrimSpace(line[i+1:]),
+		})
+	}
+	return trailers
+}
+
+func isTrailerKey(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// A Tag is a parsed git annotated tag object.
+type Tag struct {
+	Object Hash
+	Type   string // type of the tagged object, like "commit"
+	Name   string
+
+	// Tagger is nil for old tags that don't record who made them.
+	Tagger *Signature
+
+	// ExtraHeaders are the headers after the tagger, in order.
+	ExtraHeaders []Header
+
+	// Message is the tag message, including any signature.
+	Message string
+}
+
+// ParseTag parses the content of a tag object. Any tag that git fsck
+// considers well-formed will be reproduced exactly by MarshalBinary.
+func ParseTag(data []byte) (*Tag, error) {
+	headers, msg, err := splitHeaders(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse tag: %v", err)
+	}
+	if len(headers) < 3 || headers[0].Key != "object" || headers[1].Key != "type" || headers[2].Key != "tag" {
+		return nil, errors.New("parse tag: must start with object, type, and tag headers")
+	}
+	tag := &Tag{
+		Type: headers[1].Value,
+		Name: headers[2].Value,
+	}
+	if tag.Object, err = ParseHash(headers[0].Value); err != nil {
+		return nil, fmt.Errorf("parse tag: object: %v", err)
+	}
+	headers = headers[3:]
+	if len(headers) > 0 && headers[0].Key == "tagger" {
+		sig, err := ParseSignature(headers[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("parse tag: tagger: %v", err)
+		}
+		tag.Tagger = &sig
+		headers = headers[1:]
+	}
+	tag.ExtraHeaders = headers
+	tag.Message = msg
+	return tag, nil
+}
+
+// MarshalBinary returns the content of the tag object.
+func (tag *Tag) MarshalBinary() ([]byte, error) {
+	if tag.Type == "" || strings.ContainsAny(tag.Type, " \n") {
+		return nil, fmt.Errorf("marshal tag: invalid type %q", tag.Type)
+	}
+	if tag.Name == "" || strings.Contains(tag.Name, "\n") {
+		return nil, fmt.Errorf("marshal tag: invalid name %q", tag.Name)
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "object %v\ntype %s\ntag %s\n", tag.Object, tag.Type, tag.Name)
+	if tag.Tagger != nil {
+		if err := tag.Tagger.validate(); err != nil {
+			return nil, fmt.Errorf("marshal tag: tagger: %v", err)
+		}
+		fmt.Fprintf(buf, "tagger %v\n", tag.Tagger)
+	}
+	if err := writeHeaders(buf, tag.ExtraHeaders); err != nil {
+		return nil, fmt.Errorf("marshal tag: %v", err)
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(tag.Message)
+	return buf.Bytes(), nil
+}
+
+// splitHeaders splits a commit or tag object into its headers and
+// message. Header values can span multiple lines: each continuation
+// line starts with a space.
+func splitHeaders(data []byte) ([]Header, string, error) {
+	var headers []Header
+	for {
+		eol := bytes.IndexByte(data, '\n')
+		if eol == -1 {
+			return nil, "", errors.New("missing blank line before message")
+		}
+		line := data[:eol]
+		data = data[eol+1:]
+		if len(line) == 0 {
+			return headers, string(data), nil
+		}
+		if line[0] == ' ' {
+			if len(headers) == 0 {
+				return nil, "", errors.New("continuation line before first header")
+			}
+			headers[len(headers)-1].Value += "\n" + string(line[1:])
+			continue
+		}
+		sp := bytes.IndexByte(line, ' ')
+		if sp <= 0 {
+			return nil, "", fmt.Errorf("malformed header %q", line)
+		}
+		headers = append(headers, Header{Key: string(line[:sp]), Value: string(line[sp+1:])})
+	}
+}
+
+func writeHeaders(buf *bytes.Buffer, headers []Header) error {
+	for _, h := range headers {
+		if h.Key == "" || strings.ContainsAny(h.Key, " \n") {
+			return fmt.Errorf("invalid header key %q", h.Key)
+		}
+		buf.WriteString(h.Key)
+		buf.WriteByte(' ')
+		buf.WriteString(strings.Replace(h.Value, "\n", "\n ", -1))
+		buf.WriteByte('\n')
+	}
+	return nil
+}
+
+// A TreeEntry is a single file or directory in a tree.
+type TreeEntry struct {
+	Mode Mode
+	Name string
+	Hash Hash
+}
+
+// A Mode is the type and permissions of a tree entry.
+type Mode uint32
+
+// Tree entry modes.
+const (
+	ModeTree       Mode = 0040000
+	ModeFile       Mode = 0100644
+	ModeExecutable Mode = 0100755
+	ModeSymlink    Mode = 0120000
+	ModeSubmodule  Mode = 0160000
+)
+
+// String returns the mode in octal, as written in tree objects.
+func (m Mode) String() string {
+	return strconv.FormatUint(uint64(m), 8)
+}
+
+// IsDir reports whether the mode is ModeTree.
+func (m Mode) IsDir() bool {
+	return m == ModeTree
+}
+
+// A Tree is a parsed git tree object.
+type Tree []TreeEntry
+
+// ParseTree parses the content of a tree object whose entries use the
+// given object format, which is the format of the tree's own hash. Any tree that git fsck considers well-formed will
+// be reproduced exactly by MarshalBinary.
+func ParseTree(data []byte, format ObjectFormat) (Tree, error) {
+	size := format.Size()
+	var tree Tree
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		if sp <= 0 {
+			return nil, errors.New("parse tree: missing mode")
+		}
+		modeStr := string(data[:sp])
+		if modeStr[0] == '0' {
+			return nil, fmt.Errorf("parse tree: zero-padded mode %s", modeStr)
+		}
+		mode, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse tree: invalid mode %s", modeStr)
+		}
+		data = data[sp+1:]
+		nul := bytes.IndexByte(data, 0)
+		if nul <= 0 {
+			return nil, errors.New("parse tree: missing name")
+		}
+		name := string(data[:nul])
+		data = data[nul+1:]
+		if len(data) < size {
+			return nil, fmt.Errorf("parse tree: %s: truncated hash", name)
+		}
+		h, err := NewHash(format, data[:size])
+		if err != nil {
+			return nil, fmt.Errorf("parse tree: %s: %v", name, err)
+		}
+		data = data[size:]
+		tree = append(tree, TreeEntry{Mode: Mode(mode), Name: name, Hash: h})
+	}
+	return tree, nil
+}
+
+// MarshalBinary returns the content of the tree object. Entries are
+// written in the order given.
+func (tree Tree) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, ent := range tree {
+		if ent.Name == "" || strings.ContainsAny(ent.Name, "/\x00") {
+			return nil, fmt.Errorf("marshal tree: invalid name %q", ent.Name)
+		}
+		buf.WriteString(ent.Mode.String())
+		buf.WriteByte(' ')
+		buf.WriteString(ent.Name)
+		buf.WriteByte(0)
+		buf.Write(ent.Hash.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// Find returns the entry with the given name or nil if not found.
+func (tree Tree) Find(name string) *TreeEntry {
+	for i := range tree {
+		if tree[i].Name == name {
+			return &tree[i]
+		}
+	}
+	return nil
+}
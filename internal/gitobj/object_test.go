@@ -0,0 +1,399 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitobj
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	testTreeHex   = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	testParentHex = "0123456789abcdef0123456789abcdef01234567"
+	testOtherHex  = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+var commitTests = []struct {
+	name string
+	data string
+}{
+	{
+		name: "Root",
+		data: "tree " + testTreeHex + "\n" +
+			"author Octo Cat <octocat@example.com> 1136239445 -0700\n" +
+			"committer Octo Cat <octocat@example.com> 1136239445 -0700\n" +
+			"\n" +
+			"Initial commit\n",
+	},
+	{
+		name: "Merge",
+		data: "tree " + testTreeHex + "\n" +
+			"parent " + testParentHex + "\n" +
+			"parent " + testOtherHex + "\n" +
+			"author Octo Cat <octocat@example.com> 1136239445 +0530\n" +
+			"committer Another Person <another@example.com> 1136239500 -0000\n" +
+			"\n" +
+			"Merge branch 'feature'\n" +
+			"\n" +
+			"Change-Id: I0123456789abcdef\n",
+	},
+	{
+		name: "ExtraHeaders",
+		data: "tree " + testTreeHex + "\n" +
+			"parent " + testParentHex + "\n" +
+			"author Octo Cat <octocat@example.com> 1136239445 +0000\n" +
+			"committer Octo Cat <octocat@example.com> 1136239445 +0000\n" +
+			"encoding ISO-8859-1\n" +
+			"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+			" \n" +
+			" iQEzBAABCAAdFiEE\n" +
+			" =abcd\n" +
+			" -----END PGP SIGNATURE-----\n" +
+			"\n" +
+			"Signed commit\n",
+	},
+	{
+		name: "EmptyMessage",
+		data: "tree " + testTreeHex + "\n" +
+			"author Octo Cat <> 0 +0000\n" +
+			"committer Octo Cat <> 0 +0000\n" +
+			"\n",
+	},
+	{
+		name: "EmptyName",
+		data: "tree " + testTreeHex + "\n" +
+			"author  <octocat@example.com> 1136239445 -0700\n" +
+			"committer Octo Cat <octocat@example.com> 1136239445 -0700\n" +
+			"\n" +
+			"Commit by an unnamed author\n",
+	},
+	{
+		name: "NoTrailingNewline",
+		data: "tree " + testTreeHex + "\n" +
+			"author Octo Cat <octocat@example.com> 1136239445 -0700\n" +
+			"committer Octo Cat <octocat@example.com> 1136239445 -0700\n" +
+			"\n" +
+			"\n\nMessage with leading blank lines",
+	},
+}
+
+func TestCommitRoundTrip(t *testing.T) {
+	for _, test := range commitTests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := ParseCommit([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.data {
+				t.Errorf("round trip = %q; want %q", got, test.data)
+			}
+		})
+	}
+}
+
+func TestParseCommit(t *testing.T) {
+	c, err := ParseCommit([]byte(commitTests[1].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Tree.String(); got != testTreeHex {
+		t.Errorf("Tree = %s; want %s", got, testTreeHex)
+	}
+	if len(c.Parents) != 2 || c.Parents[0].String() != testParentHex || c.Parents[1].String() != testOtherHex {
+		t.Errorf("Parents = %v; want [%s %s]", c.Parents, testParentHex, testOtherHex)
+	}
+	if c.Author.Name != "Octo Cat" || c.Author.Email != "octocat@example.com" {
+		t.Errorf("Author = %q <%q>; want \"Octo Cat\" <\"octocat@example.com\">", c.Author.Name, c.Author.Email)
+	}
+	if got, want := c.Author.Time, time.Date(2006, time.January, 2, 22, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Author.Time = %v; want %v", got, want)
+	}
+	if _, offset := c.Author.Time.Zone(); offset != 5*60*60+30*60 {
+		t.Errorf("Author.Time zone offset = %d; want %d", offset, 5*60*60+30*60)
+	}
+	if got, want := c.Summary(), "Merge branch 'feature'"; got != want {
+		t.Errorf("Summary() = %q; want %q", got, want)
+	}
+
+	signed, err := ParseCommit([]byte(commitTests[2].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := signed.Header("encoding"); !ok || got != "ISO-8859-1" {
+		t.Errorf("Header(\"encoding\") = %q, %t; want \"ISO-8859-1\", true", got, ok)
+	}
+	const wantSig = "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAdFiEE\n=abcd\n-----END PGP SIGNATURE-----"
+	if got, ok := signed.Header("gpgsig"); !ok || got != wantSig {
+		t.Errorf("Header(\"gpgsig\") = %q, %t; want %q, true", got, ok, wantSig)
+	}
+}
+
+func TestParseCommit_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "Empty",
+			data: "",
+		},
+		{
+			name: "MissingTree",
+			data: "author A <a@example.com> 0 +0000\n" +
+				"committer A <a@example.com> 0 +0000\n" +
+				"\n",
+		},
+		{
+			name: "MissingCommitter",
+			data: "tree " + testTreeHex + "\n" +
+				"author A <a@example.com> 0 +0000\n" +
+				"\n",
+		},
+		{
+			name: "OutOfOrder",
+			data: "tree " + testTreeHex + "\n" +
+				"author A <a@example.com> 0 +0000\n" +
+				"parent " + testParentHex + "\n" +
+				"committer A <a@example.com> 0 +0000\n" +
+				"\n",
+		},
+		{
+			name: "NoBlankLine",
+			data: "tree " + testTreeHex + "\n" +
+				"author A <a@example.com> 0 +0000\n" +
+				"committer A <a@example.com> 0 +0000\n",
+		},
+	}
+	for _, test := range tests {
+		if _, err := ParseCommit([]byte(test.data)); err == nil {
+			t.Errorf("%s: ParseCommit(%q) did not return an error", test.name, test.data)
+		}
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want []Trailer
+	}{
+		{msg: "Subject: not a trailer\n", want: nil},
+		{msg: "Subject\n\nBody text.\n", want: nil},
+		{
+			msg: "Subject\n\nBody text.\n\nChange-Id: I123\nSigned-off-by: A <a@example.com>\n",
+			want: []Trailer{
+				{Key: "Change-Id", Value: "I123"},
+				{Key: "Signed-off-by", Value: "A <a@example.com>"},
+			},
+		},
+		{
+			msg: "Subject\n\nFixes: #1\n  and #2\n",
+			want: []Trailer{
+				{Key: "Fixes", Value: "#1 and #2"},
+			},
+		},
+		{msg: "Subject\n\nChange-Id: I123\nnot a trailer\n", want: nil},
+	}
+	for _, test := range tests {
+		c := &Commit{Message: test.msg}
+		if diff := cmp.Diff(test.want, c.Trailers()); diff != "" {
+			t.Errorf("Commit{Message: %q}.Trailers() (-want +got):\n%s", test.msg, diff)
+		}
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	good := []string{
+		"Octo Cat <octocat@example.com> 1136239445 -0700",
+		"Octo Cat <> 0 +0000",
+		" <octocat@example.com> 1136239445 -0700",
+		"Octo Cat <octocat@example.com> 1136239445 -0000",
+		"Octo Cat <octocat@example.com> 1136239445 +1345",
+	}
+	for _, s := range good {
+		sig, err := ParseSignature(s)
+		if err != nil {
+			t.Errorf("ParseSignature(%q): %v", s, err)
+			continue
+		}
+		if got := sig.String(); got != s {
+			t.Errorf("ParseSignature(%q).String() = %q", s, got)
+		}
+	}
+	bad := []string{
+		"",
+		"<octocat@example.com> 1136239445 -0700",
+		"Octo Cat octocat@example.com 1136239445 -0700",
+		"Octo Cat <octocat@example.com>",
+		"Octo Cat <octocat@example.com> 1136239445",
+		"Octo Cat <octocat@example.com> 01136239445 -0700",
+		"Octo Cat <octocat@example.com> 1136239445 -07",
+		"Octo Cat <octocat@example.com> 1136239445 +0060",
+		"Octo Cat <octocat@example.com> -1 +0000",
+	}
+	for _, s := range bad {
+		if sig, err := ParseSignature(s); err == nil {
+			t.Errorf("ParseSignature(%q) = %+v; want error", s, sig)
+		}
+	}
+}
+
+var tagTests = []struct {
+	name string
+	data string
+}{
+	{
+		name: "Signed",
+		data: "object " + testParentHex + "\n" +
+			"type commit\n" +
+			"tag v1.0.0\n" +
+			"tagger Octo Cat <octocat@example.com> 1136239445 -0700\n" +
+			"\n" +
+			"Release 1.0.0\n" +
+			"-----BEGIN PGP SIGNATURE-----\n" +
+			"\n" +
+			"iQEzBAABCAAdFiEE\n" +
+			"-----END PGP SIGNATURE-----\n",
+	},
+	{
+		name: "NoTagger",
+		data: "object " + testTreeHex + "\n" +
+			"type tree\n" +
+			"tag old-tag\n" +
+			"\n" +
+			"An old tag.\n",
+	},
+	{
+		name: "EmptyTaggerName",
+		data: "object " + testParentHex + "\n" +
+			"type commit\n" +
+			"tag v0.1.0\n" +
+			"tagger  <octocat@example.com> 1136239445 -0700\n" +
+			"\n" +
+			"Release 0.1.0\n",
+	},
+}
+
+func TestTagRoundTrip(t *testing.T) {
+	for _, test := range tagTests {
+		t.Run(test.name, func(t *testing.T) {
+			tag, err := ParseTag([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tag.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.data {
+				t.Errorf("round trip = %q; want %q", got, test.data)
+			}
+		})
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	tag, err := ParseTag([]byte(tagTests[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tag.Object.String(); got != testParentHex {
+		t.Errorf("Object = %s; want %s", got, testParentHex)
+	}
+	if tag.Type != "commit" {
+		t.Errorf("Type = %q; want \"commit\"", tag.Type)
+	}
+	if tag.Name != "v1.0.0" {
+		t.Errorf("Name = %q; want \"v1.0.0\"", tag.Name)
+	}
+	if tag.Tagger == nil || tag.Tagger.Name != "Octo Cat" {
+		t.Errorf("Tagger = %+v; want Octo Cat", tag.Tagger)
+	}
+
+	old, err := ParseTag([]byte(tagTests[1].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Tagger != nil {
+		t.Errorf("Tagger = %+v; want nil", old.Tagger)
+	}
+}
+
+func TestTreeRoundTrip(t *testing.T) {
+	tree, otherHash := mustParseHash(testTreeHex), mustParseHash(testOtherHex)
+	data := "100644 README\x00" + string(otherHash.Bytes()) +
+		"100755 build.sh\x00" + string(otherHash.Bytes()) +
+		"40000 docs\x00" + string(tree.Bytes()) +
+		"120000 link\x00" + string(otherHash.Bytes()) +
+		"160000 vendor\x00" + string(otherHash.Bytes())
+	got, err := ParseTree([]byte(data), SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Tree{
+		{Mode: ModeFile, Name: "README", Hash: otherHash},
+		{Mode: ModeExecutable, Name: "build.sh", Hash: otherHash},
+		{Mode: ModeTree, Name: "docs", Hash: tree},
+		{Mode: ModeSymlink, Name: "link", Hash: otherHash},
+		{Mode: ModeSubmodule, Name: "vendor", Hash: otherHash},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseTree (-want +got):\n%s", diff)
+	}
+	out, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != data {
+		t.Errorf("round trip = %q; want %q", out, data)
+	}
+	if ent := got.Find("docs"); ent == nil || !ent.Mode.IsDir() {
+		t.Errorf("Find(\"docs\") = %+v; want directory", ent)
+	}
+	if ent := got.Find("missing"); ent != nil {
+		t.Errorf("Find(\"missing\") = %+v; want nil", ent)
+	}
+}
+
+func TestParseTree_Errors(t *testing.T) {
+	h := mustParseHash(testOtherHex)
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "ZeroPaddedMode", data: "040000 docs\x00" + string(h.Bytes())},
+		{name: "BadMode", data: "100648 README\x00" + string(h.Bytes())},
+		{name: "MissingName", data: "100644 \x00" + string(h.Bytes())},
+		{name: "TruncatedHash", data: "100644 README\x00" + string(h.Bytes()[:10])},
+	}
+	for _, test := range tests {
+		if _, err := ParseTree([]byte(test.data), SHA1); err == nil {
+			t.Errorf("%s: ParseTree(%q) did not return an error", test.name, test.data)
+		}
+	}
+}
+
+func mustParseHash(s string) Hash {
+	h, err := ParseHash(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
@@ -27,16 +27,16 @@ import (
 // Color returns the ANSI escape sequence for the given configuration
 // setting.
 func (cfg *Config) Color(name string, default_ string) ([]byte, error) {
-	v, ok := cfg.findLast(name)
+	ent, ok := cfg.findLastEntry(name)
 	var desc string
 	if ok {
-		desc = string(v)
+		desc = string(ent.value)
 	} else {
 		desc = default_
 	}
 	seq, err := parseColorDesc(desc)
 	if err != nil {
-		return nil, fmt.Errorf("config %s: %v", name, err)
+		return nil, fmt.Errorf("config %s%s: %v", name, originSuffix(ent), err)
 	}
 	return seq, nil
 }
@@ -240,7 +240,8 @@ func (cfg *Config) ColorBool(name string, isTerm bool) (bool, error) {
 	// Confusingly, git aliases true to "auto". false is "never".
 	// "always" is true.
 
-	v, ok := cfg.findLast(name)
+	ent, ok := cfg.findLastEntry(name)
+	v := ent.value
 	if !ok {
 		if name == "color.ui" {
 			return isTerm, nil
@@ -274,7 +275,7 @@ func (cfg *Config) ColorBool(name string, isTerm bool) (bool, error) {
 	}
 	color, ok := parseBool(v)
 	if !ok {
-		return false, fmt.Errorf("config %s: cannot parse %q as a bool", name, v)
+		return false, fmt.Errorf("config %s%s: cannot parse %q as a bool", name, originSuffix(ent), v)
 	}
 	return color && isTerm, nil
 }
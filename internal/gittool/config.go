@@ -20,68 +20,163 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"os/user"
+	"strconv"
+	"strings"
 )
 
 // Config is a collection of configuration settings.
 type Config struct {
-	first []byte
-	next  [][]byte
+	// entries is every setting in the order git reported them.
+	entries []configEntry
+
+	// index maps a normalized setting name to the index in entries of
+	// its last value.
+	index map[string]int
+
+	// home is the value of $HOME used to expand paths.
+	home string
 }
 
 // ReadConfig reads all the configuration settings from git.
 func ReadConfig(ctx context.Context, git *Tool) (*Config, error) {
-	p, err := git.Start(ctx, "config", "-z", "--list")
+	cfg, err := readConfig(ctx, git, 2)
+	if err == errConfigFlagUnsupported {
+		// --show-scope was added in git 2.26.
+		cfg, err = readConfig(ctx, git, 1)
+	}
+	if err == errConfigFlagUnsupported {
+		// --show-origin was added in git 2.8.
+		cfg, err = readConfig(ctx, git, 0)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("read git config: %v", err)
 	}
-	cfg, parseErr := parseConfig(p)
-	waitErr := p.Wait()
-	if waitErr != nil {
-		return nil, fmt.Errorf("read git config: %v", waitErr)
+	cfg.home = getenv(git.env, "HOME")
+	return cfg, nil
+}
+
+var errConfigFlagUnsupported = errors.New("git config does not support --show-origin or --show-scope")
+
+// readConfig runs git config with the flags that produce prefixFields
+// fields before each entry: 0 for none, 1 for --show-origin, and 2 for
+// --show-origin and --show-scope.
+func readConfig(ctx context.Context, git *Tool, prefixFields int) (*Config, error) {
+	args := []string{"config", "-z", "--list"}
+	if prefixFields >= 1 {
+		args = append(args, "--show-origin")
+	}
+	if prefixFields >= 2 {
+		args = append(args, "--show-scope")
+	}
+	if git.log != nil {
+		git.log(ctx, args)
+	}
+	c := git.cmd(ctx, args)
+	stderr := new(bytes.Buffer)
+	c.Stderr = stderr
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	cfg, parseErr := parseConfig(out, prefixFields)
+	io.Copy(ioutil.Discard, out)
+	if err := c.Wait(); err != nil {
+		if prefixFields >= 2 && bytes.Contains(stderr.Bytes(), []byte("show-scope")) ||
+			prefixFields >= 1 && bytes.Contains(stderr.Bytes(), []byte("show-origin")) {
+			return nil, errConfigFlagUnsupported
+		}
+		if errOut := bytes.TrimRight(stderr.Bytes(), "\n"); len(errOut) > 0 {
+			return nil, fmt.Errorf("%s (%v)", errOut, err)
+		}
+		return nil, err
 	}
 	if parseErr != nil {
-		return nil, fmt.Errorf("read git config: %v", parseErr)
+		return nil, parseErr
 	}
 	return cfg, nil
 }
 
-func parseConfig(r io.Reader) (*Config, error) {
-	const chunkSize = 4096
+// parseConfig parses the output of git config -z --list. prefixFields
+// is the number of NUL-terminated fields before each entry's key,
+// which depends on whether --show-scope and --show-origin were given.
+func parseConfig(r io.Reader, prefixFields int) (*Config, error) {
+	// Entries point into a single buffer, so the buffer is only
+	// allocated once no matter how many settings there are.
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	n := bytes.Count(data, []byte{0})
+	if prefixFields > 0 {
+		n /= prefixFields + 1
+	}
 	cfg := &Config{
-		first: make([]byte, 0, chunkSize),
-	}
-	for buf, off := &cfg.first, 0; ; {
-		n, err := r.Read((*buf)[len(*buf):cap(*buf)])
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		*buf = (*buf)[:len(*buf)+n]
-		for {
-			k, _, end := splitConfigEntry((*buf)[off:])
-			if end == -1 {
-				break
-			}
-			toLower(k)
-			off += end
-		}
-		if len(*buf) == cap(*buf) {
-			if off == 0 {
-				return nil, errors.New("configuration setting too large")
-			}
-			carry := (*buf)[off:]
-			*buf = (*buf)[:off]
-			cfg.next = append(cfg.next, make([]byte, len(carry), chunkSize))
-			buf = &cfg.next[len(cfg.next)-1]
-			off = 0
-			copy(*buf, carry)
-		}
-		if err == io.EOF {
-			break
+		entries: make([]configEntry, 0, n),
+		index:   make(map[string]int, n),
+	}
+	for len(data) > 0 {
+		ent, end := splitConfigRecord(data, prefixFields)
+		if end == -1 {
+			return nil, errors.New("parse config: unterminated entry")
+		}
+		data = data[end:]
+		normalizeConfigKey(ent.key)
+		ent.prev = -1
+		if i, ok := cfg.index[string(ent.key)]; ok {
+			ent.prev = i
 		}
+		cfg.index[string(ent.key)] = len(cfg.entries)
+		cfg.entries = append(cfg.entries, ent)
 	}
 	return cfg, nil
 }
 
+// A configEntry is a single configuration setting in the output of
+// git config -z --list.
+type configEntry struct {
+	scope  []byte
+	origin []byte
+	key    []byte
+	value  []byte // nil if the setting had no equals sign
+
+	// prev is the index of the previous value of the same setting in
+	// Config.entries or -1 if this is the first value.
+	prev int
+}
+
+// splitConfigRecord parses the next entry with the given number of
+// prefix fields. end is -1 if b does not contain a complete entry.
+func splitConfigRecord(b []byte, prefixFields int) (ent configEntry, end int) {
+	var prefix [2][]byte
+	off := 0
+	for i := 0; i < prefixFields; i++ {
+		n := bytes.IndexByte(b[off:], 0)
+		if n == -1 {
+			return configEntry{}, -1
+		}
+		prefix[i] = b[off : off+n]
+		off += n + 1
+	}
+	switch prefixFields {
+	case 1:
+		ent.origin = prefix[0]
+	case 2:
+		ent.scope, ent.origin = prefix[0], prefix[1]
+	}
+	k, v, n := splitConfigEntry(b[off:])
+	if n == -1 {
+		return configEntry{}, -1
+	}
+	ent.key, ent.value = k, v
+	return ent, off + n
+}
+
 // splitConfigEntry parses the next zero-terminated config entry, as in
 // output from git config -z --list. If v == nil, then the configuration
 // setting had no equals sign (usually means true for a boolean).
@@ -110,6 +205,42 @@ func splitConfigEntry(b []byte) (k, v []byte, end int) {
 	return b[:kEnd], b[kEnd+1 : vEnd], vEnd + 1
 }
 
+// normalizeConfigKey converts the section and variable name of a
+// "section.subsection.variable" key to lowercase in place. Subsection
+// names are case-sensitive, so they are left alone.
+func normalizeConfigKey(k []byte) {
+	first := bytes.IndexByte(k, '.')
+	last := bytes.LastIndexByte(k, '.')
+	if first == -1 {
+		toLower(k)
+		return
+	}
+	toLower(k[:first])
+	toLower(k[last+1:])
+}
+
+// normalizeConfigName is like normalizeConfigKey, but returns a new
+// string. It does not allocate if name is already normalized.
+func normalizeConfigName(name string) string {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+	if !hasUpper(name[:first+1]) && !hasUpper(name[last+1:]) {
+		return name
+	}
+	b := []byte(name)
+	normalizeConfigKey(b)
+	return string(b)
+}
+
+func hasUpper(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
 // Value returns the string value of the configuration setting with the
 // given name.
 func (cfg *Config) Value(name string) string {
@@ -119,49 +250,251 @@ func (cfg *Config) Value(name string) string {
 
 // Bool returns the boolean configuration setting with the given name.
 func (cfg *Config) Bool(name string) (bool, error) {
-	v, ok := cfg.findLast(name)
+	ent, ok := cfg.findLastEntry(name)
 	if !ok {
 		return false, fmt.Errorf("config %s: not found", name)
 	}
-	if v == nil {
+	if ent.value == nil {
 		// No equals sign, which implies true.
 		return true, nil
 	}
-	b, ok := parseBool(v)
+	b, ok := parseBool(ent.value)
 	if !ok {
-		return false, fmt.Errorf("config %s: cannot parse %q as a bool", name, v)
+		return false, fmt.Errorf("config %s%s: cannot parse %q as a bool", name, originSuffix(ent), ent.value)
 	}
 	return b, nil
 }
 
-func (cfg *Config) findLast(name string) (value []byte, found bool) {
-	norm := []byte(name)
-	toLower(norm)
-	for i := 0; i < len(cfg.first); {
-		k, v, end := splitConfigEntry(cfg.first[i:])
-		if end == -1 {
-			break
+// Int returns the integer configuration setting with the given name.
+// Like git, Int accepts a "k", "m", or "g" suffix to multiply the value
+// by 1024, 1024², or 1024³.
+func (cfg *Config) Int(name string) (int64, error) {
+	ent, ok := cfg.findLastEntry(name)
+	if !ok {
+		return 0, fmt.Errorf("config %s: not found", name)
+	}
+	n, ok := parseInt(ent.value)
+	if !ok {
+		return 0, fmt.Errorf("config %s%s: cannot parse %q as an integer", name, originSuffix(ent), ent.value)
+	}
+	return n, nil
+}
+
+// Path returns the path configuration setting with the given name.
+// Like git, Path expands a leading "~/" to the user's home directory
+// and "~user/" to the named user's home directory.
+func (cfg *Config) Path(name string) (string, error) {
+	ent, ok := cfg.findLastEntry(name)
+	if !ok {
+		return "", fmt.Errorf("config %s: not found", name)
+	}
+	path, err := expandPath(string(ent.value), cfg.home)
+	if err != nil {
+		return "", fmt.Errorf("config %s%s: %v", name, originSuffix(ent), err)
+	}
+	return path, nil
+}
+
+// A ConfigValue is a single value of a configuration setting.
+type ConfigValue struct {
+	Value  string
+	Origin ConfigOrigin
+}
+
+// A ConfigOrigin describes where a configuration value was set.
+type ConfigOrigin struct {
+	// Scope is "system", "global", "local", "worktree", or "command".
+	// It is empty if git is too old to report scopes.
+	Scope string
+
+	// Type is the kind of source, like "file", "command line", or
+	// "blob". Name is the path of the file or the name of the blob.
+	Type string
+	Name string
+}
+
+// String returns the origin in a form suitable for error messages,
+// like "file .git/config".
+func (o ConfigOrigin) String() string {
+	if o.Name == "" {
+		return o.Type
+	}
+	return o.Type + " " + o.Name
+}
+
+func parseOrigin(scope, origin []byte) ConfigOrigin {
+	o := ConfigOrigin{Scope: string(scope), Type: string(origin)}
+	if i := bytes.IndexByte(origin, ':'); i != -1 {
+		o.Type = string(origin[:i])
+		o.Name = string(origin[i+1:])
+	}
+	return o
+}
+
+// originSuffix returns a description of where the entry was set for
+// use in error messages.
+func originSuffix(ent configEntry) string {
+	if len(ent.origin) == 0 {
+		return ""
+	}
+	return " (from " + parseOrigin(ent.scope, ent.origin).String() + ")"
+}
+
+// Origin returns where the value returned by Value for the given name
+// was set. It returns the zero ConfigOrigin if the setting does not
+// exist.
+func (cfg *Config) Origin(name string) ConfigOrigin {
+	ent, ok := cfg.findLastEntry(name)
+	if !ok {
+		return ConfigOrigin{}
+	}
+	return parseOrigin(ent.scope, ent.origin)
+}
+
+// All returns all the values of the configuration setting with the
+// given name, in the order git read them.
+func (cfg *Config) All(name string) []ConfigValue {
+	last, ok := cfg.index[normalizeConfigName(name)]
+	if !ok {
+		return nil
+	}
+	n := 0
+	for i := last; i != -1; i = cfg.entries[i].prev {
+		n++
+	}
+	values := make([]ConfigValue, n)
+	for i := last; i != -1; i = cfg.entries[i].prev {
+		n--
+		ent := cfg.entries[i]
+		values[n] = ConfigValue{
+			Value:  string(ent.value),
+			Origin: parseOrigin(ent.scope, ent.origin),
+		}
+	}
+	return values
+}
+
+// Subsections returns the names of the subsections of the given
+// section that have at least one setting, in the order they first
+// appear. For example, Subsections("remote") returns the names of the
+// configured remotes.
+func (cfg *Config) Subsections(section string) []string {
+	prefix := []byte(section + ".")
+	toLower(prefix)
+	var names []string
+	seen := make(map[string]bool)
+	for _, ent := range cfg.entries {
+		if !bytes.HasPrefix(ent.key, prefix) {
+			continue
+		}
+		rest := ent.key[len(prefix):]
+		i := bytes.LastIndexByte(rest, '.')
+		if i == -1 {
+			// A variable directly in the section.
+			continue
+		}
+		if !seen[string(rest[:i])] {
+			name := string(rest[:i])
+			seen[name] = true
+			names = append(names, name)
 		}
-		if bytes.Equal(k, norm) {
-			value = v
-			found = true
+	}
+	return names
+}
+
+// Variables returns the names of the variables in the given section
+// that have at least one setting, in the order they first appear.
+// section may include a subsection, like "branch.master". For example,
+// Variables("branch.master") returns the names of the settings for the
+// master branch, like "remote" and "merge".
+func (cfg *Config) Variables(section string) []string {
+	prefix := []byte(section + ".")
+	if i := bytes.IndexByte(prefix, '.'); i != -1 {
+		toLower(prefix[:i])
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, ent := range cfg.entries {
+		if !bytes.HasPrefix(ent.key, prefix) {
+			continue
 		}
-		i += end
+		rest := ent.key[len(prefix):]
+		if bytes.IndexByte(rest, '.') != -1 {
+			// A variable in a subsection of the section.
+			continue
+		}
+		if !seen[string(rest)] {
+			name := string(rest)
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (cfg *Config) findLast(name string) (value []byte, found bool) {
+	ent, found := cfg.findLastEntry(name)
+	return ent.value, found
+}
+
+func (cfg *Config) findLastEntry(name string) (ent configEntry, found bool) {
+	i, ok := cfg.index[normalizeConfigName(name)]
+	if !ok {
+		return configEntry{}, false
+	}
+	return cfg.entries[i], true
+}
+
+// parseInt parses an integer with an optional unit suffix, as in git's
+// git_parse_signed.
+func parseInt(v []byte) (int64, bool) {
+	if len(v) == 0 {
+		return 0, false
+	}
+	s := string(v)
+	var factor int64 = 1
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		factor = 1 << 10
+	case 'm', 'M':
+		factor = 1 << 20
+	case 'g', 'G':
+		factor = 1 << 30
+	}
+	if factor != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
 	}
-	for _, buf := range cfg.next {
-		for i := 0; i < len(cfg.first); {
-			k, v, end := splitConfigEntry(buf[i:])
-			if end == -1 {
-				break
-			}
-			if bytes.Equal(k, norm) {
-				value = v
-				found = true
-			}
-			i += end
+	if n > math.MaxInt64/factor || n < math.MinInt64/factor {
+		return 0, false
+	}
+	return n * factor, true
+}
+
+// expandPath expands a leading tilde in a path, as in git's
+// expand_user_path.
+func expandPath(path string, home string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	name, rest := path[1:], ""
+	if i := strings.IndexByte(name, '/'); i != -1 {
+		name, rest = name[:i], name[i:]
+	}
+	if name == "" {
+		if home == "" {
+			return "", errors.New("cannot expand ~: $HOME not set")
 		}
+		return home + rest, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("cannot expand ~%s: %v", name, err)
 	}
-	return
+	return u.HomeDir + rest, nil
 }
 
 func parseBool(v []byte) (_ bool, ok bool) {
@@ -16,15 +16,20 @@ package gittool
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestParseConfig(t *testing.T) {
 	bigPrefix := strings.Repeat("spam\neggs\x00", 1024)
+	longValue := strings.Repeat("x", 100000)
 	tests := []struct {
 		config string
 		name   string
@@ -40,9 +45,13 @@ func TestParseConfig(t *testing.T) {
 		{bigPrefix + "foo\nbar\x00baz\nquux\x00", "foo", "bar"},
 		{bigPrefix + "foo\nbar\x00baz\nquux\x00", "baz", "quux"},
 		{bigPrefix + "foo\nbar\x00baz\nquux\x00", "salad", ""},
+		{bigPrefix + "foo\n" + longValue + "\x00baz\nquux\x00", "foo", longValue},
+		{bigPrefix + "foo\n" + longValue + "\x00baz\nquux\x00", "baz", "quux"},
+		{"foo\nbar\x00" + bigPrefix + "Foo\nbaz\x00", "FOO", "baz"},
+		{"foo\nbar\x00" + bigPrefix, "foo", "bar"},
 	}
 	for _, test := range tests {
-		cfg, err := parseConfig(strings.NewReader(test.config))
+		cfg, err := parseConfig(strings.NewReader(test.config), 0)
 		if err != nil {
 			t.Errorf("parseConfig(%q): %v", test.config, err)
 			continue
@@ -53,7 +62,7 @@ func TestParseConfig(t *testing.T) {
 	}
 	t.Run("DataErr", func(t *testing.T) {
 		for _, test := range tests {
-			cfg, err := parseConfig(iotest.DataErrReader(strings.NewReader(test.config)))
+			cfg, err := parseConfig(iotest.DataErrReader(strings.NewReader(test.config)), 0)
 			if err != nil {
 				t.Errorf("parseConfig(%q): %v", test.config, err)
 				continue
@@ -65,7 +74,7 @@ func TestParseConfig(t *testing.T) {
 	})
 	t.Run("Half", func(t *testing.T) {
 		for _, test := range tests {
-			cfg, err := parseConfig(iotest.HalfReader(strings.NewReader(test.config)))
+			cfg, err := parseConfig(iotest.HalfReader(strings.NewReader(test.config)), 0)
 			if err != nil {
 				t.Errorf("parseConfig(%q): %v", test.config, err)
 				continue
@@ -77,7 +86,7 @@ func TestParseConfig(t *testing.T) {
 	})
 	t.Run("OneByte", func(t *testing.T) {
 		for _, test := range tests {
-			cfg, err := parseConfig(iotest.OneByteReader(strings.NewReader(test.config)))
+			cfg, err := parseConfig(iotest.OneByteReader(strings.NewReader(test.config)), 0)
 			if err != nil {
 				t.Errorf("parseConfig(%q): %v", test.config, err)
 				continue
@@ -216,6 +225,200 @@ func TestConfigBool(t *testing.T) {
 	}
 }
 
+func TestParseConfigOrigin(t *testing.T) {
+	const config = "global\x00file:/home/user/.gitconfig\x00Remote.origin.URL\nhttps://example.com/a.git\x00" +
+		"local\x00file:.git/config\x00remote.Upstream.url\nhttps://example.com/b.git\x00" +
+		"local\x00file:.git/config\x00remote.origin.url\nhttps://example.com/c.git\x00" +
+		"command\x00command line:\x00core.bare\nfalse\x00"
+	cfg, err := parseConfig(strings.NewReader(config), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAll := []ConfigValue{
+		{
+			Value:  "https://example.com/a.git",
+			Origin: ConfigOrigin{Scope: "global", Type: "file", Name: "/home/user/.gitconfig"},
+		},
+		{
+			Value:  "https://example.com/c.git",
+			Origin: ConfigOrigin{Scope: "local", Type: "file", Name: ".git/config"},
+		},
+	}
+	if diff := cmp.Diff(wantAll, cfg.All("remote.origin.url")); diff != "" {
+		t.Errorf("All(\"remote.origin.url\") (-want +got):\n%s", diff)
+	}
+	if got := cfg.All("remote.upstream.url"); len(got) != 0 {
+		t.Errorf("All(\"remote.upstream.url\") = %+v; want []", got)
+	}
+	if diff := cmp.Diff([]string{"origin", "Upstream"}, cfg.Subsections("REMOTE")); diff != "" {
+		t.Errorf("Subsections(\"REMOTE\") (-want +got):\n%s", diff)
+	}
+	wantOrigin := ConfigOrigin{Scope: "command", Type: "command line"}
+	if got := cfg.Origin("core.bare"); got != wantOrigin {
+		t.Errorf("Origin(\"core.bare\") = %+v; want %+v", got, wantOrigin)
+	}
+	if got := cfg.Origin("core.missing"); got != (ConfigOrigin{}) {
+		t.Errorf("Origin(\"core.missing\") = %+v; want zero", got)
+	}
+}
+
+func TestConfigVariables(t *testing.T) {
+	const config = "branch.Main.remote\norigin\x00" +
+		"branch.Main.merge\nrefs/heads/main\x00" +
+		"branch.main.merge\nrefs/heads/other\x00" +
+		"branch.Main.merge\nrefs/heads/next\x00" +
+		"branch.Main.x.rebase\ntrue\x00" +
+		"Gg.alias.st\nstatus\x00"
+	cfg, err := parseConfig(strings.NewReader(config), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		section string
+		want    []string
+	}{
+		{section: "BRANCH.Main", want: []string{"remote", "merge"}},
+		{section: "branch.main", want: []string{"merge"}},
+		{section: "branch.Main.x", want: []string{"rebase"}},
+		{section: "gg.alias", want: []string{"st"}},
+		{section: "branch", want: nil},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, cfg.Variables(test.section)); diff != "" {
+			t.Errorf("Variables(%q) (-want +got):\n%s", test.section, diff)
+		}
+	}
+}
+
+func TestParseConfigMultiValue(t *testing.T) {
+	var config strings.Builder
+	var want []ConfigValue
+	for i := 0; i < 5000; i++ {
+		v := strconv.Itoa(i)
+		fmt.Fprintf(&config, "foo.Bar\n%s\x00other.key%d\nx\x00", v, i)
+		want = append(want, ConfigValue{Value: v})
+	}
+	cfg, err := parseConfig(strings.NewReader(config.String()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, cfg.All("FOO.bar")); diff != "" {
+		t.Errorf("All(\"FOO.bar\") (-want +got):\n%s", diff)
+	}
+	if got := cfg.Value("other.key4999"); got != "x" {
+		t.Errorf("Value(\"other.key4999\") = %q; want \"x\"", got)
+	}
+}
+
+func TestParseConfigUnterminated(t *testing.T) {
+	if _, err := parseConfig(strings.NewReader("foo\nbar\x00baz\nquux"), 0); err == nil {
+		t.Error("parseConfig did not return an error")
+	}
+}
+
+func TestConfigInt(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "42", want: 42},
+		{value: "-7", want: -7},
+		{value: "1k", want: 1024},
+		{value: "3M", want: 3 << 20},
+		{value: "2g", want: 2 << 30},
+		{value: "", wantErr: true},
+		{value: "k", wantErr: true},
+		{value: "1t", wantErr: true},
+		{value: "9999999999g", wantErr: true},
+	}
+	for _, test := range tests {
+		cfg, err := parseConfig(strings.NewReader("file:.git/config\x00foo.bar\n"+test.value+"\x00"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := cfg.Int("foo.bar")
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("Int(%q): %v", test.value, err)
+			} else if !strings.Contains(err.Error(), ".git/config") {
+				t.Errorf("Int(%q) error = %q; want to mention origin", test.value, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("Int(%q) = %d, <nil>; want error", test.value, got)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Int(%q) = %d; want %d", test.value, got, test.want)
+		}
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"/etc/gitignore", "/etc/gitignore"},
+		{"relative/path", "relative/path"},
+		{"~", "/home/anna"},
+		{"~/.gitignore", "/home/anna/.gitignore"},
+	}
+	for _, test := range tests {
+		cfg, err := parseConfig(strings.NewReader("foo.bar\n"+test.value+"\x00"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.home = "/home/anna"
+		got, err := cfg.Path("foo.bar")
+		if err != nil {
+			t.Errorf("Path(%q): %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Path(%q) = %q; want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestReadConfigOrigin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	globalPath := filepath.Join(env.root, ".gitconfig")
+	err = ioutil.WriteFile(globalPath, []byte("[color]\n\tui = bogus\n[core]\n\tbigFileThreshold = 2m\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig(ctx, env.git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Origin("color.ui"); got.Type != "file" || got.Name != globalPath {
+		t.Errorf("Origin(\"color.ui\") = %+v; want file %s", got, globalPath)
+	}
+	if _, err := cfg.Bool("color.ui"); err == nil {
+		t.Error("Bool(\"color.ui\") did not return an error")
+	} else if !strings.Contains(err.Error(), globalPath) {
+		t.Errorf("Bool(\"color.ui\") error = %q; want to mention %s", err, globalPath)
+	}
+	if got, err := cfg.Int("core.bigfilethreshold"); err != nil || got != 2<<20 {
+		t.Errorf("Int(\"core.bigfilethreshold\") = %d, %v; want %d, <nil>", got, err, 2<<20)
+	}
+}
+
 func BenchmarkReadConfig(b *testing.B) {
 	if testing.Short() {
 		b.Skip("skipping due to -short")
@@ -289,3 +492,59 @@ func BenchmarkOneConfigLine(b *testing.B) {
 		env.git.RunOneLiner(ctx, '\n', "config", "user.email")
 	}
 }
+
+// largeConfig returns the output of git config -z --list --show-origin
+// --show-scope for a configuration with n remotes and n branches.
+func largeConfig(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		const prefix = "local\x00file:.git/config\x00"
+		fmt.Fprintf(&sb, "%sremote.r%d.url\nhttps://example.com/%d.git\x00", prefix, i, i)
+		fmt.Fprintf(&sb, "%sremote.r%d.fetch\n+refs/heads/*:refs/remotes/r%d/*\x00", prefix, i, i)
+		fmt.Fprintf(&sb, "%sbranch.b%d.remote\nr%d\x00", prefix, i, i)
+		fmt.Fprintf(&sb, "%sbranch.b%d.merge\nrefs/heads/b%d\x00", prefix, i, i)
+	}
+	return sb.String()
+}
+
+func BenchmarkParseConfig(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		b.Run(strconv.Itoa(n*4), func(b *testing.B) {
+			config := largeConfig(n)
+			b.SetBytes(int64(len(config)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := parseConfig(strings.NewReader(config), 2); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkConfigValue(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		b.Run(strconv.Itoa(n*4), func(b *testing.B) {
+			cfg, err := parseConfig(strings.NewReader(largeConfig(n)), 2)
+			if err != nil {
+				b.Fatal(err)
+			}
+			name := fmt.Sprintf("branch.b%d.merge", n/2)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cfg.Value(name)
+			}
+		})
+	}
+}
+
+func BenchmarkConfigSubsections(b *testing.B) {
+	cfg, err := parseConfig(strings.NewReader(largeConfig(1000)), 2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg.Subsections("remote")
+	}
+}
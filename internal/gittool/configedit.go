@@ -0,0 +1,315 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A ConfigScope identifies the configuration file that a write
+// modifies. The zero value is the same as LocalScope.
+type ConfigScope struct {
+	flag string
+	file string
+}
+
+// Configuration scopes.
+var (
+	// LocalScope is the repository's configuration file, .git/config.
+	LocalScope = ConfigScope{flag: "--local"}
+
+	// GlobalScope is the user's configuration file, ~/.gitconfig.
+	GlobalScope = ConfigScope{flag: "--global"}
+
+	// WorktreeScope is the current working tree's configuration file,
+	// .git/config.worktree. git only reads it if the
+	// extensions.worktreeConfig setting is true.
+	WorktreeScope = ConfigScope{flag: "--worktree"}
+)
+
+// FileScope returns the scope of the configuration file at the given
+// path.
+func FileScope(path string) ConfigScope {
+	return ConfigScope{flag: "--file", file: path}
+}
+
+func (scope ConfigScope) args() []string {
+	switch {
+	case scope.flag == "":
+		return []string{"--local"}
+	case scope.file != "":
+		return []string{scope.flag, scope.file}
+	default:
+		return []string{scope.flag}
+	}
+}
+
+// String returns the scope's git config flag, like "--local".
+func (scope ConfigScope) String() string {
+	return strings.Join(scope.args(), " ")
+}
+
+// SetConfig sets the configuration setting with the given name to a
+// single value, replacing any existing values.
+func SetConfig(ctx context.Context, git *Tool, scope ConfigScope, name, value string) error {
+	return configSet(name, value).run(ctx, git, scope)
+}
+
+// UnsetConfig removes all values of the configuration setting with the
+// given name. It is not an error if the setting does not exist.
+func UnsetConfig(ctx context.Context, git *Tool, scope ConfigScope, name string) error {
+	return configUnset(name).run(ctx, git, scope)
+}
+
+// RenameSection renames a configuration section, like
+// "branch.foo" or "remote.origin".
+func RenameSection(ctx context.Context, git *Tool, scope ConfigScope, old, new string) error {
+	return configRenameSection(old, new).run(ctx, git, scope)
+}
+
+// RemoveSection removes a configuration section and all its settings.
+func RemoveSection(ctx context.Context, git *Tool, scope ConfigScope, name string) error {
+	return configRemoveSection(name).run(ctx, git, scope)
+}
+
+// A ConfigEditor records changes to a configuration file and applies
+// them all at once. If any change fails, none of them are applied.
+// The zero value is not usable; use NewConfigEditor.
+type ConfigEditor struct {
+	git   *Tool
+	scope ConfigScope
+	edits []configEdit
+}
+
+// NewConfigEditor returns an editor with no changes for the
+// configuration file of the given scope.
+func NewConfigEditor(git *Tool, scope ConfigScope) *ConfigEditor {
+	return &ConfigEditor{git: git, scope: scope}
+}
+
+// Set sets the configuration setting with the given name to a single
+// value, replacing any existing values.
+func (e *ConfigEditor) Set(name, value string) {
+	e.edits = append(e.edits, configSet(name, value))
+}
+
+// Add adds a value to the configuration setting with the given name,
+// keeping any existing values.
+func (e *ConfigEditor) Add(name, value string) {
+	e.edits = append(e.edits, configEdit{args: []string{"--add", "--", name, value}})
+}
+
+// Unset removes all values of the configuration setting with the given
+// name. It is not an error if the setting does not exist.
+func (e *ConfigEditor) Unset(name string) {
+	e.edits = append(e.edits, configUnset(name))
+}
+
+// RenameSection renames a configuration section.
+func (e *ConfigEditor) RenameSection(old, new string) {
+	e.edits = append(e.edits, configRenameSection(old, new))
+}
+
+// RemoveSection removes a configuration section and all its settings.
+func (e *ConfigEditor) RemoveSection(name string) {
+	e.edits = append(e.edits, configRemoveSection(name))
+}
+
+// Commit applies the recorded changes. The changes are made to a copy
+// of the configuration file that replaces the original once every
+// change succeeds. While Commit runs, the file is locked the same way
+// git locks it, so concurrent git commands that modify the file will
+// fail instead of losing changes.
+func (e *ConfigEditor) Commit(ctx context.Context) error {
+	if len(e.edits) == 0 {
+		return nil
+	}
+	path, err := e.scope.path(ctx, e.git)
+	if err != nil {
+		return fmt.Errorf("edit config: %v", err)
+	}
+	lockPath := path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return fmt.Errorf("edit config: %s is locked by another process", path)
+	}
+	if err != nil {
+		return fmt.Errorf("edit config: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(lockPath)
+		}
+	}()
+	err = copyConfigFile(lock, path)
+	closeErr := lock.Close()
+	if err != nil {
+		return fmt.Errorf("edit config: %v", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("edit config: %v", closeErr)
+	}
+	for _, edit := range e.edits {
+		if err := edit.run(ctx, e.git, FileScope(lockPath)); err != nil {
+			return fmt.Errorf("edit config: %v", err)
+		}
+	}
+	if err := os.Rename(lockPath, path); err != nil {
+		return fmt.Errorf("edit config: %v", err)
+	}
+	committed = true
+	e.edits = nil
+	return nil
+}
+
+// copyConfigFile copies the content and permissions of the file at
+// path to dst. A missing file is treated as empty.
+func copyConfigFile(dst *os.File, path string) error {
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if info, err := src.Stat(); err == nil {
+		if err := dst.Chmod(info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// path returns the path of the configuration file for the scope.
+func (scope ConfigScope) path(ctx context.Context, git *Tool) (string, error) {
+	switch scope.flag {
+	case "--file":
+		if filepath.IsAbs(scope.file) {
+			return scope.file, nil
+		}
+		return filepath.Join(git.dir, scope.file), nil
+	case "--global":
+		// Like git, prefer ~/.gitconfig unless only the XDG file exists.
+		home := getenv(git.env, "HOME")
+		if home == "" {
+			return "", errors.New("global config: $HOME not set")
+		}
+		path := filepath.Join(home, ".gitconfig")
+		if fileExists(path) {
+			return path, nil
+		}
+		xdgHome := getenv(git.env, "XDG_CONFIG_HOME")
+		if xdgHome == "" {
+			xdgHome = filepath.Join(home, ".config")
+		}
+		if xdgPath := filepath.Join(xdgHome, "git", "config"); fileExists(xdgPath) {
+			return xdgPath, nil
+		}
+		return path, nil
+	}
+	name := "config"
+	if scope.flag == "--worktree" {
+		name = "config.worktree"
+	}
+	path, err := git.RunOneLiner(ctx, '\n', "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(string(path)) {
+		return filepath.Join(git.dir, string(path)), nil
+	}
+	return string(path), nil
+}
+
+// getenv returns the value of the environment variable with the given
+// name in env.
+func getenv(env []string, name string) string {
+	var val string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			// Later entries take precedence, as in os/exec.
+			val = kv[len(name)+1:]
+		}
+	}
+	return val
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// A configEdit is a single invocation of git config that modifies a
+// configuration file.
+type configEdit struct {
+	args []string
+
+	// missingOK is true if a setting not existing is not an error.
+	missingOK bool
+}
+
+func configSet(name, value string) configEdit {
+	return configEdit{args: []string{"--replace-all", "--", name, value}}
+}
+
+func configUnset(name string) configEdit {
+	return configEdit{args: []string{"--unset-all", "--", name}, missingOK: true}
+}
+
+func configRenameSection(old, new string) configEdit {
+	return configEdit{args: []string{"--rename-section", "--", old, new}}
+}
+
+func configRemoveSection(name string) configEdit {
+	return configEdit{args: []string{"--remove-section", "--", name}}
+}
+
+func (edit configEdit) run(ctx context.Context, git *Tool, scope ConfigScope) error {
+	// From git-config(1): exit status 5 means that an unset was
+	// attempted on a setting that does not exist.
+	const missingStatus = 5
+
+	args := append([]string{"config"}, scope.args()...)
+	args = append(args, edit.args...)
+	if git.log != nil {
+		git.log(ctx, args)
+	}
+	c := git.cmd(ctx, args)
+	stderr := new(bytes.Buffer)
+	c.Stderr = stderr
+	err := c.Run()
+	if err == nil {
+		return nil
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return fmt.Errorf("run %s: %v", errorSubject(args), err)
+	}
+	if edit.missingOK && exitStatus(exitErr.ProcessState) == missingStatus {
+		return nil
+	}
+	return wrapErrorOutput(errorSubject(args), exitErr, stderr.Bytes(), nil, false)
+}
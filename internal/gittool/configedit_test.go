@@ -0,0 +1,180 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigWrite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	git := env.git.WithDir(filepath.Join(env.root, "repo"))
+
+	if err := SetConfig(ctx, git, LocalScope, "foo.bar", "-starts with dash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(ctx, git, GlobalScope, "foo.global", "yes"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(ctx, git, LocalScope, "foo.baz", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnsetConfig(ctx, git, LocalScope, "foo.baz"); err != nil {
+		t.Error("UnsetConfig(foo.baz):", err)
+	}
+	if err := UnsetConfig(ctx, git, LocalScope, "foo.missing"); err != nil {
+		t.Error("UnsetConfig(foo.missing):", err)
+	}
+	if err := RenameSection(ctx, git, LocalScope, "foo", "qux"); err != nil {
+		t.Error("RenameSection:", err)
+	}
+	if err := RemoveSection(ctx, git, LocalScope, "nonexistent"); err == nil {
+		t.Error("RemoveSection(nonexistent) did not return an error")
+	}
+	cfg, err := ReadConfig(ctx, git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"qux.bar", "-starts with dash"},
+		{"foo.bar", ""},
+		{"qux.baz", ""},
+		{"foo.global", "yes"},
+	}
+	for _, test := range tests {
+		if got := cfg.Value(test.name); got != test.want {
+			t.Errorf("after writes, %s = %q; want %q", test.name, got, test.want)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(env.root, ".gitconfig")); err != nil {
+		t.Error(err)
+	} else if len(data) == 0 {
+		t.Error("global config file is empty")
+	}
+}
+
+func TestConfigEditor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(env.root, "repo")
+	git := env.git.WithDir(repo)
+	if err := SetConfig(ctx, git, LocalScope, "section.keep", "original"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		e := NewConfigEditor(git, LocalScope)
+		e.Set("branch.foo.remote", "origin")
+		e.Add("branch.foo.merge", "refs/heads/a")
+		e.Add("branch.foo.merge", "refs/heads/b")
+		e.Unset("branch.foo.missing")
+		e.RenameSection("branch.foo", "branch.bar")
+		if err := e.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := ReadConfig(ctx, git)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Value("branch.bar.remote"); got != "origin" {
+			t.Errorf("branch.bar.remote = %q; want \"origin\"", got)
+		}
+		if got := cfg.Value("branch.bar.merge"); got != "refs/heads/b" {
+			t.Errorf("branch.bar.merge = %q; want \"refs/heads/b\"", got)
+		}
+		if got := cfg.Value("section.keep"); got != "original" {
+			t.Errorf("section.keep = %q; want \"original\"", got)
+		}
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		e := NewConfigEditor(git, LocalScope)
+		e.Set("section.keep", "changed")
+		e.RemoveSection("nonexistent")
+		if err := e.Commit(ctx); err == nil {
+			t.Error("Commit did not return an error")
+		}
+		cfg, err := ReadConfig(ctx, git)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Value("section.keep"); got != "original" {
+			t.Errorf("section.keep = %q; want \"original\"", got)
+		}
+		if _, err := os.Stat(filepath.Join(repo, ".git", "config.lock")); !os.IsNotExist(err) {
+			t.Errorf("config.lock exists after failed commit (err = %v)", err)
+		}
+	})
+	t.Run("Locked", func(t *testing.T) {
+		lockPath := filepath.Join(repo, ".git", "config.lock")
+		if err := ioutil.WriteFile(lockPath, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(lockPath)
+		e := NewConfigEditor(git, LocalScope)
+		e.Set("section.keep", "changed")
+		if err := e.Commit(ctx); err == nil {
+			t.Error("Commit did not return an error")
+		}
+	})
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(env.root, "custom.config")
+		e := NewConfigEditor(git, FileScope(path))
+		e.Set("custom.setting", "value")
+		if err := e.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "[custom]\n\tsetting = value\n"; string(data) != want {
+			t.Errorf("%s content = %q; want %q", path, data, want)
+		}
+	})
+}
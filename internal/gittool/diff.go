@@ -0,0 +1,786 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+// DiffReader is a handle to a running `git diff` command.
+type DiffReader struct {
+	p      *Process
+	r      *bufio.Reader
+	cancel context.CancelFunc
+
+	// line is the next unconsumed line of output if hasLine is true.
+	line    string
+	hasLine bool
+
+	scanned bool
+	file    FileDiff
+	err     error
+}
+
+// DiffOptions specifies the changes that Diff compares and how they
+// are compared.
+type DiffOptions struct {
+	// Revs is the list of revisions to compare, as in git diff. With no
+	// revisions, the working copy is compared to the index. With one
+	// revision, the working copy is compared to the revision. With two
+	// revisions, the first revision is compared to the second. With
+	// three or more revisions, the first revision must be a merge commit
+	// and the rest its parents, and Diff returns combined diffs.
+	Revs []string
+
+	// Paths limits the diff to the given pathspecs.
+	Paths []string
+
+	// Context is the number of lines of context to show around each
+	// change. If Context is zero, git's default is used. A negative
+	// value shows no context.
+	Context int
+
+	IgnoreSpaceChange bool
+	IgnoreBlankLines  bool
+	IgnoreAllSpace    bool
+	IgnoreSpaceAtEOL  bool
+
+	// FindRenames and FindCopies are the similarity thresholds for
+	// detecting renames and copies, like "50%". If FindRenames is
+	// empty, git's configuration decides whether renames are detected.
+	// If FindCopies is empty, copies are not detected.
+	FindRenames string
+	FindCopies  string
+
+	// FindCopiesHarder checks unmodified files when detecting copies.
+	// This can be expensive.
+	FindCopiesHarder bool
+}
+
+// FileDiff is the set of changes to a single file.
+type FileDiff struct {
+	// OldPath and NewPath are the file's paths relative to the top of
+	// the repository. They are the same unless the file was renamed or
+	// copied.
+	OldPath string
+	NewPath string
+
+	// OldMode and NewMode are the file's modes. OldMode is zero if the
+	// file was added and NewMode is zero if the file was deleted.
+	OldMode gitobj.Mode
+	NewMode gitobj.Mode
+
+	// OldHash and NewHash are the file's blob hashes. They are the zero
+	// hash if git did not report them, as for changes that only modify
+	// the mode.
+	OldHash gitobj.Hash
+	NewHash gitobj.Hash
+
+	Status DiffStatus
+
+	// Similarity is the similarity percentage between a renamed or
+	// copied file and its original, or zero for other files.
+	Similarity int
+
+	// Binary is true if git detected that the file is binary. Binary
+	// files do not have hunks.
+	Binary bool
+
+	// Parents describes the file in each parent of a combined diff.
+	// OldMode and OldHash are the same as the first parent's. Parents is
+	// nil for other diffs.
+	Parents []DiffParent
+
+	Hunks []Hunk
+}
+
+// DiffParent describes a file in one parent of a combined diff.
+type DiffParent struct {
+	Mode gitobj.Mode
+	Hash gitobj.Hash
+}
+
+// DiffStatus is the kind of change made to a file.
+type DiffStatus byte
+
+// Diff statuses. A change in a file's type (for example, from a regular
+// file to a symlink) is reported as a deletion followed by an addition.
+const (
+	FileModified DiffStatus = 'M'
+	FileAdded    DiffStatus = 'A'
+	FileDeleted  DiffStatus = 'D'
+	FileRenamed  DiffStatus = 'R'
+	FileCopied   DiffStatus = 'C'
+	FileUnmerged DiffStatus = 'U'
+)
+
+// String returns the status's letter, as in `git diff --name-status`.
+func (status DiffStatus) String() string {
+	return string(status)
+}
+
+// A Hunk is a contiguous group of changed lines in a file.
+type Hunk struct {
+	// Old is the range of lines in the original file. For combined
+	// diffs, Old is the same as Parents[0].
+	Old LineRange
+
+	// New is the range of lines in the new file.
+	New LineRange
+
+	// Parents has the range of lines in each parent of a combined diff.
+	// It is nil for other diffs.
+	Parents []LineRange
+
+	// Section is the text after the hunk's line numbers, usually the
+	// enclosing function.
+	Section string
+
+	Lines []DiffLine
+}
+
+// A LineRange is a range of lines in a file. Start is 1-based. If Count
+// is zero, then Start is the line before the empty range.
+type LineRange struct {
+	Start int
+	Count int
+}
+
+// A DiffLine is a single line in a hunk.
+type DiffLine struct {
+	Kind DiffLineKind
+
+	// Text is the content of the line without the diff markers or the
+	// line ending.
+	Text string
+
+	// NoNewline is true if the line is the last line in the file and
+	// the file does not end with a newline.
+	NoNewline bool
+
+	// Markers has the marker for each parent of a combined diff, like
+	// " +" or "- ". It is empty for other diffs.
+	Markers string
+}
+
+// DiffLineKind specifies whether a line was added, deleted, or is
+// unchanged context.
+type DiffLineKind int8
+
+// Line kinds. In a combined diff, a line is added if it is not in at
+// least one parent and deleted if it is not in the result.
+const (
+	ContextLine DiffLineKind = iota
+	AddedLine
+	DeletedLine
+)
+
+// String returns the line kind's marker in a diff: " ", "+", or "-".
+func (kind DiffLineKind) String() string {
+	switch kind {
+	case ContextLine:
+		return " "
+	case AddedLine:
+		return "+"
+	case DeletedLine:
+		return "-"
+	default:
+		return fmt.Sprintf("DiffLineKind(%d)", int8(kind))
+	}
+}
+
+// Diff starts a `git diff` subprocess. A nil opts is treated the same
+// as the zero value.
+func Diff(ctx context.Context, git *Tool, opts *DiffOptions) (*DiffReader, error) {
+	if opts == nil {
+		opts = new(DiffOptions)
+	}
+	// Options that change the patch format from what the parser expects
+	// are overridden, regardless of the user's configuration.
+	args := []string{
+		"diff",
+		"--no-color",
+		"--no-ext-diff",
+		"--no-textconv",
+		"--full-index",
+		"--submodule=short",
+		"--src-prefix=a/",
+		"--dst-prefix=b/",
+	}
+	switch {
+	case opts.Context > 0:
+		args = append(args, "-U"+strconv.Itoa(opts.Context))
+	case opts.Context < 0:
+		args = append(args, "-U0")
+	}
+	if opts.IgnoreSpaceChange {
+		args = append(args, "--ignore-space-change")
+	}
+	if opts.IgnoreBlankLines {
+		args = append(args, "--ignore-blank-lines")
+	}
+	if opts.IgnoreAllSpace {
+		args = append(args, "--ignore-all-space")
+	}
+	if opts.IgnoreSpaceAtEOL {
+		args = append(args, "--ignore-space-at-eol")
+	}
+	if opts.FindRenames != "" {
+		args = append(args, "--find-renames="+opts.FindRenames)
+	}
+	if opts.FindCopies != "" {
+		args = append(args, "--find-copies="+opts.FindCopies)
+	}
+	if opts.FindCopiesHarder {
+		args = append(args, "--find-copies-harder")
+	}
+	for _, rev := range opts.Revs {
+		if rev == "" || strings.HasPrefix(rev, "-") {
+			return nil, fmt.Errorf("git diff: invalid revision %q", rev)
+		}
+	}
+	args = append(args, opts.Revs...)
+	args = append(args, "--")
+	args = append(args, opts.Paths...)
+	ctx, cancel := context.WithCancel(ctx)
+	p, err := git.Start(ctx, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &DiffReader{
+		p:      p,
+		r:      bufio.NewReader(p),
+		cancel: cancel,
+	}, nil
+}
+
+// Scan reads the next file in the diff output.
+func (dr *DiffReader) Scan() bool {
+	if dr.err != nil {
+		return false
+	}
+	dr.err = dr.readFile(&dr.file)
+	if dr.err != nil {
+		return false
+	}
+	dr.scanned = true
+	return true
+}
+
+// Err returns the first non-EOF error encountered during Scan.
+func (dr *DiffReader) Err() error {
+	if dr.err == io.EOF {
+		return nil
+	}
+	return dr.err
+}
+
+// File returns the most recent file parsed by a call to Scan.
+// The pointer may point to data that will be overwritten by a
+// subsequent call to Scan.
+func (dr *DiffReader) File() *FileDiff {
+	if !dr.scanned || dr.err != nil {
+		return nil
+	}
+	return &dr.file
+}
+
+// Close finishes reading from the Git subprocess and waits for it to
+// terminate. The behavior of calling methods on a DiffReader after
+// Close is undefined.
+//
+// If the subprocess exited due to a signal, Close will not return an
+// error, as it usually means that Close terminated the process. In the
+// case that another signal terminated the subprocess, this usually
+// results in a scan error.
+func (dr *DiffReader) Close() error {
+	dr.cancel()
+	err := dr.p.Wait()
+	*dr = DiffReader{}
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *exitError:
+		if err.signaled {
+			return nil
+		}
+		return err
+	default:
+		return err
+	}
+}
+
+// peekLine returns the next line of output without its newline and
+// without consuming it.
+func (dr *DiffReader) peekLine() (string, error) {
+	if dr.hasLine {
+		return dr.line, nil
+	}
+	line, err := dr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	dr.line = strings.TrimSuffix(line, "\n")
+	dr.hasLine = true
+	return dr.line, nil
+}
+
+// nextLine consumes the next line of output.
+func (dr *DiffReader) nextLine() (string, error) {
+	line, err := dr.peekLine()
+	dr.hasLine = false
+	return line, err
+}
+
+// readFile reads the next file's header and hunks. It returns io.EOF if
+// there are no more files.
+func (dr *DiffReader) readFile(f *FileDiff) error {
+	line, err := dr.nextLine()
+	if err != nil {
+		return err
+	}
+	*f = FileDiff{Status: FileModified}
+	combined := false
+	switch {
+	case strings.HasPrefix(line, "diff --git "):
+		f.OldPath, f.NewPath, err = parseDiffGitHeader(line[len("diff --git "):])
+		if err != nil {
+			return fmt.Errorf("read diff: %v", err)
+		}
+	case strings.HasPrefix(line, "diff --cc ") || strings.HasPrefix(line, "diff --combined "):
+		combined = true
+		f.OldPath, err = unquotePath(line[strings.IndexByte(line[len("diff --"):], ' ')+len("diff --")+1:])
+		if err != nil {
+			return fmt.Errorf("read diff: %v", err)
+		}
+		f.NewPath = f.OldPath
+	case strings.HasPrefix(line, "* Unmerged path "):
+		f.OldPath = line[len("* Unmerged path "):]
+		f.NewPath = f.OldPath
+		f.Status = FileUnmerged
+		return nil
+	default:
+		return fmt.Errorf("read diff: unexpected line %q", line)
+	}
+
+	// Extended header lines.
+	for {
+		line, err := dr.peekLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read diff %s: %v", f.NewPath, err)
+		}
+		if strings.HasPrefix(line, "@@") || isDiffFileStart(line) {
+			break
+		}
+		dr.nextLine()
+		if err := f.parseHeaderLine(line, combined); err != nil {
+			return fmt.Errorf("read diff %s: %v", f.NewPath, err)
+		}
+	}
+
+	// Hunks.
+	for {
+		line, err := dr.peekLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read diff %s: %v", f.NewPath, err)
+		}
+		if !strings.HasPrefix(line, "@@") {
+			return nil
+		}
+		dr.nextLine()
+		f.Hunks = append(f.Hunks, Hunk{})
+		h := &f.Hunks[len(f.Hunks)-1]
+		nparents, err := parseHunkHeader(h, line)
+		if err != nil {
+			return fmt.Errorf("read diff %s: %v", f.NewPath, err)
+		}
+		if err := dr.readHunkLines(h, nparents); err != nil {
+			return fmt.Errorf("read diff %s: %v", f.NewPath, err)
+		}
+	}
+}
+
+func isDiffFileStart(line string) bool {
+	return strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "* Unmerged path ")
+}
+
+// readHunkLines reads the lines of a hunk up to the next hunk or file.
+func (dr *DiffReader) readHunkLines(h *Hunk, nparents int) error {
+	for {
+		line, err := dr.peekLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			// diff.suppressBlankEmpty omits the space before empty
+			// context lines.
+			dr.nextLine()
+			h.Lines = append(h.Lines, DiffLine{Kind: ContextLine})
+			continue
+		}
+		switch line[0] {
+		case ' ', '+', '-':
+		case '\\':
+			// "\ No newline at end of file"
+			dr.nextLine()
+			if len(h.Lines) == 0 {
+				return errors.New("no-newline marker at beginning of hunk")
+			}
+			h.Lines[len(h.Lines)-1].NoNewline = true
+			continue
+		default:
+			return nil
+		}
+		dr.nextLine()
+		if len(line) < nparents {
+			return fmt.Errorf("hunk line %q too short", line)
+		}
+		markers := line[:nparents]
+		l := DiffLine{Text: line[nparents:]}
+		switch {
+		case strings.IndexByte(markers, '-') != -1:
+			l.Kind = DeletedLine
+		case strings.IndexByte(markers, '+') != -1:
+			l.Kind = AddedLine
+		default:
+			l.Kind = ContextLine
+		}
+		if nparents > 1 {
+			l.Markers = markers
+		}
+		h.Lines = append(h.Lines, l)
+	}
+}
+
+// parseHeaderLine parses an extended header line of a file's diff.
+// Unknown lines are ignored.
+func (f *FileDiff) parseHeaderLine(line string, combined bool) error {
+	switch {
+	case strings.HasPrefix(line, "old mode "):
+		return parseDiffMode(&f.OldMode, line[len("old mode "):])
+	case strings.HasPrefix(line, "new mode "):
+		return parseDiffMode(&f.NewMode, line[len("new mode "):])
+	case strings.HasPrefix(line, "new file mode "):
+		f.Status = FileAdded
+		return parseDiffMode(&f.NewMode, line[len("new file mode "):])
+	case strings.HasPrefix(line, "deleted file mode "):
+		f.Status = FileDeleted
+		modes := line[len("deleted file mode "):]
+		if combined {
+			return f.parseParentModes(strings.Split(modes, ","))
+		}
+		return parseDiffMode(&f.OldMode, modes)
+	case combined && strings.HasPrefix(line, "mode "):
+		// "mode 100644,100644..100755"
+		modes := line[len("mode "):]
+		dots := strings.Index(modes, "..")
+		if dots == -1 {
+			return fmt.Errorf("invalid header %q", line)
+		}
+		if err := f.parseParentModes(strings.Split(modes[:dots], ",")); err != nil {
+			return err
+		}
+		return parseDiffMode(&f.NewMode, modes[dots+2:])
+	case strings.HasPrefix(line, "index "):
+		return f.parseIndexLine(line[len("index "):], combined)
+	case strings.HasPrefix(line, "similarity index "):
+		n, err := strconv.Atoi(strings.TrimSuffix(line[len("similarity index "):], "%"))
+		if err != nil {
+			return fmt.Errorf("invalid header %q", line)
+		}
+		f.Similarity = n
+	case strings.HasPrefix(line, "rename from "):
+		f.Status = FileRenamed
+		return unquotePathTo(&f.OldPath, line[len("rename from "):])
+	case strings.HasPrefix(line, "rename to "):
+		return unquotePathTo(&f.NewPath, line[len("rename to "):])
+	case strings.HasPrefix(line, "copy from "):
+		f.Status = FileCopied
+		return unquotePathTo(&f.OldPath, line[len("copy from "):])
+	case strings.HasPrefix(line, "copy to "):
+		return unquotePathTo(&f.NewPath, line[len("copy to "):])
+	case strings.HasPrefix(line, "--- "):
+		return parsePatchPath(&f.OldPath, line[len("--- "):], "a/")
+	case strings.HasPrefix(line, "+++ "):
+		return parsePatchPath(&f.NewPath, line[len("+++ "):], "b/")
+	case strings.HasPrefix(line, "Binary files "):
+		f.Binary = true
+	}
+	return nil
+}
+
+// parseIndexLine parses the hashes and mode in an index header line,
+// like "1234..5678 100644" or "1234,5678..9abc" for combined diffs.
+func (f *FileDiff) parseIndexLine(s string, combined bool) error {
+	var mode string
+	if sp := strings.IndexByte(s, ' '); sp != -1 {
+		s, mode = s[:sp], s[sp+1:]
+	}
+	dots := strings.Index(s, "..")
+	if dots == -1 {
+		return fmt.Errorf("invalid index header %q", s)
+	}
+	var err error
+	f.NewHash, err = parseDiffHash(s[dots+2:])
+	if err != nil {
+		return err
+	}
+	if combined {
+		oldHashes := strings.Split(s[:dots], ",")
+		if f.Parents == nil {
+			f.Parents = make([]DiffParent, len(oldHashes))
+		} else if len(f.Parents) != len(oldHashes) {
+			return fmt.Errorf("invalid index header %q: wrong number of parents", s)
+		}
+		for i, h := range oldHashes {
+			f.Parents[i].Hash, err = parseDiffHash(h)
+			if err != nil {
+				return err
+			}
+		}
+		f.OldHash = f.Parents[0].Hash
+	} else {
+		f.OldHash, err = parseDiffHash(s[:dots])
+		if err != nil {
+			return err
+		}
+	}
+	if mode != "" {
+		// Only present if the mode did not change.
+		if err := parseDiffMode(&f.NewMode, mode); err != nil {
+			return err
+		}
+		f.OldMode = f.NewMode
+		for i := range f.Parents {
+			f.Parents[i].Mode = f.NewMode
+		}
+	}
+	return nil
+}
+
+func (f *FileDiff) parseParentModes(modes []string) error {
+	if f.Parents == nil {
+		f.Parents = make([]DiffParent, len(modes))
+	} else if len(f.Parents) != len(modes) {
+		return fmt.Errorf("modes %q: wrong number of parents", strings.Join(modes, ","))
+	}
+	for i, m := range modes {
+		if err := parseDiffMode(&f.Parents[i].Mode, m); err != nil {
+			return err
+		}
+	}
+	f.OldMode = f.Parents[0].Mode
+	return nil
+}
+
+// parseHunkHeader parses a hunk header like "@@ -1,3 +1,4 @@ func foo"
+// or "@@@ -1,3 -1,3 +1,4 @@@" and returns the number of parents.
+func parseHunkHeader(h *Hunk, line string) (nparents int, err error) {
+	n := 0
+	for n < len(line) && line[n] == '@' {
+		n++
+	}
+	nparents = n - 1
+	if nparents < 1 {
+		return 0, fmt.Errorf("invalid hunk header %q", line)
+	}
+	end := strings.Index(line[n:], " "+line[:n])
+	if end == -1 {
+		return 0, fmt.Errorf("invalid hunk header %q", line)
+	}
+	ranges := strings.Fields(line[n : n+end])
+	if len(ranges) != nparents+1 {
+		return 0, fmt.Errorf("invalid hunk header %q", line)
+	}
+	parents := make([]LineRange, nparents)
+	for i := range parents {
+		if !strings.HasPrefix(ranges[i], "-") {
+			return 0, fmt.Errorf("invalid hunk header %q", line)
+		}
+		parents[i], err = parseLineRange(ranges[i][1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid hunk header %q", line)
+		}
+	}
+	if !strings.HasPrefix(ranges[nparents], "+") {
+		return 0, fmt.Errorf("invalid hunk header %q", line)
+	}
+	h.New, err = parseLineRange(ranges[nparents][1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid hunk header %q", line)
+	}
+	h.Old = parents[0]
+	if nparents > 1 {
+		h.Parents = parents
+	}
+	h.Section = strings.TrimPrefix(line[n+end+1+n:], " ")
+	return nparents, nil
+}
+
+// parseLineRange parses "start,count" or "start", which implies a count
+// of 1.
+func parseLineRange(s string) (LineRange, error) {
+	start, count := s, "1"
+	if i := strings.IndexByte(s, ','); i != -1 {
+		start, count = s[:i], s[i+1:]
+	}
+	var r LineRange
+	var err error
+	r.Start, err = strconv.Atoi(start)
+	if err != nil {
+		return LineRange{}, err
+	}
+	r.Count, err = strconv.Atoi(count)
+	if err != nil {
+		return LineRange{}, err
+	}
+	return r, nil
+}
+
+func parseDiffMode(m *gitobj.Mode, s string) error {
+	mode, err := parseStatusMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// parseDiffHash parses a hash from an index header. An all-zero hash is
+// returned as the zero Hash.
+func parseDiffHash(s string) (gitobj.Hash, error) {
+	if strings.Trim(s, "0") == "" {
+		return gitobj.Hash{}, nil
+	}
+	return gitobj.ParseHash(s)
+}
+
+// parseDiffGitHeader parses the paths in a "diff --git a/foo b/bar"
+// line. Unquoted paths that contain spaces are ambiguous, so the paths
+// are assumed to be the same, as git apply does. Later header lines
+// give the paths of renamed files unambiguously.
+func parseDiffGitHeader(s string) (oldPath, newPath string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		end := quotedPathEnd(s)
+		if end == -1 || end+1 >= len(s) || s[end+1] != ' ' {
+			return "", "", fmt.Errorf("invalid diff header %q", s)
+		}
+		oldPath, err = unquotePath(s[:end+1])
+		if err != nil {
+			return "", "", err
+		}
+		newPath, err = unquotePath(s[end+2:])
+		if err != nil {
+			return "", "", err
+		}
+	} else if i := strings.Index(s, ` "`); i != -1 {
+		// Unquoted paths can't contain double quotes.
+		oldPath = s[:i]
+		newPath, err = unquotePath(s[i+1:])
+		if err != nil {
+			return "", "", err
+		}
+	} else if n := (len(s) - 1) / 2; len(s)%2 == 1 && s[n] == ' ' && s[2:n] == s[n+3:] {
+		oldPath, newPath = s[:n], s[n+1:]
+	} else if i := strings.Index(s, " b/"); i != -1 {
+		oldPath, newPath = s[:i], s[i+1:]
+	} else {
+		return "", "", fmt.Errorf("invalid diff header %q", s)
+	}
+	if !strings.HasPrefix(oldPath, "a/") || !strings.HasPrefix(newPath, "b/") {
+		return "", "", fmt.Errorf("invalid diff header %q", s)
+	}
+	return oldPath[2:], newPath[2:], nil
+}
+
+// parsePatchPath parses the path in a "---" or "+++" line, leaving
+// *dst unchanged for /dev/null.
+func parsePatchPath(dst *string, s string, prefix string) error {
+	if s == "/dev/null" {
+		return nil
+	}
+	if !strings.HasPrefix(s, `"`) {
+		// git adds a tab after unquoted paths that contain spaces.
+		s = strings.TrimSuffix(s, "\t")
+	}
+	path, err := unquotePath(s)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return fmt.Errorf("path %q does not start with %q", path, prefix)
+	}
+	*dst = path[len(prefix):]
+	return nil
+}
+
+func unquotePathTo(dst *string, s string) error {
+	path, err := unquotePath(s)
+	if err != nil {
+		return err
+	}
+	*dst = path
+	return nil
+}
+
+// unquotePath returns a path that git may have quoted. git quotes paths
+// that contain double quotes, backslashes, or control characters (and
+// non-ASCII characters if core.quotePath is set) in C style, which is a
+// subset of Go's escapes.
+func unquotePath(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	path, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted path %s", s)
+	}
+	return path, nil
+}
+
+// quotedPathEnd returns the index of the double quote that ends the
+// quoted path at the beginning of s or -1 if there isn't one.
+func quotedPathEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,419 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+func TestReadDiff(t *testing.T) {
+	const (
+		hash1 = "0123456789abcdef0123456789abcdef01234567"
+		hash2 = "89abcdef0123456789abcdef0123456789abcdef"
+		hash3 = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+		zero  = "0000000000000000000000000000000000000000"
+	)
+	tests := []struct {
+		name    string
+		data    string
+		want    []FileDiff
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+			data: "",
+		},
+		{
+			name: "Modified",
+			data: "diff --git a/foo.txt b/foo.txt\n" +
+				"index " + hash1 + ".." + hash2 + " 100644\n" +
+				"--- a/foo.txt\n" +
+				"+++ b/foo.txt\n" +
+				"@@ -1,3 +1,3 @@ func main() {\n" +
+				" a\n" +
+				"-b\n" +
+				"+B\n" +
+				"\n" +
+				"@@ -10 +10,0 @@\n" +
+				"-z\n" +
+				"\\ No newline at end of file\n",
+			want: []FileDiff{
+				{
+					OldPath: "foo.txt",
+					NewPath: "foo.txt",
+					OldMode: gitobj.ModeFile,
+					NewMode: gitobj.ModeFile,
+					OldHash: mustParseHash(t, hash1),
+					NewHash: mustParseHash(t, hash2),
+					Status:  FileModified,
+					Hunks: []Hunk{
+						{
+							Old:     LineRange{1, 3},
+							New:     LineRange{1, 3},
+							Section: "func main() {",
+							Lines: []DiffLine{
+								{Kind: ContextLine, Text: "a"},
+								{Kind: DeletedLine, Text: "b"},
+								{Kind: AddedLine, Text: "B"},
+								{Kind: ContextLine, Text: ""},
+							},
+						},
+						{
+							Old: LineRange{10, 1},
+							New: LineRange{10, 0},
+							Lines: []DiffLine{
+								{Kind: DeletedLine, Text: "z", NoNewline: true},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "AddDeleteModeAndBinary",
+			data: "diff --git a/new file.txt b/new file.txt\n" +
+				"new file mode 100644\n" +
+				"index " + zero + ".." + hash1 + "\n" +
+				"--- /dev/null\n" +
+				"+++ b/new file.txt\t\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+hello\n" +
+				"diff --git a/old b/old\n" +
+				"deleted file mode 100755\n" +
+				"index " + hash2 + ".." + zero + "\n" +
+				"diff --git a/script b/script\n" +
+				"old mode 100644\n" +
+				"new mode 100755\n" +
+				"diff --git a/bin b/bin\n" +
+				"index " + hash1 + ".." + hash2 + " 100644\n" +
+				"Binary files a/bin and b/bin differ\n",
+			want: []FileDiff{
+				{
+					OldPath: "new file.txt",
+					NewPath: "new file.txt",
+					NewMode: gitobj.ModeFile,
+					NewHash: mustParseHash(t, hash1),
+					Status:  FileAdded,
+					Hunks: []Hunk{
+						{
+							Old:   LineRange{0, 0},
+							New:   LineRange{1, 1},
+							Lines: []DiffLine{{Kind: AddedLine, Text: "hello"}},
+						},
+					},
+				},
+				{
+					OldPath: "old",
+					NewPath: "old",
+					OldMode: gitobj.ModeExecutable,
+					OldHash: mustParseHash(t, hash2),
+					Status:  FileDeleted,
+				},
+				{
+					OldPath: "script",
+					NewPath: "script",
+					OldMode: gitobj.ModeFile,
+					NewMode: gitobj.ModeExecutable,
+					Status:  FileModified,
+				},
+				{
+					OldPath: "bin",
+					NewPath: "bin",
+					OldMode: gitobj.ModeFile,
+					NewMode: gitobj.ModeFile,
+					OldHash: mustParseHash(t, hash1),
+					NewHash: mustParseHash(t, hash2),
+					Status:  FileModified,
+					Binary:  true,
+				},
+			},
+		},
+		{
+			name: "RenameWithQuoting",
+			data: `diff --git a/sp ace.txt "b/r\303\251named\ttab.txt"` + "\n" +
+				"similarity index 90%\n" +
+				"rename from sp ace.txt\n" +
+				`rename to "r\303\251named\ttab.txt"` + "\n" +
+				"index " + hash1 + ".." + hash2 + " 100644\n" +
+				"--- a/sp ace.txt\t\n" +
+				`+++ "b/r\303\251named\ttab.txt"` + "\n" +
+				"@@ -1 +1 @@\n" +
+				"-x\n" +
+				"+y\n" +
+				"diff --git a/a b/b\n" +
+				"similarity index 100%\n" +
+				"copy from a\n" +
+				"copy to b\n",
+			want: []FileDiff{
+				{
+					OldPath:    "sp ace.txt",
+					NewPath:    "rénamed\ttab.txt",
+					OldMode:    gitobj.ModeFile,
+					NewMode:    gitobj.ModeFile,
+					OldHash:    mustParseHash(t, hash1),
+					NewHash:    mustParseHash(t, hash2),
+					Status:     FileRenamed,
+					Similarity: 90,
+					Hunks: []Hunk{
+						{
+							Old: LineRange{1, 1},
+							New: LineRange{1, 1},
+							Lines: []DiffLine{
+								{Kind: DeletedLine, Text: "x"},
+								{Kind: AddedLine, Text: "y"},
+							},
+						},
+					},
+				},
+				{
+					OldPath:    "a",
+					NewPath:    "b",
+					Status:     FileCopied,
+					Similarity: 100,
+				},
+			},
+		},
+		{
+			name: "Combined",
+			data: "diff --cc f.txt\n" +
+				"index " + hash1 + "," + hash2 + ".." + hash3 + "\n" +
+				"--- a/f.txt\n" +
+				"+++ b/f.txt\n" +
+				"@@@ -1,3 -1,3 +1,3 @@@\n" +
+				"  a\n" +
+				"- MASTER\n" +
+				" -SIDE\n" +
+				"++BOTH\n" +
+				"  c\n" +
+				"* Unmerged path g.txt\n",
+			want: []FileDiff{
+				{
+					OldPath: "f.txt",
+					NewPath: "f.txt",
+					OldHash: mustParseHash(t, hash1),
+					NewHash: mustParseHash(t, hash3),
+					Status:  FileModified,
+					Parents: []DiffParent{
+						{Hash: mustParseHash(t, hash1)},
+						{Hash: mustParseHash(t, hash2)},
+					},
+					Hunks: []Hunk{
+						{
+							Old:     LineRange{1, 3},
+							New:     LineRange{1, 3},
+							Parents: []LineRange{{1, 3}, {1, 3}},
+							Lines: []DiffLine{
+								{Kind: ContextLine, Text: "a", Markers: "  "},
+								{Kind: DeletedLine, Text: "MASTER", Markers: "- "},
+								{Kind: DeletedLine, Text: "SIDE", Markers: " -"},
+								{Kind: AddedLine, Text: "BOTH", Markers: "++"},
+								{Kind: ContextLine, Text: "c", Markers: "  "},
+							},
+						},
+					},
+				},
+				{
+					OldPath: "g.txt",
+					NewPath: "g.txt",
+					Status:  FileUnmerged,
+				},
+			},
+		},
+		{
+			name:    "Garbage",
+			data:    "hello\n",
+			wantErr: true,
+		},
+		{
+			name: "BadHunkHeader",
+			data: "diff --git a/foo b/foo\n" +
+				"@@ -1,x +1 @@\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dr := &DiffReader{r: bufio.NewReader(strings.NewReader(test.data))}
+			var got []FileDiff
+			for dr.Scan() {
+				got = append(got, *dr.File())
+			}
+			if err := dr.Err(); err != nil {
+				if !test.wantErr {
+					t.Error("Scan:", err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Error("Scan did not return an error")
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(env.root, "repo")
+	git := env.git.WithDir(repo)
+	writeFile := func(name, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(repo, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Color and prefixes in the user's configuration must not affect
+	// the parser.
+	if err := git.Run(ctx, "config", "color.diff", "always"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "config", "diff.noprefix", "true"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile("f.txt", "a\nb\nc\n")
+	writeFile("sp ace.txt", "one\ntwo\nthree\nfour\nfive\n")
+	writeFile("bin", "x\x00y")
+	if err := git.Run(ctx, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "commit", "-m", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("WorkingCopy", func(t *testing.T) {
+		writeFile("f.txt", "a\nB\nc")
+		writeFile("bin", "x\x00z")
+		if err := os.Rename(filepath.Join(repo, "sp ace.txt"), filepath.Join(repo, "rénamed\n.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := git.Run(ctx, "add", "-A"); err != nil {
+			t.Fatal(err)
+		}
+		dr, err := Diff(ctx, git, &DiffOptions{Revs: []string{"HEAD"}, FindRenames: "50%"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dr.Close()
+		got := make(map[string]FileDiff)
+		for dr.Scan() {
+			f := dr.File()
+			got[f.NewPath] = *f
+		}
+		if err := dr.Err(); err != nil {
+			t.Error(err)
+		}
+		if f, ok := got["bin"]; !ok {
+			t.Error("bin not in diff")
+		} else if !f.Binary {
+			t.Errorf("bin: Binary = false; want true")
+		}
+		if f, ok := got["rénamed\n.txt"]; !ok {
+			t.Errorf("renamed file not in diff; got %v", got)
+		} else if f.Status != FileRenamed || f.OldPath != "sp ace.txt" || f.Similarity != 100 {
+			t.Errorf("renamed file: Status = %v, OldPath = %q, Similarity = %d; want R, \"sp ace.txt\", 100", f.Status, f.OldPath, f.Similarity)
+		}
+		wantHunks := []Hunk{
+			{
+				Old: LineRange{1, 3},
+				New: LineRange{1, 3},
+				Lines: []DiffLine{
+					{Kind: ContextLine, Text: "a"},
+					{Kind: DeletedLine, Text: "b"},
+					{Kind: DeletedLine, Text: "c"},
+					{Kind: AddedLine, Text: "B"},
+					{Kind: AddedLine, Text: "c", NoNewline: true},
+				},
+			},
+		}
+		if diff := cmp.Diff(wantHunks, got["f.txt"].Hunks); diff != "" {
+			t.Errorf("f.txt hunks (-want +got):\n%s", diff)
+		}
+		if err := git.Run(ctx, "commit", "-m", "second"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Combined", func(t *testing.T) {
+		if err := git.Run(ctx, "checkout", "--quiet", "-b", "side", "HEAD~"); err != nil {
+			t.Fatal(err)
+		}
+		writeFile("f.txt", "a\nSIDE\nc\n")
+		if err := git.Run(ctx, "commit", "--quiet", "-am", "side"); err != nil {
+			t.Fatal(err)
+		}
+		if err := git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+			t.Fatal(err)
+		}
+		// The merge conflicts, so resolve it by hand.
+		git.Run(ctx, "merge", "--quiet", "side")
+		writeFile("f.txt", "a\nBOTH\nc\n")
+		if err := git.Run(ctx, "commit", "--quiet", "-am", "merge"); err != nil {
+			t.Fatal(err)
+		}
+		dr, err := Diff(ctx, git, &DiffOptions{Revs: []string{"HEAD", "HEAD^1", "HEAD^2"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dr.Close()
+		if !dr.Scan() {
+			t.Fatal("Scan() = false:", dr.Err())
+		}
+		f := dr.File()
+		if f.NewPath != "f.txt" || len(f.Parents) != 2 || len(f.Hunks) != 1 {
+			t.Fatalf("File() = %+v; want f.txt with 2 parents and 1 hunk", f)
+		}
+		var added []string
+		for _, l := range f.Hunks[0].Lines {
+			if l.Kind == AddedLine {
+				added = append(added, l.Markers+l.Text)
+			}
+		}
+		// master's version of f.txt does not end in a newline.
+		if diff := cmp.Diff([]string{"++BOTH", "+ c"}, added); diff != "" {
+			t.Errorf("added lines (-want +got):\n%s", diff)
+		}
+		for dr.Scan() {
+			t.Errorf("unexpected file %s", dr.File().NewPath)
+		}
+		if err := dr.Err(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Reasons that a git command can fail, as returned by Cause.
+var (
+	// ErrNotRepository indicates that the command was run outside a git
+	// repository.
+	ErrNotRepository = errors.New("not a git repository")
+
+	// ErrRefNotFound indicates that a revision, remote ref, or object
+	// named in the command does not exist.
+	ErrRefNotFound = errors.New("ref not found")
+
+	// ErrIndexLocked indicates that another git process is modifying
+	// the index or crashed while doing so.
+	ErrIndexLocked = errors.New("index locked")
+
+	// ErrAuth indicates that the remote rejected the user's credentials
+	// or git could not ask for them.
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrNonFastForward indicates that a branch could not be updated
+	// because its new commit does not descend from its old commit.
+	ErrNonFastForward = errors.New("non-fast-forward update rejected")
+)
+
+// ConflictError indicates that a merge, rebase, or similar command
+// stopped because of conflicts.
+type ConflictError struct {
+	// Paths is the list of files that git reported as having content
+	// conflicts. It may be empty even if there are conflicts.
+	Paths []string
+}
+
+// Error returns a description of the conflicts.
+func (e *ConflictError) Error() string {
+	if len(e.Paths) == 0 {
+		return "merge conflicts"
+	}
+	return "merge conflicts in " + strings.Join(e.Paths, ", ")
+}
+
+// Cause returns the reason that a git command failed: one of the Err
+// variables in this package or a *ConflictError. It returns nil if err
+// was not returned by a git command or the failure was not recognized.
+// Classification is best-effort: it matches git's English messages, so
+// it does not recognize failures if git is localized.
+// Cause does not look through errors that wrap the command's error, so
+// it should be called on the error that Tool's methods or
+// ObjectReader.Read return.
+func Cause(err error) error {
+	switch e := err.(type) {
+	case *exitError:
+		return e.cause
+	case *objectError:
+		return e.cause
+	}
+	return nil
+}
+
+// wrapErrorOutput is like wrapError, but uses the subprocess's captured
+// stderr and stdout to determine the cause. Unless echoed is true,
+// meaning that the user has already seen stderr, it is included in the
+// message.
+func wrapErrorOutput(subject string, e error, stderr, stdout []byte, echoed bool) error {
+	exitErr, ok := e.(*exec.ExitError)
+	if !ok {
+		return wrapError(subject, e)
+	}
+	var msg string
+	if errOut := bytes.TrimRight(stderr, "\n"); len(errOut) > 0 && !echoed {
+		msg = fmt.Sprintf("run %s: %s (%v)", subject, errOut, exitErr)
+	} else {
+		msg = fmt.Sprintf("run %s: %v", subject, exitErr)
+	}
+	return &exitError{
+		msg:      msg,
+		signaled: wasSignaled(exitErr.ProcessState),
+		cause:    classifyFailure(stderr, stdout),
+	}
+}
+
+// classifyFailure matches well-known git messages in a failed command's
+// output. The messages come from git's source and are only matched if
+// git is not localized.
+func classifyFailure(stderr, stdout []byte) error {
+	contains := func(s string) bool {
+		return bytes.Contains(stderr, []byte(s)) || bytes.Contains(stdout, []byte(s))
+	}
+	switch {
+	case contains("not a git repository"):
+		return ErrNotRepository
+	case contains("index.lock': File exists"):
+		return ErrIndexLocked
+	}
+	if paths := conflictPaths(stdout); len(paths) > 0 {
+		return &ConflictError{Paths: paths}
+	}
+	if paths := conflictPaths(stderr); len(paths) > 0 {
+		return &ConflictError{Paths: paths}
+	}
+	switch {
+	case contains("Automatic merge failed"),
+		contains("could not apply"),
+		contains("Resolve all conflicts manually"),
+		contains("you need to resolve your current index first"):
+		return new(ConflictError)
+	case contains("(non-fast-forward)"),
+		contains("(fetch first)"),
+		contains("Updates were rejected because"),
+		contains("Not possible to fast-forward"):
+		return ErrNonFastForward
+	case contains("Authentication failed"),
+		contains("Permission denied (publickey"),
+		contains("could not read Username"),
+		contains("could not read Password"),
+		contains("terminal prompts disabled"),
+		contains("The requested URL returned error: 401"),
+		contains("The requested URL returned error: 403"):
+		return ErrAuth
+	case contains("unknown revision"),
+		contains("bad revision"),
+		contains("Needed a single revision"),
+		contains("not a valid object name"),
+		contains("couldn't find remote ref"),
+		contains("invalid reference:"):
+		return ErrRefNotFound
+	}
+	return nil
+}
+
+// conflictPaths returns the paths in "CONFLICT (content): Merge
+// conflict in PATH" lines.
+func conflictPaths(out []byte) []string {
+	const prefix = "CONFLICT ("
+	const marker = "Merge conflict in "
+	var paths []string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		if i := strings.Index(line, marker); i != -1 {
+			paths = append(paths, line[i+len(marker):])
+		}
+	}
+	return paths
+}
+
+// cappedBuffer is an io.Writer that keeps the first max bytes written
+// to it and discards the rest.
+type cappedBuffer struct {
+	buf []byte
+	max int
+}
+
+func (cb *cappedBuffer) Write(p []byte) (int, error) {
+	if n := cb.max - len(cb.buf); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		cb.buf = append(cb.buf, p[:n]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		stdout string
+		want   error
+	}{
+		{
+			name:   "NotRepository",
+			stderr: "fatal: not a git repository (or any of the parent directories): .git\n",
+			want:   ErrNotRepository,
+		},
+		{
+			name:   "UnknownRevision",
+			stderr: "fatal: ambiguous argument 'foo': unknown revision or path not in the working tree.\n",
+			want:   ErrRefNotFound,
+		},
+		{
+			name:   "MissingRemoteRef",
+			stderr: "fatal: couldn't find remote ref refs/heads/nope\n",
+			want:   ErrRefNotFound,
+		},
+		{
+			name: "IndexLocked",
+			stderr: "fatal: Unable to create '/repo/.git/index.lock': File exists.\n\n" +
+				"Another git process seems to be running in this repository\n",
+			want: ErrIndexLocked,
+		},
+		{
+			name:   "Auth",
+			stderr: "remote: Invalid username or password.\nfatal: Authentication failed for 'https://example.com/repo.git/'\n",
+			want:   ErrAuth,
+		},
+		{
+			name:   "PublicKey",
+			stderr: "git@example.com: Permission denied (publickey).\nfatal: Could not read from remote repository.\n",
+			want:   ErrAuth,
+		},
+		{
+			name: "PushRejected",
+			stderr: "To /remote\n ! [rejected]        master -> master (fetch first)\n" +
+				"error: failed to push some refs to '/remote'\n",
+			want: ErrNonFastForward,
+		},
+		{
+			name:   "PullFastForwardOnly",
+			stderr: "fatal: Not possible to fast-forward, aborting.\n",
+			want:   ErrNonFastForward,
+		},
+		{
+			name: "MergeConflict",
+			stdout: "Auto-merging a.txt\nCONFLICT (content): Merge conflict in a.txt\n" +
+				"CONFLICT (content): Merge conflict in dir/b c.txt\n" +
+				"Automatic merge failed; fix conflicts and then commit the result.\n",
+			want: &ConflictError{Paths: []string{"a.txt", "dir/b c.txt"}},
+		},
+		{
+			name:   "RebaseConflict",
+			stderr: "error: could not apply 1234567... foo\n",
+			want:   &ConflictError{},
+		},
+		{
+			name:   "Unknown",
+			stderr: "fatal: something else\n",
+			want:   nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := classifyFailure([]byte(test.stderr), []byte(test.stdout))
+			if !sameCause(got, test.want) {
+				t.Errorf("classifyFailure(...) = %v; want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCause(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	// Cause only recognizes git's untranslated messages.
+	git, err := New(gitPath, env.root, &Options{
+		Env: append([]string{"LC_ALL=C", "LANGUAGE=C"}, env.git.env...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("NotRepository", func(t *testing.T) {
+		err := git.Run(ctx, "status")
+		if err == nil {
+			t.Fatal("git status outside a repository succeeded")
+		}
+		if got := Cause(err); got != ErrNotRepository {
+			t.Errorf("Cause(%q) = %v; want %v", err, got, ErrNotRepository)
+		}
+		if !strings.Contains(err.Error(), "not a git repository") {
+			t.Errorf("error %q does not include stderr", err)
+		}
+	})
+	t.Run("Echoed", func(t *testing.T) {
+		stderr := new(bytes.Buffer)
+		git, err := New(gitPath, env.root, &Options{
+			Env:    append([]string{"LC_ALL=C", "LANGUAGE=C"}, env.git.env...),
+			Stderr: stderr,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = git.Run(ctx, "status")
+		if err == nil {
+			t.Fatal("git status outside a repository succeeded")
+		}
+		if got := Cause(err); got != ErrNotRepository {
+			t.Errorf("Cause(%q) = %v; want %v", err, got, ErrNotRepository)
+		}
+		if !strings.Contains(stderr.String(), "not a git repository") {
+			t.Errorf("stderr = %q; want to include git's message", stderr)
+		}
+		if strings.Contains(err.Error(), "not a git repository") {
+			t.Errorf("error %q repeats stderr that was already written", err)
+		}
+	})
+	if err := git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(env.root, "repo")
+	git = git.WithDir(repo)
+	writeFile := func(content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(repo, "foo.txt"), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("original\n")
+	if err := git.Run(ctx, "add", "foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "commit", "-m", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("RefNotFound", func(t *testing.T) {
+		_, err := git.RunOneLiner(ctx, '\n', "log", "-1", "--pretty=%H", "nope")
+		if got := Cause(err); got != ErrRefNotFound {
+			t.Errorf("Cause(%q) = %v; want %v", err, got, ErrRefNotFound)
+		}
+	})
+	t.Run("Conflict", func(t *testing.T) {
+		if err := git.Run(ctx, "checkout", "--quiet", "-b", "side"); err != nil {
+			t.Fatal(err)
+		}
+		writeFile("side\n")
+		if err := git.Run(ctx, "commit", "-am", "side"); err != nil {
+			t.Fatal(err)
+		}
+		if err := git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+			t.Fatal(err)
+		}
+		writeFile("master\n")
+		if err := git.Run(ctx, "commit", "-am", "master"); err != nil {
+			t.Fatal(err)
+		}
+		err := git.Run(ctx, "merge", "side")
+		if err == nil {
+			t.Fatal("conflicting merge succeeded")
+		}
+		want := &ConflictError{Paths: []string{"foo.txt"}}
+		if got := Cause(err); !sameCause(got, want) {
+			t.Errorf("Cause(%q) = %v; want %v", err, got, want)
+		}
+	})
+	t.Run("IndexLocked", func(t *testing.T) {
+		if err := git.Run(ctx, "merge", "--abort"); err != nil {
+			t.Fatal(err)
+		}
+		lockPath := filepath.Join(repo, ".git", "index.lock")
+		if err := ioutil.WriteFile(lockPath, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		err := git.Run(ctx, "add", "foo.txt")
+		if got := Cause(err); got != ErrIndexLocked {
+			t.Errorf("Cause(%v) = %v; want %v", err, got, ErrIndexLocked)
+		}
+	})
+}
+
+// sameCause reports whether e1 and e2 are the same sentinel error or
+// are both *ConflictErrors with the same paths.
+func sameCause(e1, e2 error) bool {
+	c1, ok1 := e1.(*ConflictError)
+	c2, ok2 := e2.(*ConflictError)
+	if ok1 && ok2 {
+		return cmp.Equal(c1.Paths, c2.Paths)
+	}
+	return e1 == e2
+}
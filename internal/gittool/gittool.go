@@ -123,18 +123,46 @@ func (t *Tool) WithDir(dir string) *Tool {
 
 // Run starts the specified git subcommand and waits for it to finish.
 //
-// stderr will be sent to the writer specified in the tool's options.
-// stdin and stdout will be connected to the null device.
+// stderr will be sent to the writer specified in the tool's options as
+// it is written. If no writer was specified, stderr is returned as part
+// of the error if the tool does not exit successfully. stdin will be
+// connected to the null device and stdout will be discarded. Cause
+// reports the reason for the failure, if it is recognized.
 func (t *Tool) Run(ctx context.Context, args ...string) error {
 	if t.log != nil {
 		t.log(ctx, args)
 	}
-	if err := t.cmd(ctx, args).Run(); err != nil {
-		return wrapError(errorSubject(args), err)
+	c := t.cmd(ctx, args)
+	stderr := t.captureStderr(c)
+	// stdout is only kept for classifying errors, since some commands
+	// (like git merge) report conflicts on stdout.
+	stdout := &cappedBuffer{max: maxCapture}
+	c.Stdout = stdout
+	if err := c.Run(); err != nil {
+		return wrapErrorOutput(errorSubject(args), err, stderr.buf, stdout.buf, t.stderr != nil)
 	}
 	return nil
 }
 
+// maxCapture is the number of bytes of a subprocess's output that are
+// kept for classifying failures.
+const maxCapture = 64 << 10
+
+// captureStderr sets c.Stderr to copy the subprocess's stderr to the
+// tool's stderr while keeping the beginning of it for classifying
+// failures. Since git then writes to a pipe, it doesn't report progress
+// unless passed --progress; use RunInteractive for commands whose
+// output should go straight to the terminal.
+func (t *Tool) captureStderr(c *exec.Cmd) *cappedBuffer {
+	buf := &cappedBuffer{max: maxCapture}
+	if t.stderr != nil {
+		c.Stderr = io.MultiWriter(t.stderr, buf)
+	} else {
+		c.Stderr = buf
+	}
+	return buf
+}
+
 // Query starts the specified git subcommand and waits for it to exit
 // with code zero (returns true) or one (returns false).
 //
@@ -156,16 +184,7 @@ func (t *Tool) Query(ctx context.Context, args ...string) (bool, error) {
 		if exitStatus(exitErr.ProcessState) == 1 {
 			return false, nil
 		}
-		var msg string
-		if errOut := bytes.TrimRight(stderr.Bytes(), "\n"); len(errOut) > 0 {
-			msg = fmt.Sprintf("run %s: %s (%v)", errorSubject(args), errOut, exitErr)
-		} else {
-			msg = fmt.Sprintf("run %s: %v", errorSubject(args), exitErr)
-		}
-		return false, &exitError{
-			msg:      msg,
-			signaled: wasSignaled(exitErr.ProcessState),
-		}
+		return false, wrapErrorOutput(errorSubject(args), exitErr, stderr.Bytes(), nil, false)
 	}
 	return true, nil
 }
@@ -194,8 +213,8 @@ func (t *Tool) RunInteractive(ctx context.Context, args ...string) error {
 // Any data after the first occurrence of the delimiter byte will be
 // considered an error.
 //
-// stderr will be sent to the writer specified in the tool's options.
-// stdin will be connected to the null device.
+// stderr is handled the same as in Run. stdin will be connected to the
+// null device.
 func (t *Tool) RunOneLiner(ctx context.Context, delim byte, args ...string) ([]byte, error) {
 	const max = 4096
 	p, err := t.Start(ctx, args...)
@@ -233,10 +252,22 @@ func (t *Tool) RunOneLiner(ctx context.Context, delim byte, args ...string) ([]b
 
 // Start starts the specified git subcommand and pipes its stdout.
 //
-// stderr will be sent to the writer specified in the tool's options.
-// stdin will be connected to the null device.
+// stderr is handled the same as in Run. stdin will be connected to the
+// null device.
 func (t *Tool) Start(ctx context.Context, args ...string) (*Process, error) {
+	return t.StartWithInput(ctx, nil, args...)
+}
+
+// StartWithInput starts the specified git subcommand with stdin
+// connected to input and pipes its stdout. It is useful for passing
+// more arguments than fit on a command line to flags like --stdin.
+//
+// stderr is handled the same as in Run. If input is nil, stdin will be
+// connected to the null device.
+func (t *Tool) StartWithInput(ctx context.Context, input io.Reader, args ...string) (*Process, error) {
 	c := t.cmd(ctx, args)
+	c.Stdin = input
+	stderr := t.captureStderr(c)
 	rc, err := c.StdoutPipe()
 	if err != nil {
 		return nil, fmt.Errorf("run %s: %v", errorSubject(args), err)
@@ -251,6 +282,8 @@ func (t *Tool) Start(ctx context.Context, args ...string) (*Process, error) {
 		cmd:     c,
 		pipe:    rc,
 		subject: errorSubject(args),
+		stderr:  stderr,
+		echoed:  t.stderr != nil,
 	}, nil
 }
 
@@ -279,6 +312,8 @@ type Process struct {
 	cmd     *exec.Cmd
 	pipe    io.ReadCloser
 	subject string
+	stderr  *cappedBuffer
+	echoed  bool // whether stderr was sent to the tool's stderr
 }
 
 // Read reads from the process's stdout.
@@ -287,19 +322,21 @@ func (p *Process) Read(b []byte) (int, error) {
 }
 
 // Wait waits for the git subprocess to exit and consumes any remaining
-// data from the subprocess's stdout.
+// data from the subprocess's stdout. If the subprocess failed, Cause
+// reports the reason for the failure, if it is recognized.
 func (p *Process) Wait() error {
 	io.Copy(ioutil.Discard, p.pipe)
 	p.pipe.Close()
 	if err := p.cmd.Wait(); err != nil {
-		return wrapError(p.subject, err)
+		return wrapErrorOutput(p.subject, err, p.stderr.buf, nil, p.echoed)
 	}
 	return nil
 }
 
 type exitError struct {
 	msg      string
-	signaled bool // Terminated by signal.
+	signaled bool  // Terminated by signal.
+	cause    error // Returned by Cause. May be nil.
 }
 
 func wrapError(subject string, e error) error {
@@ -324,6 +361,12 @@ func (ee *exitError) Error() string {
 	return ee.msg
 }
 
+// Unwrap returns the reason for the failure or nil if it was not
+// recognized.
+func (ee *exitError) Unwrap() error {
+	return ee.cause
+}
+
 func errorSubject(args []string) string {
 	for i, a := range args {
 		if !strings.HasPrefix(a, "-") && (i == 0 || args[i-1] != "-c") {
@@ -113,6 +113,37 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestStartWithInput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	p, err := env.git.StartWithInput(ctx, strings.NewReader("Hi!\n"), "hash-object", "--stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(p)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	const want = "663adb09143767984f7be83a91effa47e128c735\n"
+	if string(out) != want {
+		t.Errorf("git hash-object --stdin <<< 'Hi!' = %q; want %q", out, want)
+	}
+}
+
 type testEnv struct {
 	root string
 	git  *Tool
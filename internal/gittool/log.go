@@ -0,0 +1,251 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+// CommitReader is a handle to a running `git log` command.
+type CommitReader struct {
+	p      *Process
+	r      *bufio.Reader
+	cancel context.CancelFunc
+
+	scanned bool
+	commit  CommitInfo
+	err     error
+}
+
+// LogOptions specifies the commits that Log returns.
+type LogOptions struct {
+	// Revs is the list of revisions to start from. Revisions may be
+	// ranges like "a..b" or exclusions like "^origin/master". If Revs is
+	// empty, then Log starts from HEAD.
+	Revs []string
+
+	// Paths limits the commits to those that modify the given
+	// pathspecs.
+	Paths []string
+
+	// FirstParent causes only the first parent of merge commits to be
+	// followed.
+	FirstParent bool
+
+	// NoWalk causes only the commits named by Revs to be returned,
+	// without their ancestors.
+	NoWalk bool
+
+	// Follow continues listing the history of a single file in Paths
+	// beyond renames.
+	Follow bool
+
+	// Reverse returns the commits in the opposite order.
+	Reverse bool
+
+	// Order is the order in which commits are returned.
+	Order LogOrder
+
+	// Limit is the maximum number of commits to return. Zero or less
+	// means no limit.
+	Limit int
+}
+
+// LogOrder is the order in which Log returns commits.
+type LogOrder int
+
+// Orders for LogOptions.
+const (
+	// DefaultOrder is git log's reverse chronological order.
+	DefaultOrder LogOrder = iota
+
+	// DateOrder shows no parents before all of their children, but
+	// otherwise shows commits in commit timestamp order.
+	DateOrder
+
+	// TopoOrder shows no parents before all of their children and
+	// avoids interleaving multiple lines of history.
+	TopoOrder
+)
+
+// CommitInfo is a commit read by CommitReader. The embedded Commit's
+// ExtraHeaders field is always nil.
+type CommitInfo struct {
+	Hash gitobj.Hash
+	gitobj.Commit
+}
+
+// logFields is the number of NUL-terminated fields in logFormat.
+const logFields = 6
+
+// logFormat is the git log format for reading a CommitInfo.
+const logFormat = "%H%x00%T%x00%P%x00%an <%ae> %ad%x00%cn <%ce> %cd%x00%B"
+
+// Log starts a `git log` subprocess. A nil opts is treated the same as
+// the zero value.
+func Log(ctx context.Context, git *Tool, opts *LogOptions) (*CommitReader, error) {
+	if opts == nil {
+		opts = new(LogOptions)
+	}
+	args := []string{"log", "-z", "--date=raw", "--no-color", "--pretty=tformat:" + logFormat}
+	switch opts.Order {
+	case DateOrder:
+		args = append(args, "--date-order")
+	case TopoOrder:
+		args = append(args, "--topo-order")
+	}
+	if opts.FirstParent {
+		args = append(args, "--first-parent")
+	}
+	if opts.NoWalk {
+		args = append(args, "--no-walk")
+	}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Reverse {
+		args = append(args, "--reverse")
+	}
+	if opts.Limit > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(opts.Limit))
+	}
+	for _, rev := range opts.Revs {
+		if rev == "" || strings.HasPrefix(rev, "-") {
+			return nil, fmt.Errorf("git log: invalid revision %q", rev)
+		}
+	}
+	args = append(args, opts.Revs...)
+	args = append(args, "--")
+	args = append(args, opts.Paths...)
+	ctx, cancel := context.WithCancel(ctx)
+	p, err := git.Start(ctx, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &CommitReader{
+		p:      p,
+		r:      bufio.NewReader(p),
+		cancel: cancel,
+	}, nil
+}
+
+// Scan reads the next commit in the log output.
+func (cr *CommitReader) Scan() bool {
+	if cr.err != nil {
+		return false
+	}
+	cr.err = readLogCommit(&cr.commit, cr.r)
+	if cr.err != nil {
+		return false
+	}
+	cr.scanned = true
+	return true
+}
+
+// Err returns the first non-EOF error encountered during Scan.
+func (cr *CommitReader) Err() error {
+	if cr.err == io.EOF {
+		return nil
+	}
+	return cr.err
+}
+
+// Commit returns the most recent commit parsed by a call to Scan.
+// The pointer may point to data that will be overwritten by a
+// subsequent call to Scan.
+func (cr *CommitReader) Commit() *CommitInfo {
+	if !cr.scanned || cr.err != nil {
+		return nil
+	}
+	return &cr.commit
+}
+
+// Close finishes reading from the Git subprocess and waits for it to
+// terminate. The behavior of calling methods on a CommitReader after
+// Close is undefined.
+//
+// If the subprocess exited due to a signal, Close will not return an
+// error, as it usually means that Close terminated the process. In the
+// case that another signal terminated the subprocess, this usually
+// results in a scan error.
+func (cr *CommitReader) Close() error {
+	cr.cancel()
+	err := cr.p.Wait()
+	*cr = CommitReader{}
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *exitError:
+		if err.signaled {
+			return nil
+		}
+		return err
+	default:
+		return err
+	}
+}
+
+// readLogCommit reads a commit formatted with logFormat. It returns
+// io.EOF if r has no more commits.
+func readLogCommit(c *CommitInfo, r *bufio.Reader) error {
+	if _, err := r.Peek(1); err != nil {
+		return err
+	}
+	var fields [logFields]string
+	for i := range fields {
+		var err error
+		fields[i], err = readString(r)
+		if err != nil {
+			return fmt.Errorf("read log: %v", err)
+		}
+	}
+	var err error
+	*c = CommitInfo{}
+	c.Hash, err = gitobj.ParseHash(fields[0])
+	if err != nil {
+		return fmt.Errorf("read log: commit hash: %v", err)
+	}
+	c.Tree, err = gitobj.ParseHash(fields[1])
+	if err != nil {
+		return fmt.Errorf("read log: commit %v: tree: %v", c.Hash, err)
+	}
+	if fields[2] != "" {
+		for _, p := range strings.Split(fields[2], " ") {
+			h, err := gitobj.ParseHash(p)
+			if err != nil {
+				return fmt.Errorf("read log: commit %v: parent: %v", c.Hash, err)
+			}
+			c.Parents = append(c.Parents, h)
+		}
+	}
+	c.Author, err = gitobj.ParseSignature(fields[3])
+	if err != nil {
+		return fmt.Errorf("read log: commit %v: author: %v", c.Hash, err)
+	}
+	c.Committer, err = gitobj.ParseSignature(fields[4])
+	if err != nil {
+		return fmt.Errorf("read log: commit %v: committer: %v", c.Hash, err)
+	}
+	c.Message = fields[5]
+	return nil
+}
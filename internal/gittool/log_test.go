@@ -0,0 +1,335 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+func TestReadLogCommit(t *testing.T) {
+	const (
+		hash1 = "0123456789abcdef0123456789abcdef01234567"
+		hash2 = "89abcdef0123456789abcdef0123456789abcdef"
+		tree  = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	)
+	tz := time.FixedZone("", -7*60*60)
+	tests := []struct {
+		name    string
+		data    string
+		want    []CommitInfo
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+			data: "",
+		},
+		{
+			name: "Root",
+			data: hash1 + "\x00" + tree + "\x00\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Bob <bob@example.com> 1136239446 -0700\x00" +
+				"Hello\n\nChange-Id: I123\n\x00",
+			want: []CommitInfo{
+				{
+					Hash: mustParseHash(t, hash1),
+					Commit: gitobj.Commit{
+						Tree:      mustParseHash(t, tree),
+						Author:    gitobj.Signature{Name: "Anna", Email: "anna@example.com", Time: time.Unix(1136239445, 0).In(tz)},
+						Committer: gitobj.Signature{Name: "Bob", Email: "bob@example.com", Time: time.Unix(1136239446, 0).In(tz)},
+						Message:   "Hello\n\nChange-Id: I123\n",
+					},
+				},
+			},
+		},
+		{
+			name: "Merge",
+			data: hash2 + "\x00" + tree + "\x00" + hash1 + " " + hash1 + "\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Merge\n\x00" +
+				hash1 + "\x00" + tree + "\x00\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"\x00",
+			want: []CommitInfo{
+				{
+					Hash: mustParseHash(t, hash2),
+					Commit: gitobj.Commit{
+						Tree:      mustParseHash(t, tree),
+						Parents:   []gitobj.Hash{mustParseHash(t, hash1), mustParseHash(t, hash1)},
+						Author:    gitobj.Signature{Name: "Anna", Email: "anna@example.com", Time: time.Unix(1136239445, 0).In(tz)},
+						Committer: gitobj.Signature{Name: "Anna", Email: "anna@example.com", Time: time.Unix(1136239445, 0).In(tz)},
+						Message:   "Merge\n",
+					},
+				},
+				{
+					Hash: mustParseHash(t, hash1),
+					Commit: gitobj.Commit{
+						Tree:      mustParseHash(t, tree),
+						Author:    gitobj.Signature{Name: "Anna", Email: "anna@example.com", Time: time.Unix(1136239445, 0).In(tz)},
+						Committer: gitobj.Signature{Name: "Anna", Email: "anna@example.com", Time: time.Unix(1136239445, 0).In(tz)},
+					},
+				},
+			},
+		},
+		{
+			name: "EmptyName",
+			data: hash1 + "\x00" + tree + "\x00\x00" +
+				" <anna@example.com> 1136239445 -0700\x00" +
+				"Bob <bob@example.com> 1136239446 -0700\x00" +
+				"Hello\n\x00",
+			want: []CommitInfo{
+				{
+					Hash: mustParseHash(t, hash1),
+					Commit: gitobj.Commit{
+						Tree:      mustParseHash(t, tree),
+						Author:    gitobj.Signature{Email: "anna@example.com", Time: time.Unix(1136239445, 0).In(tz)},
+						Committer: gitobj.Signature{Name: "Bob", Email: "bob@example.com", Time: time.Unix(1136239446, 0).In(tz)},
+						Message:   "Hello\n",
+					},
+				},
+			},
+		},
+		{
+			name:    "Truncated",
+			data:    hash1 + "\x00" + tree + "\x00\x00",
+			wantErr: true,
+		},
+		{
+			name: "BadParent",
+			data: hash1 + "\x00" + tree + "\x00xyzzy\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Hello\n\x00",
+			wantErr: true,
+		},
+		{
+			name: "BadAuthor",
+			data: hash1 + "\x00" + tree + "\x00\x00" +
+				"Anna 1136239445 -0700\x00" +
+				"Anna <anna@example.com> 1136239445 -0700\x00" +
+				"Hello\n\x00",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(test.data))
+			var got []CommitInfo
+			for {
+				var c CommitInfo
+				err := readLogCommit(&c, r)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if !test.wantErr {
+						t.Error("readLogCommit:", err)
+					}
+					return
+				}
+				got = append(got, c)
+			}
+			if test.wantErr {
+				t.Error("readLogCommit did not return an error")
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("commits (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLog(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(env.root, "repo")
+	git := env.git.WithDir(repo)
+	commitFile := func(name, msg string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(repo, name), []byte(msg), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := git.Run(ctx, "add", name); err != nil {
+			t.Fatal(err)
+		}
+		if err := git.Run(ctx, "commit", "-m", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitFile("foo.txt", "first")
+	if err := git.Run(ctx, "checkout", "--quiet", "-b", "feature"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("bar.txt", "feature\n\nChange-Id: I0123\nSigned-off-by: User <foo@example.com>")
+	if err := git.Run(ctx, "checkout", "--quiet", "master"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("foo.txt", "second")
+	if err := git.Run(ctx, "merge", "--quiet", "--no-ff", "-m", "merge feature", "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	// readSummaries returns the summaries of the commits that Log returns.
+	readSummaries := func(t *testing.T, opts *LogOptions) []string {
+		t.Helper()
+		cr, err := Log(ctx, git, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for cr.Scan() {
+			got = append(got, cr.Commit().Summary())
+		}
+		if err := cr.Err(); err != nil {
+			t.Error(err)
+		}
+		if err := cr.Close(); err != nil {
+			t.Error("Close:", err)
+		}
+		return got
+	}
+	tests := []struct {
+		name string
+		opts *LogOptions
+		want []string
+	}{
+		{
+			name: "Default",
+			opts: &LogOptions{Order: TopoOrder},
+			want: []string{"merge feature", "feature", "second", "first"},
+		},
+		{
+			name: "FirstParent",
+			opts: &LogOptions{FirstParent: true},
+			want: []string{"merge feature", "second", "first"},
+		},
+		{
+			name: "Limit",
+			opts: &LogOptions{Limit: 1},
+			want: []string{"merge feature"},
+		},
+		{
+			name: "Range",
+			opts: &LogOptions{Revs: []string{"master", "^feature"}},
+			want: []string{"merge feature", "second"},
+		},
+		{
+			name: "Paths",
+			opts: &LogOptions{Paths: []string{"bar.txt"}},
+			want: []string{"feature"},
+		},
+		{
+			name: "NoWalk",
+			opts: &LogOptions{Revs: []string{"feature"}, NoWalk: true},
+			want: []string{"feature"},
+		},
+		{
+			name: "Reverse",
+			opts: &LogOptions{FirstParent: true, Reverse: true},
+			want: []string{"first", "second", "merge feature"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := readSummaries(t, test.opts)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("summaries (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("Details", func(t *testing.T) {
+		cr, err := Log(ctx, git, &LogOptions{Revs: []string{"feature"}, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cr.Close()
+		if !cr.Scan() {
+			t.Fatal("Scan() = false:", cr.Err())
+		}
+		c := cr.Commit()
+		rev, err := ParseRev(ctx, git, "feature")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Hash != rev.Commit() {
+			t.Errorf("Hash = %v; want %v", c.Hash, rev.Commit())
+		}
+		if len(c.Parents) != 1 {
+			t.Errorf("Parents = %v; want 1 parent", c.Parents)
+		}
+		if c.Author.Name != "User" || c.Author.Email != "foo@example.com" {
+			t.Errorf("Author = %v; want User <foo@example.com>", c.Author)
+		}
+		wantTrailers := []gitobj.Trailer{
+			{Key: "Change-Id", Value: "I0123"},
+			{Key: "Signed-off-by", Value: "User <foo@example.com>"},
+		}
+		if diff := cmp.Diff(wantTrailers, c.Trailers()); diff != "" {
+			t.Errorf("Trailers() (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("EarlyClose", func(t *testing.T) {
+		cr, err := Log(ctx, git, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cr.Scan() {
+			t.Fatal("Scan() = false:", cr.Err())
+		}
+		if err := cr.Close(); err != nil {
+			t.Error("Close:", err)
+		}
+	})
+	t.Run("BadRev", func(t *testing.T) {
+		if cr, err := Log(ctx, git, &LogOptions{Revs: []string{"--all"}}); err == nil {
+			cr.Close()
+			t.Error("Log with Revs = [\"--all\"] did not return an error")
+		}
+	})
+}
+
+func mustParseHash(tb testing.TB, s string) gitobj.Hash {
+	tb.Helper()
+	h, err := gitobj.ParseHash(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return h
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+// ObjectReader reads objects from a repository through a single
+// long-running `git cat-file --batch` process. It is safe to use from
+// multiple goroutines: only one object can be read at a time, so
+// callers wait until the previous object has been closed.
+type ObjectReader struct {
+	sema chan struct{} // holds a token while an object is being read
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	err    error // sticky error after the process's output is corrupted
+	closed bool
+}
+
+// NewObjectReader starts a `git cat-file --batch` process. The process
+// runs until Close is called or ctx is done.
+func NewObjectReader(ctx context.Context, git *Tool) (*ObjectReader, error) {
+	args := []string{"cat-file", "--batch"}
+	c := git.cmd(ctx, args)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("run %s: %v", errorSubject(args), err)
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, fmt.Errorf("run %s: %v", errorSubject(args), err)
+	}
+	if git.log != nil {
+		git.log(ctx, args)
+	}
+	if err := c.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("run %s: %v", errorSubject(args), err)
+	}
+	return &ObjectReader{
+		sema:   make(chan struct{}, 1),
+		cmd:    c,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}, nil
+}
+
+// Object is the content of a git object being read. Reading from it
+// returns the object's content. It must be closed before the
+// ObjectReader can read another object.
+type Object struct {
+	Hash gitobj.Hash
+	Type string // "blob", "tree", "commit", or "tag"
+	Size int64
+
+	r      *ObjectReader
+	remain int64
+	closed bool
+}
+
+// Read returns the object named by rev, which can be any revision
+// expression that git understands, like "HEAD:foo.txt" or
+// "master^{tree}".
+func (r *ObjectReader) Read(ctx context.Context, rev string) (*Object, error) {
+	if rev == "" || strings.ContainsAny(rev, "\n") {
+		return nil, fmt.Errorf("read object %q: invalid name", rev)
+	}
+	select {
+	case r.sema <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("read object %s: %v", rev, ctx.Err())
+	}
+	obj, err := r.read(rev)
+	if err != nil {
+		<-r.sema
+		if err == errObjectMissing {
+			return nil, &objectError{msg: "read object " + rev + ": missing", cause: ErrRefNotFound}
+		}
+		return nil, fmt.Errorf("read object %s: %v", rev, err)
+	}
+	return obj, nil
+}
+
+// ReadObject returns the object with the given hash.
+func (r *ObjectReader) ReadObject(ctx context.Context, hash gitobj.Hash) (*Object, error) {
+	return r.Read(ctx, hash.String())
+}
+
+// errObjectMissing is returned by read when git reports that the
+// requested object does not exist.
+var errObjectMissing = errors.New("missing")
+
+// objectError is returned by ObjectReader.Read for an object that git
+// could not find. Its cause is returned by Cause.
+type objectError struct {
+	msg   string
+	cause error
+}
+
+func (e *objectError) Error() string {
+	return e.msg
+}
+
+// read sends a request to the git process and reads the object's
+// header. The caller must be holding the semaphore.
+func (r *ObjectReader) read(rev string) (*Object, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if _, err := io.WriteString(r.stdin, rev+"\n"); err != nil {
+		r.err = err
+		return nil, err
+	}
+	line, err := r.stdout.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if strings.HasSuffix(line, " missing") {
+		return nil, errObjectMissing
+	}
+	if strings.HasSuffix(line, " ambiguous") {
+		return nil, errors.New("ambiguous")
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		r.err = fmt.Errorf("parse git cat-file header %q", line)
+		return nil, r.err
+	}
+	hash, err := gitobj.ParseHash(fields[0])
+	if err != nil {
+		r.err = fmt.Errorf("parse git cat-file header: %v", err)
+		return nil, r.err
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || size < 0 {
+		r.err = fmt.Errorf("parse git cat-file header %q: invalid size", line)
+		return nil, r.err
+	}
+	return &Object{
+		Hash:   hash,
+		Type:   fields[1],
+		Size:   size,
+		r:      r,
+		remain: size,
+	}, nil
+}
+
+// Read reads the object's content.
+func (obj *Object) Read(p []byte) (int, error) {
+	if obj.closed {
+		return 0, errors.New("read object: already closed")
+	}
+	if obj.remain == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > obj.remain {
+		p = p[:obj.remain]
+	}
+	n, err := obj.r.stdout.Read(p)
+	obj.remain -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		obj.r.err = err
+	}
+	return n, err
+}
+
+// Close discards any unread content and allows the ObjectReader to
+// read the next object.
+func (obj *Object) Close() error {
+	if obj.closed {
+		return nil
+	}
+	obj.closed = true
+	defer func() { <-obj.r.sema }()
+	if obj.r.err != nil {
+		return obj.r.err
+	}
+	// Skip the rest of the content and the trailing newline.
+	if _, err := io.CopyN(ioutil.Discard, obj.r.stdout, obj.remain+1); err != nil {
+		obj.r.err = err
+		return err
+	}
+	obj.remain = 0
+	return nil
+}
+
+// Close stops the git process. It waits for any object being read to be
+// closed. Calling Close more than once has no effect.
+func (r *ObjectReader) Close() error {
+	r.sema <- struct{}{}
+	defer func() { <-r.sema }()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.err = errors.New("object reader closed")
+	r.stdin.Close()
+	io.Copy(ioutil.Discard, r.stdout)
+	if err := r.cmd.Wait(); err != nil {
+		return wrapError("git cat-file", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gittool
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestObjectReader(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	git := env.git.WithDir(filepath.Join(env.root, "repo"))
+	const nfiles = 10
+	for i := 0; i < nfiles; i++ {
+		content := []byte(fmt.Sprintf("Hello, %d!\n", i))
+		if err := ioutil.WriteFile(filepath.Join(env.root, "repo", fmt.Sprintf("file%d.txt", i)), content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := git.Run(ctx, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "commit", "-m", "first commit"); err != nil {
+		t.Fatal(err)
+	}
+	head, err := ParseRev(ctx, git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objs, err := NewObjectReader(ctx, git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer objs.Close()
+
+	t.Run("Blob", func(t *testing.T) {
+		obj, err := objs.Read(ctx, "HEAD:file1.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer obj.Close()
+		const want = "Hello, 1!\n"
+		if obj.Type != "blob" || obj.Size != int64(len(want)) {
+			t.Errorf("type, size = %q, %d; want \"blob\", %d", obj.Type, obj.Size, len(want))
+		}
+		got, err := ioutil.ReadAll(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("content = %q; want %q", got, want)
+		}
+	})
+	t.Run("PartialRead", func(t *testing.T) {
+		obj, err := objs.ReadObject(ctx, head.Commit())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.Type != "commit" || obj.Hash != head.Commit() {
+			t.Errorf("type, hash = %q, %v; want \"commit\", %v", obj.Type, obj.Hash, head.Commit())
+		}
+		buf := make([]byte, 4)
+		if _, err := obj.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := obj.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// The next read must start at the next object.
+		obj, err = objs.Read(ctx, "HEAD:file2.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer obj.Close()
+		got, err := ioutil.ReadAll(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "Hello, 2!\n"; string(got) != want {
+			t.Errorf("content after partial read = %q; want %q", got, want)
+		}
+	})
+	t.Run("Missing", func(t *testing.T) {
+		if obj, err := objs.Read(ctx, "HEAD:nonexistent.txt"); err == nil {
+			obj.Close()
+			t.Error("Read of missing file did not return an error")
+		} else if got := Cause(err); got != ErrRefNotFound {
+			t.Errorf("Cause(%q) = %v; want %v", err, got, ErrRefNotFound)
+		}
+		// The reader can still be used.
+		obj, err := objs.Read(ctx, "HEAD:file3.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj.Close()
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, nfiles)
+		for i := 0; i < nfiles; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				obj, err := objs.Read(ctx, fmt.Sprintf("HEAD:file%d.txt", i))
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				defer obj.Close()
+				got, err := ioutil.ReadAll(obj)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if want := fmt.Sprintf("Hello, %d!\n", i); string(got) != want {
+					errs[i] = fmt.Errorf("file%d.txt = %q; want %q", i, got, want)
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	if err := objs.Close(); err != nil {
+		t.Error("Close:", err)
+	}
+}
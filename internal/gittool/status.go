@@ -17,10 +17,12 @@ package gittool
 import (
 	"bufio"
 	"context"
-	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
 )
 
 // StatusReader is a handle to a running `git status` command.
@@ -29,45 +31,106 @@ type StatusReader struct {
 	p      *Process
 	r      *bufio.Reader
 	cancel context.CancelFunc
+	branch *BranchInfo
+	v2     bool
 
 	scanned bool
 	ent     StatusEntry
 	err     error
 }
 
+// StatusOptions specifies optional parameters for StatusWithOptions.
+type StatusOptions struct {
+	// IncludeIgnored causes ignored files to be returned.
+	IncludeIgnored bool
+
+	// IncludeDetails causes entries to include the modes and hashes
+	// of files, rename scores, unmerged stages, and submodule states.
+	// It requires Git 2.11 or newer.
+	IncludeDetails bool
+
+	// IncludeBranch causes the reader to read information about the
+	// current branch, which can be retrieved with the Branch method.
+	// This may be slow, since git must count the commits that the
+	// branch is ahead of and behind its upstream. It implies
+	// IncludeDetails.
+	IncludeBranch bool
+}
+
 // Status starts a `git status` subprocess.
 func Status(ctx context.Context, git *Tool, args []string) (*StatusReader, error) {
-	allArgs := make([]string, 0, 5+len(args))
-	allArgs = append(allArgs, "status", "--porcelain", "-z", "-unormal", "--")
-	allArgs = append(allArgs, args...)
-	return startStatus(ctx, git, allArgs)
+	return StatusWithOptions(ctx, git, args, nil)
 }
 
 // StatusWithIgnored starts a `git status` subprocess with the
 // `--ignored` option set.
 func StatusWithIgnored(ctx context.Context, git *Tool, args []string) (*StatusReader, error) {
-	allArgs := make([]string, 0, 6+len(args))
-	allArgs = append(allArgs, "status", "--porcelain", "-z", "-unormal", "--ignored", "--")
-	allArgs = append(allArgs, args...)
-	return startStatus(ctx, git, allArgs)
+	return StatusWithOptions(ctx, git, args, &StatusOptions{IncludeIgnored: true})
 }
 
-func startStatus(ctx context.Context, git *Tool, allArgs []string) (*StatusReader, error) {
+// StatusWithOptions starts a `git status` subprocess. A nil opts is
+// treated the same as the zero value.
+func StatusWithOptions(ctx context.Context, git *Tool, args []string, opts *StatusOptions) (*StatusReader, error) {
+	if opts == nil {
+		opts = new(StatusOptions)
+	}
+	// Porcelain v2 is only requested when needed so that gg keeps
+	// working with versions of git before 2.11.
+	v2 := opts.IncludeDetails || opts.IncludeBranch
+	allArgs := make([]string, 0, 7+len(args))
+	if v2 {
+		allArgs = append(allArgs, "status", "--porcelain=v2", "-z", "-unormal")
+	} else {
+		allArgs = append(allArgs, "status", "--porcelain", "-z", "-unormal")
+	}
+	if opts.IncludeBranch {
+		allArgs = append(allArgs, "--branch")
+	}
+	if opts.IncludeIgnored {
+		allArgs = append(allArgs, "--ignored")
+	}
+	allArgs = append(allArgs, "--")
+	allArgs = append(allArgs, args...)
 	ctx, cancel := context.WithCancel(ctx)
 	p, err := git.Start(ctx, allArgs...)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return &StatusReader{
+	sr := &StatusReader{
 		p:      p,
 		r:      bufio.NewReader(p),
 		cancel: cancel,
-	}, nil
+		v2:     v2,
+	}
+	if opts.IncludeBranch {
+		sr.branch = new(BranchInfo)
+		for {
+			if b, err := sr.r.Peek(1); err != nil || b[0] != '#' {
+				break
+			}
+			if err := readBranchHeader(sr.branch, sr.r); err != nil {
+				sr.Close()
+				return nil, err
+			}
+		}
+	}
+	return sr, nil
+}
+
+// Branch returns information about the current branch or nil if the
+// reader was not started with IncludeBranch.
+func (sr *StatusReader) Branch() *BranchInfo {
+	return sr.branch
 }
 
 // Scan reads the next entry in the status output.
 func (sr *StatusReader) Scan() bool {
-	sr.err = readStatusEntry(&sr.ent, sr.r)
+	if sr.v2 {
+		sr.err = readStatusEntry(&sr.ent, sr.r)
+	} else {
+		sr.err = readStatusEntryV1(&sr.ent, sr.r)
+	}
 	if sr.err != nil {
 		return false
 	}
@@ -118,14 +181,193 @@ func (sr *StatusReader) Close() error {
 	}
 }
 
+// BranchInfo describes the current branch and its upstream.
+type BranchInfo struct {
+	// Commit is the current commit. It is the zero hash if the
+	// branch does not have any commits yet.
+	Commit gitobj.Hash
+
+	// Head is the name of the current branch or empty if HEAD is
+	// detached.
+	Head string
+
+	// Upstream is the name of the upstream branch, like
+	// "origin/master", or empty if the branch has no upstream.
+	Upstream string
+
+	// Ahead and Behind are the number of commits that are on the
+	// branch and not its upstream and vice versa. They are zero if the
+	// upstream branch does not exist.
+	Ahead  int
+	Behind int
+}
+
+// readBranchHeader reads a "# branch.KEY VALUE" line into info.
+// Unknown headers are ignored.
+func readBranchHeader(info *BranchInfo, r io.ByteReader) error {
+	line, err := readString(r)
+	if err != nil {
+		return fmt.Errorf("read status branch: %v", err)
+	}
+	const prefix = "# "
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("read status branch: header %q does not start with %q", line, prefix)
+	}
+	line = line[len(prefix):]
+	sp := strings.IndexByte(line, ' ')
+	if sp == -1 {
+		return fmt.Errorf("read status branch: malformed header %q", line)
+	}
+	key, val := line[:sp], line[sp+1:]
+	switch key {
+	case "branch.oid":
+		if val == "(initial)" {
+			info.Commit = gitobj.Hash{}
+			return nil
+		}
+		info.Commit, err = gitobj.ParseHash(val)
+		if err != nil {
+			return fmt.Errorf("read status branch: %v", err)
+		}
+	case "branch.head":
+		if val == "(detached)" {
+			info.Head = ""
+			return nil
+		}
+		info.Head = val
+	case "branch.upstream":
+		info.Upstream = val
+	case "branch.ab":
+		var ahead, behind string
+		if i := strings.IndexByte(val, ' '); i != -1 {
+			ahead, behind = val[:i], val[i+1:]
+		}
+		if !strings.HasPrefix(ahead, "+") || !strings.HasPrefix(behind, "-") {
+			return fmt.Errorf("read status branch: malformed ahead/behind %q", val)
+		}
+		info.Ahead, err = strconv.Atoi(ahead[1:])
+		if err != nil {
+			return fmt.Errorf("read status branch: malformed ahead/behind %q", val)
+		}
+		info.Behind, err = strconv.Atoi(behind[1:])
+		if err != nil {
+			return fmt.Errorf("read status branch: malformed ahead/behind %q", val)
+		}
+	}
+	return nil
+}
+
 // A StatusEntry describes the state of a single file in the working copy.
+// Modes, hashes, scores, stages, and submodule states are only set if
+// the StatusReader was started with IncludeDetails.
 type StatusEntry struct {
-	code StatusCode
-	name string
-	from string
+	code  StatusCode
+	name  string
+	from  string
+	score int
+	sub   SubmoduleStatus
+
+	headMode     gitobj.Mode
+	indexMode    gitobj.Mode
+	workTreeMode gitobj.Mode
+	headHash     gitobj.Hash
+	indexHash    gitobj.Hash
+
+	// Stages 1-3 of an unmerged file.
+	stageModes  [3]gitobj.Mode
+	stageHashes [3]gitobj.Hash
 }
 
+// readStatusEntry reads a single entry in the `git status
+// --porcelain=v2 -z` format.
 func readStatusEntry(out *StatusEntry, r io.ByteReader) error {
+	*out = StatusEntry{}
+	typ, err := r.ReadByte()
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("read status entry: %v", err)
+	}
+	line, err := readString(r)
+	if err != nil {
+		return fmt.Errorf("read status entry: %v", err)
+	}
+	if !strings.HasPrefix(line, " ") {
+		return fmt.Errorf("read status entry: expected ' ' after %q", typ)
+	}
+	line = line[1:]
+
+	switch typ {
+	case '?', '!':
+		out.code = StatusCode{typ, typ}
+		out.name = line
+		return nil
+	case '1':
+		fields := strings.SplitN(line, " ", 8)
+		if len(fields) != 8 {
+			return fmt.Errorf("read status entry: malformed changed entry %q", line)
+		}
+		if err := out.parseChanged(fields[:7]); err != nil {
+			return fmt.Errorf("read status entry: %v", err)
+		}
+		out.name = fields[7]
+	case '2':
+		fields := strings.SplitN(line, " ", 9)
+		if len(fields) != 9 {
+			return fmt.Errorf("read status entry: malformed renamed entry %q", line)
+		}
+		if err := out.parseChanged(fields[:7]); err != nil {
+			return fmt.Errorf("read status entry: %v", err)
+		}
+		score := fields[7]
+		if score == "" || (score[0] != 'R' && score[0] != 'C') {
+			return fmt.Errorf("read status entry: invalid score %q", score)
+		}
+		out.score, err = strconv.Atoi(score[1:])
+		if err != nil || out.score < 0 || out.score > 100 {
+			return fmt.Errorf("read status entry: invalid score %q", score)
+		}
+		out.name = fields[8]
+		out.from, err = readString(r)
+		if err != nil {
+			return fmt.Errorf("read status entry: %v", err)
+		}
+	case 'u':
+		fields := strings.SplitN(line, " ", 10)
+		if len(fields) != 10 {
+			return fmt.Errorf("read status entry: malformed unmerged entry %q", line)
+		}
+		if err := out.parseCodeAndSubmodule(fields[0], fields[1]); err != nil {
+			return fmt.Errorf("read status entry: %v", err)
+		}
+		for i := range out.stageModes {
+			if out.stageModes[i], err = parseStatusMode(fields[2+i]); err != nil {
+				return fmt.Errorf("read status entry: %v", err)
+			}
+			if out.stageHashes[i], err = gitobj.ParseHash(fields[6+i]); err != nil {
+				return fmt.Errorf("read status entry: %v", err)
+			}
+		}
+		if out.workTreeMode, err = parseStatusMode(fields[5]); err != nil {
+			return fmt.Errorf("read status entry: %v", err)
+		}
+		out.name = fields[9]
+	default:
+		return fmt.Errorf("read status entry: unknown entry type %q", typ)
+	}
+
+	// Check code validity at very end in order to consume as much as possible.
+	if !out.code.isValid() {
+		return fmt.Errorf("read status entry: invalid code %q %q", out.code[0], out.code[1])
+	}
+	return nil
+}
+
+// readStatusEntryV1 reads a single entry in the `git status
+// --porcelain -z` format.
+func readStatusEntryV1(out *StatusEntry, r io.ByteReader) error {
+	*out = StatusEntry{}
 	var err error
 	// Read status code.
 	out.code[0], err = r.ReadByte()
@@ -150,12 +392,12 @@ func readStatusEntry(out *StatusEntry, r io.ByteReader) error {
 	}
 
 	// Read name and from.
-	out.name, err = readString(r, 2048)
+	out.name, err = readString(r)
 	if err != nil {
 		return fmt.Errorf("read status entry: %v", err)
 	}
 	if out.code[0] == 'R' || out.code[0] == 'C' || out.code[1] == 'R' || out.code[1] == 'C' {
-		out.from, err = readString(r, 2048)
+		out.from, err = readString(r)
 		if err != nil {
 			return fmt.Errorf("read status entry: %v", err)
 		}
@@ -168,10 +410,72 @@ func readStatusEntry(out *StatusEntry, r io.ByteReader) error {
 	return nil
 }
 
+// parseChanged parses the "XY sub mH mI mW hH hI" fields that start
+// ordinary and renamed entries.
+func (ent *StatusEntry) parseChanged(fields []string) error {
+	if err := ent.parseCodeAndSubmodule(fields[0], fields[1]); err != nil {
+		return err
+	}
+	var err error
+	if ent.headMode, err = parseStatusMode(fields[2]); err != nil {
+		return err
+	}
+	if ent.indexMode, err = parseStatusMode(fields[3]); err != nil {
+		return err
+	}
+	if ent.workTreeMode, err = parseStatusMode(fields[4]); err != nil {
+		return err
+	}
+	if ent.headHash, err = gitobj.ParseHash(fields[5]); err != nil {
+		return err
+	}
+	if ent.indexHash, err = gitobj.ParseHash(fields[6]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseCodeAndSubmodule parses the "XY" and "sub" fields of an entry.
+// Porcelain v2 uses '.' for unchanged, which is translated to the ' '
+// used in the short format.
+func (ent *StatusEntry) parseCodeAndSubmodule(xy, sub string) error {
+	if len(xy) != 2 {
+		return fmt.Errorf("invalid code %q", xy)
+	}
+	for i := range ent.code {
+		ent.code[i] = xy[i]
+		if ent.code[i] == '.' {
+			ent.code[i] = ' '
+		}
+	}
+	switch {
+	case sub == "N...":
+		ent.sub = SubmoduleStatus{}
+	case len(sub) == 4 && sub[0] == 'S':
+		ent.sub = SubmoduleStatus{
+			IsSubmodule:   true,
+			CommitChanged: sub[1] == 'C',
+			Modified:      sub[2] == 'M',
+			HasUntracked:  sub[3] == 'U',
+		}
+	default:
+		return fmt.Errorf("invalid submodule state %q", sub)
+	}
+	return nil
+}
+
+func parseStatusMode(s string) (gitobj.Mode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	return gitobj.Mode(m), nil
+}
+
 // readString reads a NUL-terminated string from r.
-func readString(r io.ByteReader, limit int) (string, error) {
+func readString(r io.ByteReader) (string, error) {
 	var sb strings.Builder
-	for sb.Len() < limit {
+	for {
 		b, err := r.ReadByte()
 		if err != nil {
 			return "", dontExpectEOF(err)
@@ -181,14 +485,6 @@ func readString(r io.ByteReader, limit int) (string, error) {
 		}
 		sb.WriteByte(b)
 	}
-	b, err := r.ReadByte()
-	if err != nil {
-		return "", dontExpectEOF(err)
-	}
-	if b != 0 {
-		return "", errors.New("string too long")
-	}
-	return sb.String(), nil
 }
 
 // String returns the entry in short format.
@@ -214,11 +510,80 @@ func (ent *StatusEntry) Name() string {
 
 // From returns the path of the file that this file was renamed or
 // copied from, otherwise an empty string. The path will always be
-/// relative to the top of the repository.
+// relative to the top of the repository.
 func (ent *StatusEntry) From() string {
 	return ent.from
 }
 
+// Score returns the similarity percentage between a renamed or copied
+// file and its original, or zero for other files.
+func (ent *StatusEntry) Score() int {
+	return ent.score
+}
+
+// HeadMode returns the mode of the file in HEAD or zero if the file is
+// not in HEAD or is unmerged.
+func (ent *StatusEntry) HeadMode() gitobj.Mode {
+	return ent.headMode
+}
+
+// IndexMode returns the mode of the file in the index or zero if the
+// file is not in the index or is unmerged.
+func (ent *StatusEntry) IndexMode() gitobj.Mode {
+	return ent.indexMode
+}
+
+// WorkTreeMode returns the mode of the file in the work tree or zero
+// if the file is missing from the work tree. It is also zero for
+// untracked and ignored files.
+func (ent *StatusEntry) WorkTreeMode() gitobj.Mode {
+	return ent.workTreeMode
+}
+
+// HeadHash returns the hash of the file's object in HEAD or the zero
+// hash if the file is not in HEAD or is unmerged.
+func (ent *StatusEntry) HeadHash() gitobj.Hash {
+	return ent.headHash
+}
+
+// IndexHash returns the hash of the file's object in the index or the
+// zero hash if the file is not in the index or is unmerged.
+func (ent *StatusEntry) IndexHash() gitobj.Hash {
+	return ent.indexHash
+}
+
+// Stage returns the mode and hash of the given stage of an unmerged
+// file: 1 for the common ancestor, 2 for HEAD, and 3 for the other
+// side of the merge. It returns zero values if the stage is absent or
+// the file is not unmerged.
+func (ent *StatusEntry) Stage(n int) (gitobj.Mode, gitobj.Hash) {
+	if n < 1 || n > len(ent.stageModes) {
+		return 0, gitobj.Hash{}
+	}
+	return ent.stageModes[n-1], ent.stageHashes[n-1]
+}
+
+// Submodule returns the state of the file if it is a submodule.
+func (ent *StatusEntry) Submodule() SubmoduleStatus {
+	return ent.sub
+}
+
+// SubmoduleStatus describes the state of a submodule in the working
+// copy. The zero value describes a file that is not a submodule.
+type SubmoduleStatus struct {
+	IsSubmodule bool
+
+	// CommitChanged is true if the submodule's HEAD is not the commit
+	// recorded in the index.
+	CommitChanged bool
+
+	// Modified is true if the submodule has changes to tracked files.
+	Modified bool
+
+	// HasUntracked is true if the submodule has untracked files.
+	HasUntracked bool
+}
+
 // A StatusCode is a two-letter code from the `git status` short format.
 // For paths with no merge conflicts, the first letter is the status of
 // the index and the second letter is the status of the work tree.
@@ -15,9 +15,21 @@
 package gittool
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+const (
+	testHash1 = "ce013625030ba8dba906f756967f9e9ca394464a"
+	testHash2 = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+	zeroHash  = "0000000000000000000000000000000000000000"
 )
 
 func TestReadStatusEntry(t *testing.T) {
@@ -38,24 +50,30 @@ func TestReadStatusEntry(t *testing.T) {
 		},
 		{
 			name:    "ModifiedWorkTree",
-			data:    " M foo.txt\x00",
+			data:    "1 .M N... 100644 100644 100644 " + testHash1 + " " + testHash1 + " foo.txt\x00",
 			code:    StatusCode{' ', 'M'},
 			entName: "foo.txt",
 		},
 		{
 			name: "MissingNul",
-			data: " M foo.txt",
+			data: "1 .M N... 100644 100644 100644 " + testHash1 + " " + testHash1 + " foo.txt",
 			err:  func(e error) bool { return e != nil && e != io.EOF },
 		},
 		{
 			name:    "ModifiedIndex",
-			data:    "MM foo.txt\x00",
+			data:    "1 MM N... 100644 100644 100644 " + testHash1 + " " + testHash2 + " foo.txt\x00",
 			code:    StatusCode{'M', 'M'},
 			entName: "foo.txt",
 		},
+		{
+			name:    "SpaceInName",
+			data:    "1 A. N... 000000 100644 100644 " + zeroHash + " " + testHash1 + " foo bar.txt\x00",
+			code:    StatusCode{'A', ' '},
+			entName: "foo bar.txt",
+		},
 		{
 			name:    "Renamed",
-			data:    "R  bar.txt\x00foo.txt\x00",
+			data:    "2 R. N... 100644 100644 100644 " + testHash1 + " " + testHash1 + " R100 bar.txt\x00foo.txt\x00",
 			code:    StatusCode{'R', ' '},
 			entName: "bar.txt",
 			from:    "foo.txt",
@@ -63,18 +81,47 @@ func TestReadStatusEntry(t *testing.T) {
 		{
 			// Regression test for https://github.com/zombiezen/gg/issues/44
 			name:    "RenamedLocally",
-			data:    " R bar.txt\x00foo.txt\x00",
+			data:    "2 .R N... 100644 100644 100644 " + testHash1 + " " + testHash1 + " R100 bar.txt\x00foo.txt\x00",
 			code:    StatusCode{' ', 'R'},
 			entName: "bar.txt",
 			from:    "foo.txt",
 		},
+		{
+			name:    "Untracked",
+			data:    "? foo.txt\x00",
+			code:    StatusCode{'?', '?'},
+			entName: "foo.txt",
+		},
+		{
+			name:    "Ignored",
+			data:    "! foo.txt\x00",
+			code:    StatusCode{'!', '!'},
+			entName: "foo.txt",
+		},
+		{
+			name:    "Unmerged",
+			data:    "u UU N... 100644 100644 100644 100644 " + testHash1 + " " + testHash2 + " " + testHash1 + " foo.txt\x00",
+			code:    StatusCode{'U', 'U'},
+			entName: "foo.txt",
+		},
+		{
+			name:    "LongName",
+			data:    "? " + strings.Repeat("a", 5000) + "\x00",
+			code:    StatusCode{'?', '?'},
+			entName: strings.Repeat("a", 5000),
+		},
+		{
+			name: "BadCode",
+			data: "1 XY N... 100644 100644 100644 " + testHash1 + " " + testHash1 + " foo.txt\x00",
+			err:  func(e error) bool { return e != nil && e != io.EOF },
+		},
 		{
 			name:      "Multiple",
-			data:      "R  bar.txt\x00foo.txt\x00MM baz.txt\x00",
+			data:      "2 R. N... 100644 100644 100644 " + testHash1 + " " + testHash1 + " R100 bar.txt\x00foo.txt\x00? baz.txt\x00",
 			code:      StatusCode{'R', ' '},
 			entName:   "bar.txt",
 			from:      "foo.txt",
-			remaining: "MM baz.txt\x00",
+			remaining: "? baz.txt\x00",
 		},
 	}
 	for _, test := range tests {
@@ -109,3 +156,278 @@ func TestReadStatusEntry(t *testing.T) {
 		})
 	}
 }
+
+func TestReadStatusEntryV1(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+
+		code      StatusCode
+		entName   string
+		from      string
+		err       func(error) bool
+		remaining string
+	}{
+		{
+			name: "Empty",
+			data: "",
+			err:  func(e error) bool { return e == io.EOF },
+		},
+		{
+			name:    "ModifiedWorkTree",
+			data:    " M foo.txt\x00",
+			code:    StatusCode{' ', 'M'},
+			entName: "foo.txt",
+		},
+		{
+			name: "MissingNul",
+			data: " M foo.txt",
+			err:  func(e error) bool { return e != nil && e != io.EOF },
+		},
+		{
+			name:    "ModifiedIndex",
+			data:    "MM foo.txt\x00",
+			code:    StatusCode{'M', 'M'},
+			entName: "foo.txt",
+		},
+		{
+			name:    "Renamed",
+			data:    "R  bar.txt\x00foo.txt\x00",
+			code:    StatusCode{'R', ' '},
+			entName: "bar.txt",
+			from:    "foo.txt",
+		},
+		{
+			// Regression test for https://github.com/zombiezen/gg/issues/44
+			name:    "RenamedLocally",
+			data:    " R bar.txt\x00foo.txt\x00",
+			code:    StatusCode{' ', 'R'},
+			entName: "bar.txt",
+			from:    "foo.txt",
+		},
+		{
+			name:      "Multiple",
+			data:      "R  bar.txt\x00foo.txt\x00MM baz.txt\x00",
+			code:      StatusCode{'R', ' '},
+			entName:   "bar.txt",
+			from:      "foo.txt",
+			remaining: "MM baz.txt\x00",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := strings.NewReader(test.data)
+			var ent StatusEntry
+			err := readStatusEntryV1(&ent, r)
+			if remaining := test.data[len(test.data)-r.Len():]; remaining != test.remaining {
+				t.Errorf("after readStatusEntryV1, remaining = %q; want %q", remaining, test.remaining)
+			}
+			if err != nil {
+				if test.err == nil {
+					t.Fatalf("readStatusEntryV1(...) = _, %v; want <nil>", err)
+				}
+				if !test.err(err) {
+					t.Fatalf("readStatusEntryV1(...) = _, %v", err)
+				}
+				return
+			}
+			if test.err != nil {
+				t.Fatal("readStatusEntryV1(...) = _, <nil>; want error")
+			}
+			if got, want := ent.Code(), test.code; got != want {
+				t.Errorf("readStatusEntryV1(...).Code() = '%v'; want '%v'", got, want)
+			}
+			if got, want := ent.Name(), test.entName; got != want {
+				t.Errorf("readStatusEntryV1(...).Name() = %q; want %q", got, want)
+			}
+			if got, want := ent.From(), test.from; got != want {
+				t.Errorf("readStatusEntryV1(...).From() = %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestReadStatusEntry_Details(t *testing.T) {
+	data := "2 RM SCMU 160000 160000 160000 " + testHash1 + " " + testHash2 + " R87 new\x00old\x00" +
+		"u AA N... 000000 100644 100755 100644 " + zeroHash + " " + testHash1 + " " + testHash2 + " conflict.txt\x00"
+	r := strings.NewReader(data)
+
+	var ent StatusEntry
+	if err := readStatusEntry(&ent, r); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ent.Score(), 87; got != want {
+		t.Errorf("Score() = %d; want %d", got, want)
+	}
+	if got, want := ent.HeadMode(), gitobj.ModeSubmodule; got != want {
+		t.Errorf("HeadMode() = %v; want %v", got, want)
+	}
+	if got, want := ent.IndexMode(), gitobj.ModeSubmodule; got != want {
+		t.Errorf("IndexMode() = %v; want %v", got, want)
+	}
+	if got, want := ent.WorkTreeMode(), gitobj.ModeSubmodule; got != want {
+		t.Errorf("WorkTreeMode() = %v; want %v", got, want)
+	}
+	if got, want := ent.HeadHash().String(), testHash1; got != want {
+		t.Errorf("HeadHash() = %s; want %s", got, want)
+	}
+	if got, want := ent.IndexHash().String(), testHash2; got != want {
+		t.Errorf("IndexHash() = %s; want %s", got, want)
+	}
+	wantSub := SubmoduleStatus{IsSubmodule: true, CommitChanged: true, Modified: true, HasUntracked: true}
+	if got := ent.Submodule(); got != wantSub {
+		t.Errorf("Submodule() = %+v; want %+v", got, wantSub)
+	}
+	if !ent.Code().IsRenamed() {
+		t.Errorf("Code() = '%v'; want renamed", ent.Code())
+	}
+
+	if err := readStatusEntry(&ent, r); err != nil {
+		t.Fatal(err)
+	}
+	if !ent.Code().IsUnmerged() {
+		t.Errorf("Code() = '%v'; want unmerged", ent.Code())
+	}
+	if ent.Submodule().IsSubmodule {
+		t.Error("Submodule().IsSubmodule = true for regular file")
+	}
+	if ent.Score() != 0 || ent.From() != "" {
+		t.Errorf("Score(), From() = %d, %q; want 0, \"\"", ent.Score(), ent.From())
+	}
+	wantStages := []struct {
+		mode gitobj.Mode
+		hash string
+	}{
+		{0, zeroHash},
+		{gitobj.ModeFile, testHash1},
+		{gitobj.ModeExecutable, testHash2},
+	}
+	for i, want := range wantStages {
+		mode, hash := ent.Stage(i + 1)
+		if mode != want.mode || hash.String() != want.hash {
+			t.Errorf("Stage(%d) = %v, %v; want %v, %s", i+1, mode, hash, want.mode, want.hash)
+		}
+	}
+}
+
+func TestReadBranchHeader(t *testing.T) {
+	data := "# branch.oid " + testHash1 + "\x00" +
+		"# branch.head feature\x00" +
+		"# branch.upstream origin/master\x00" +
+		"# branch.ab +2 -13\x00"
+	r := strings.NewReader(data)
+	var info BranchInfo
+	for r.Len() > 0 {
+		if err := readBranchHeader(&info, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := BranchInfo{
+		Head:     "feature",
+		Upstream: "origin/master",
+		Ahead:    2,
+		Behind:   13,
+	}
+	want.Commit, _ = gitobj.ParseHash(testHash1)
+	if info != want {
+		t.Errorf("BranchInfo = %+v; want %+v", info, want)
+	}
+
+	r = strings.NewReader("# branch.oid (initial)\x00# branch.head (detached)\x00")
+	info = BranchInfo{}
+	for r.Len() > 0 {
+		if err := readBranchHeader(&info, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info != (BranchInfo{}) {
+		t.Errorf("BranchInfo = %+v; want zero", info)
+	}
+}
+
+func TestStatusWithOptions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	env, err := newTestEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.cleanup()
+
+	if err := env.git.Run(ctx, "init", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(env.root, "repo")
+	git := env.git.WithDir(repo)
+	if err := ioutil.WriteFile(filepath.Join(repo, "foo.txt"), []byte("Hello\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "add", "foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Run(ctx, "commit", "-m", "first commit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, "foo.txt"), []byte("Changed\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(repo, "foo.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	head, err := ParseRev(ctx, git, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := StatusWithOptions(ctx, git, nil, &StatusOptions{IncludeBranch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if got := st.Branch(); got == nil {
+		t.Error("Branch() = nil")
+	} else if got.Commit != head.Commit() || got.Head != "master" {
+		t.Errorf("Branch() = %+v; want Commit = %v, Head = \"master\"", got, head.Commit())
+	}
+	if !st.Scan() {
+		t.Fatal("Scan() = false:", st.Err())
+	}
+	ent := st.Entry()
+	if ent.Name() != "foo.txt" || !ent.Code().IsModified() {
+		t.Errorf("Entry() = %v; want modified foo.txt", ent)
+	}
+	if got := ent.HeadMode(); got != gitobj.ModeFile {
+		t.Errorf("HeadMode() = %v; want %v", got, gitobj.ModeFile)
+	}
+	if got := ent.WorkTreeMode(); got != gitobj.ModeExecutable {
+		t.Errorf("WorkTreeMode() = %v; want %v", got, gitobj.ModeExecutable)
+	}
+	if st.Scan() {
+		t.Errorf("extra entry %v", st.Entry())
+	}
+	if err := st.Err(); err != nil {
+		t.Error(err)
+	}
+
+	plain, err := Status(ctx, git, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if got := plain.Branch(); got != nil {
+		t.Errorf("Branch() = %+v without IncludeBranch; want nil", got)
+	}
+	if !plain.Scan() {
+		t.Fatal("Scan() = false:", plain.Err())
+	}
+	if ent := plain.Entry(); ent.Name() != "foo.txt" || !ent.Code().IsModified() {
+		t.Errorf("Entry() = %v; want modified foo.txt", ent)
+	} else if got := ent.HeadMode(); got != 0 {
+		t.Errorf("HeadMode() = %v without IncludeDetails; want 0", got)
+	}
+}
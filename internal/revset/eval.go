@@ -0,0 +1,833 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+// Eval evaluates the expression against the repository, returning the
+// matching commits newest first. If the expression needs the commit
+// graph, the commits are in reverse topological order (children before
+// parents); otherwise, they are sorted by commit date.
+//
+// The set of commits considered is everything reachable from branches,
+// remote-tracking branches, tags, HEAD, and any revisions named in the
+// expression. Only the functions that need the whole set, like all(),
+// descendants(), heads(), and roots(), walk all of it.
+func (e *Expr) Eval(ctx context.Context, git *gittool.Tool) ([]gitobj.Hash, error) {
+	ev := &evaluator{
+		ctx:     ctx,
+		git:     git,
+		symbols: make(map[string]hashSet),
+	}
+	if err := ev.resolveSymbols(e.root, false); err != nil {
+		return nil, fmt.Errorf("evaluate revset %q: %v", e, err)
+	}
+	ev.tips = append(ev.tips, "--branches", "--remotes", "--tags")
+	if ok, err := git.Query(ctx, "rev-parse", "-q", "--verify", "HEAD^{commit}"); err == nil && ok {
+		ev.tips = append(ev.tips, "HEAD")
+	}
+	set, err := ev.eval(e.root)
+	if err != nil {
+		return nil, fmt.Errorf("evaluate revset %q: %v", e, err)
+	}
+	if len(set) == 0 {
+		return nil, nil
+	}
+	if ev.parents == nil {
+		// Sort without walking the history.
+		result, err := ev.revListWithInput(hashInput(set, nil), "--no-walk", "--stdin")
+		if err != nil {
+			return nil, fmt.Errorf("evaluate revset %q: %v", e, err)
+		}
+		return result, nil
+	}
+	var result []gitobj.Hash
+	for _, h := range ev.order {
+		if set.has(h) {
+			result = append(result, h)
+		}
+	}
+	return result, nil
+}
+
+type hashSet map[gitobj.Hash]struct{}
+
+func (s hashSet) add(h gitobj.Hash) {
+	s[h] = struct{}{}
+}
+
+func (s hashSet) has(h gitobj.Hash) bool {
+	_, ok := s[h]
+	return ok
+}
+
+type evaluator struct {
+	ctx context.Context
+	git *gittool.Tool
+
+	// symbols maps the revisions named in the expression to their commits.
+	symbols map[string]hashSet
+	// tips is the list of git rev-list arguments that select every
+	// commit under consideration.
+	tips []string
+
+	// order, parents, and children are the commit graph of every commit
+	// under consideration. They are nil until loadGraph is called.
+	order    []gitobj.Hash
+	parents  map[gitobj.Hash][]gitobj.Hash
+	children map[gitobj.Hash][]gitobj.Hash
+}
+
+// stringArgFuncs is the set of functions whose arguments are strings
+// rather than revsets.
+var stringArgFuncs = map[string]bool{
+	"author":   true,
+	"branch":   true,
+	"changeid": true,
+	"date":     true,
+	"file":     true,
+	"keyword":  true,
+}
+
+// resolveSymbols finds the commits for every revision in the
+// expression.
+func (ev *evaluator) resolveSymbols(n node, isString bool) error {
+	switch n := n.(type) {
+	case *symbolNode:
+		if isString {
+			return nil
+		}
+		if _, done := ev.symbols[n.name]; done {
+			return nil
+		}
+		set, tips, err := ev.resolveSymbol(n.name)
+		if err != nil {
+			return err
+		}
+		ev.symbols[n.name] = set
+		ev.tips = append(ev.tips, tips...)
+	case *funcNode:
+		for _, arg := range n.args {
+			if err := ev.resolveSymbols(arg, stringArgFuncs[n.name]); err != nil {
+				return err
+			}
+		}
+	case *andNode:
+		if err := ev.resolveSymbols(n.x, false); err != nil {
+			return err
+		}
+		return ev.resolveSymbols(n.y, false)
+	case *orNode:
+		if err := ev.resolveSymbols(n.x, false); err != nil {
+			return err
+		}
+		return ev.resolveSymbols(n.y, false)
+	case *notNode:
+		return ev.resolveSymbols(n.x, false)
+	case *dagRangeNode:
+		if n.from != nil {
+			if err := ev.resolveSymbols(n.from, false); err != nil {
+				return err
+			}
+		}
+		if n.to != nil {
+			return ev.resolveSymbols(n.to, false)
+		}
+	}
+	return nil
+}
+
+// resolveSymbol resolves a git revision or revision range to a set of
+// commits. It also returns the positive revisions that must be walked
+// to reach the set.
+func (ev *evaluator) resolveSymbol(rev string) (hashSet, []string, error) {
+	if strings.HasPrefix(rev, "-") {
+		return nil, nil, fmt.Errorf("revision %q cannot start with '-'", rev)
+	}
+	set := make(hashSet)
+	if !strings.Contains(rev, "..") {
+		out, err := ev.git.RunOneLiner(ev.ctx, '\n', "rev-parse", "-q", "--verify", "--revs-only", rev+"^{commit}")
+		if err != nil || len(out) == 0 {
+			return nil, nil, fmt.Errorf("unknown revision %q", rev)
+		}
+		h, err := gitobj.ParseHash(string(out))
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolve %q: %v", rev, err)
+		}
+		set.add(h)
+		return set, []string{h.String()}, nil
+	}
+	hashes, err := ev.revList(rev, "--")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, h := range hashes {
+		set.add(h)
+	}
+	var tips []string
+	err = ev.lines(nil, []string{"rev-parse", "--revs-only", rev, "--"}, func(line string) error {
+		if !strings.HasPrefix(line, "^") {
+			tips = append(tips, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return set, tips, nil
+}
+
+// loadGraph reads the parents of every commit under consideration if
+// it hasn't already. Since this walks the entire history, it is only
+// used for the functions that need it.
+func (ev *evaluator) loadGraph() error {
+	if ev.parents != nil {
+		return nil
+	}
+	var order []gitobj.Hash
+	parents := make(map[gitobj.Hash][]gitobj.Hash)
+	children := make(map[gitobj.Hash][]gitobj.Hash)
+	args := append([]string{"rev-list", "--date-order", "--parents"}, ev.tips...)
+	args = append(args, "--")
+	err := ev.lines(nil, args, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil
+		}
+		h, err := gitobj.ParseHash(fields[0])
+		if err != nil {
+			return fmt.Errorf("parse rev-list: %v", err)
+		}
+		order = append(order, h)
+		ps := make([]gitobj.Hash, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			p, err := gitobj.ParseHash(f)
+			if err != nil {
+				return fmt.Errorf("parse rev-list: %v", err)
+			}
+			ps = append(ps, p)
+			children[p] = append(children[p], h)
+		}
+		parents[h] = ps
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ev.order, ev.parents, ev.children = order, parents, children
+	return nil
+}
+
+func (ev *evaluator) eval(n node) (hashSet, error) {
+	switch n := n.(type) {
+	case *symbolNode:
+		return ev.symbols[n.name], nil
+	case *andNode:
+		x, err := ev.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		// Optimize "X and not Y" to avoid evaluating the universe.
+		if not, ok := n.y.(*notNode); ok {
+			y, err := ev.eval(not.x)
+			if err != nil {
+				return nil, err
+			}
+			return difference(x, y), nil
+		}
+		y, err := ev.eval(n.y)
+		if err != nil {
+			return nil, err
+		}
+		return intersect(x, y), nil
+	case *orNode:
+		x, err := ev.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		y, err := ev.eval(n.y)
+		if err != nil {
+			return nil, err
+		}
+		set := make(hashSet, len(x)+len(y))
+		for h := range x {
+			set.add(h)
+		}
+		for h := range y {
+			set.add(h)
+		}
+		return set, nil
+	case *notNode:
+		x, err := ev.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		all, err := ev.all()
+		if err != nil {
+			return nil, err
+		}
+		return difference(all, x), nil
+	case *dagRangeNode:
+		switch {
+		case n.from == nil:
+			to, err := ev.eval(n.to)
+			if err != nil {
+				return nil, err
+			}
+			return ev.ancestors(to)
+		case n.to == nil:
+			from, err := ev.eval(n.from)
+			if err != nil {
+				return nil, err
+			}
+			return ev.descendants(from)
+		default:
+			from, err := ev.eval(n.from)
+			if err != nil {
+				return nil, err
+			}
+			to, err := ev.eval(n.to)
+			if err != nil {
+				return nil, err
+			}
+			if err := ev.loadGraph(); err != nil {
+				return nil, err
+			}
+			ancestors, err := ev.ancestors(to)
+			if err != nil {
+				return nil, err
+			}
+			return intersect(ev.reachableFrom(from, ev.children), ancestors), nil
+		}
+	case *funcNode:
+		return ev.call(n)
+	default:
+		panic("unknown node type")
+	}
+}
+
+func (ev *evaluator) call(n *funcNode) (hashSet, error) {
+	switch n.name {
+	case "all":
+		if err := checkArgCount(n, 0, 0); err != nil {
+			return nil, err
+		}
+		return ev.all()
+	case "ancestors":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		x, err := ev.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return ev.ancestors(x)
+	case "descendants":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		x, err := ev.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return ev.descendants(x)
+	case "heads":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		x, err := ev.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := ev.loadGraph(); err != nil {
+			return nil, err
+		}
+		return filterEdges(x, ev.children), nil
+	case "roots":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		x, err := ev.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := ev.loadGraph(); err != nil {
+			return nil, err
+		}
+		return filterEdges(x, ev.parents), nil
+	case "only":
+		if err := checkArgCount(n, 1, 2); err != nil {
+			return nil, err
+		}
+		x, err := ev.eval(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		var y hashSet
+		if len(n.args) == 2 {
+			y, err = ev.eval(n.args[1])
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// Default to every other branch.
+			y, err = ev.refs("refs/heads/")
+			if err != nil {
+				return nil, err
+			}
+			y = difference(y, x)
+		}
+		return ev.ancestorsExcept(x, y)
+	case "branch":
+		if err := checkArgCount(n, 0, 1); err != nil {
+			return nil, err
+		}
+		if len(n.args) == 0 {
+			return ev.refs("refs/heads/")
+		}
+		name, err := stringArg(n, 0)
+		if err != nil {
+			return nil, err
+		}
+		set, err := ev.refs("refs/heads/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if len(set) == 0 && !strings.ContainsAny(name, "*?[") {
+			return nil, fmt.Errorf("branch %q not found", name)
+		}
+		return set, nil
+	case "draft":
+		if err := checkArgCount(n, 0, 0); err != nil {
+			return nil, err
+		}
+		local, err := ev.refs("refs/heads/")
+		if err != nil {
+			return nil, err
+		}
+		if head, _, err := ev.resolveSymbol("HEAD"); err == nil {
+			// Include a detached HEAD.
+			for h := range head {
+				local.add(h)
+			}
+		}
+		public, err := ev.publicHeads()
+		if err != nil {
+			return nil, err
+		}
+		return ev.ancestorsExcept(local, public)
+	case "public":
+		if err := checkArgCount(n, 0, 0); err != nil {
+			return nil, err
+		}
+		public, err := ev.publicHeads()
+		if err != nil {
+			return nil, err
+		}
+		return ev.ancestors(public)
+	case "author":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		pattern, err := stringArg(n, 0)
+		if err != nil {
+			return nil, err
+		}
+		if pattern == "me" {
+			cfg, err := gittool.ReadConfig(ev.ctx, ev.git)
+			if err != nil {
+				return nil, err
+			}
+			email := cfg.Value("user.email")
+			if email == "" {
+				return nil, fmt.Errorf("author(me): user.email not set")
+			}
+			return ev.filter("--fixed-strings", "--author=<"+email+">")
+		}
+		return ev.filter("--regexp-ignore-case", "--author="+pattern)
+	case "keyword":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		s, err := stringArg(n, 0)
+		if err != nil {
+			return nil, err
+		}
+		inMessage, err := ev.filter("--regexp-ignore-case", "--fixed-strings", "--grep="+s)
+		if err != nil {
+			return nil, err
+		}
+		inAuthor, err := ev.filter("--regexp-ignore-case", "--fixed-strings", "--author="+s)
+		if err != nil {
+			return nil, err
+		}
+		for h := range inAuthor {
+			inMessage.add(h)
+		}
+		return inMessage, nil
+	case "date":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		spec, err := stringArg(n, 0)
+		if err != nil {
+			return nil, err
+		}
+		args, err := dateArgs(spec)
+		if err != nil {
+			return nil, err
+		}
+		return ev.filter(args...)
+	case "file":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		pattern, err := stringArg(n, 0)
+		if err != nil {
+			return nil, err
+		}
+		return ev.filter("--full-history", "--", pattern)
+	case "changeid":
+		if err := checkArgCount(n, 1, 1); err != nil {
+			return nil, err
+		}
+		id, err := stringArg(n, 0)
+		if err != nil {
+			return nil, err
+		}
+		hex := strings.TrimPrefix(id, "I")
+		if hex == "" || !isHex(hex) {
+			return nil, fmt.Errorf("changeid(%q): not a change ID", id)
+		}
+		return ev.filter("--grep=^Change-Id: I" + hex)
+	default:
+		return nil, fmt.Errorf("unknown function %s", n.name)
+	}
+}
+
+func checkArgCount(n *funcNode, min, max int) error {
+	if len(n.args) >= min && len(n.args) <= max {
+		return nil
+	}
+	switch {
+	case min == max && min == 0:
+		return fmt.Errorf("%s takes no arguments", n.name)
+	case min == max && min == 1:
+		return fmt.Errorf("%s takes 1 argument", n.name)
+	case min == max:
+		return fmt.Errorf("%s takes %d arguments", n.name, min)
+	default:
+		return fmt.Errorf("%s takes %d to %d arguments", n.name, min, max)
+	}
+}
+
+func stringArg(n *funcNode, i int) (string, error) {
+	sym, ok := n.args[i].(*symbolNode)
+	if !ok {
+		return "", fmt.Errorf("%s: argument %d must be a string", n.name, i+1)
+	}
+	return sym.name, nil
+}
+
+// dateArgs converts a Mercurial-style date specification into git
+// rev-list arguments.
+func dateArgs(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return nil, fmt.Errorf("date: empty specification")
+	case strings.HasPrefix(spec, "<"):
+		return []string{"--until=" + strings.TrimSpace(spec[1:])}, nil
+	case strings.HasPrefix(spec, ">"):
+		return []string{"--since=" + strings.TrimSpace(spec[1:])}, nil
+	case strings.HasPrefix(spec, "-"):
+		days, err := strconv.Atoi(spec[1:])
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("date: %q is not a number of days", spec[1:])
+		}
+		return []string{fmt.Sprintf("--since=%d days ago", days)}, nil
+	}
+	if i := strings.Index(spec, " to "); i != -1 {
+		return []string{
+			"--since=" + strings.TrimSpace(spec[:i]),
+			"--until=" + strings.TrimSpace(spec[i+len(" to "):]),
+		}, nil
+	}
+	return []string{"--since=" + spec + " 00:00:00", "--until=" + spec + " 23:59:59"}, nil
+}
+
+// all returns every commit under consideration.
+func (ev *evaluator) all() (hashSet, error) {
+	if err := ev.loadGraph(); err != nil {
+		return nil, err
+	}
+	set := make(hashSet, len(ev.order))
+	for _, h := range ev.order {
+		set.add(h)
+	}
+	return set, nil
+}
+
+// ancestors returns the commits in x and all their ancestors.
+func (ev *evaluator) ancestors(x hashSet) (hashSet, error) {
+	return ev.ancestorsExcept(x, nil)
+}
+
+// ancestorsExcept returns the commits in x and their ancestors that
+// are not ancestors of y. If the commit graph has not been loaded, it
+// only walks the history between them.
+func (ev *evaluator) ancestorsExcept(x, y hashSet) (hashSet, error) {
+	if ev.parents != nil {
+		return difference(ev.reachableFrom(x, ev.parents), ev.reachableFrom(y, ev.parents)), nil
+	}
+	set := make(hashSet)
+	if len(x) == 0 {
+		return set, nil
+	}
+	hashes, err := ev.revListWithInput(hashInput(x, y), "--stdin")
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hashes {
+		set.add(h)
+	}
+	return set, nil
+}
+
+// descendants returns the commits in x and all their descendants,
+// where a descendant of X is any commit reachable by a branch that
+// contains X.
+func (ev *evaluator) descendants(x hashSet) (hashSet, error) {
+	if err := ev.loadGraph(); err != nil {
+		return nil, err
+	}
+	branches, err := ev.refs("refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := ev.ancestors(branches)
+	if err != nil {
+		return nil, err
+	}
+	return intersect(ev.reachableFrom(x, ev.children), ancestors), nil
+}
+
+// reachableFrom returns the commits in x and all the commits reachable
+// from them by following the given edges.
+func (ev *evaluator) reachableFrom(x hashSet, edges map[gitobj.Hash][]gitobj.Hash) hashSet {
+	set := make(hashSet)
+	stack := make([]gitobj.Hash, 0, len(x))
+	for h := range x {
+		stack = append(stack, h)
+	}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if set.has(h) {
+			continue
+		}
+		set.add(h)
+		stack = append(stack, edges[h]...)
+	}
+	return set
+}
+
+// filterEdges returns the commits in x that have no edges to other
+// commits in x.
+func filterEdges(x hashSet, edges map[gitobj.Hash][]gitobj.Hash) hashSet {
+	set := make(hashSet)
+outer:
+	for h := range x {
+		for _, e := range edges[h] {
+			if x.has(e) {
+				continue outer
+			}
+		}
+		set.add(h)
+	}
+	return set
+}
+
+// refs returns the commits pointed to by refs matching the
+// git for-each-ref pattern.
+func (ev *evaluator) refs(patterns ...string) (hashSet, error) {
+	set := make(hashSet)
+	args := append([]string{"for-each-ref", "--format=%(objecttype) %(objectname) %(*objecttype) %(*objectname)"}, patterns...)
+	err := ev.lines(nil, args, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil
+		}
+		// Use the peeled object for annotated tags.
+		if len(fields) == 4 {
+			fields = fields[2:]
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("parse for-each-ref: wrong number of fields")
+		}
+		if fields[0] != "commit" {
+			return nil
+		}
+		h, err := gitobj.ParseHash(fields[1])
+		if err != nil {
+			return fmt.Errorf("parse for-each-ref: %v", err)
+		}
+		set.add(h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// publicHeads returns the commits pointed to by public refs.
+func (ev *evaluator) publicHeads() (hashSet, error) {
+	cfg, err := gittool.ReadConfig(ev.ctx, ev.git)
+	if err != nil {
+		return nil, err
+	}
+	return ev.refs(PublicRefs(cfg)...)
+}
+
+// PublicRefs returns the git for-each-ref patterns that match refs
+// whose commits are public: remote-tracking branches and any patterns
+// listed in the whitespace-separated gg.publicRefs configuration
+// setting. Commits that are not reachable from a public ref are drafts.
+func PublicRefs(cfg *gittool.Config) []string {
+	return append([]string{"refs/remotes/"}, strings.Fields(cfg.Value("gg.publicRefs"))...)
+}
+
+// filter returns the commits under consideration that match the given
+// git rev-list options.
+func (ev *evaluator) filter(opts ...string) (hashSet, error) {
+	args := append([]string(nil), opts...)
+	var paths []string
+	for i, a := range args {
+		if a == "--" {
+			paths = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+	args = append(args, ev.tips...)
+	args = append(args, "--")
+	args = append(args, paths...)
+	hashes, err := ev.revList(args...)
+	if err != nil {
+		return nil, err
+	}
+	set := make(hashSet, len(hashes))
+	for _, h := range hashes {
+		set.add(h)
+	}
+	return set, nil
+}
+
+func (ev *evaluator) revList(args ...string) ([]gitobj.Hash, error) {
+	return ev.revListWithInput(nil, args...)
+}
+
+// revListWithInput runs git rev-list with its stdin connected to input
+// for use with --stdin.
+func (ev *evaluator) revListWithInput(input io.Reader, args ...string) ([]gitobj.Hash, error) {
+	var hashes []gitobj.Hash
+	err := ev.lines(input, append([]string{"rev-list"}, args...), func(line string) error {
+		h, err := gitobj.ParseHash(line)
+		if err != nil {
+			return fmt.Errorf("parse rev-list: %v", err)
+		}
+		hashes = append(hashes, h)
+		return nil
+	})
+	return hashes, err
+}
+
+// hashInput formats the commits in x, followed by the negated commits
+// in y, as git rev-list --stdin input.
+func hashInput(x, y hashSet) io.Reader {
+	buf := new(bytes.Buffer)
+	for h := range x {
+		fmt.Fprintln(buf, h)
+	}
+	for h := range y {
+		fmt.Fprintf(buf, "^%v\n", h)
+	}
+	return buf
+}
+
+// lines runs git with the given arguments and input and calls f for
+// each line of output. A nil input is treated as empty.
+func (ev *evaluator) lines(input io.Reader, args []string, f func(string) error) error {
+	p, err := ev.git.StartWithInput(ev.ctx, input, args...)
+	if err != nil {
+		return err
+	}
+	defer p.Wait()
+	s := bufio.NewScanner(p)
+	for s.Scan() {
+		if err := f(s.Text()); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+func intersect(x, y hashSet) hashSet {
+	if len(y) < len(x) {
+		x, y = y, x
+	}
+	set := make(hashSet)
+	for h := range x {
+		if y.has(h) {
+			set.add(h)
+		}
+	}
+	return set
+}
+
+func difference(x, y hashSet) hashSet {
+	set := make(hashSet)
+	for h := range x {
+		if !y.has(h) {
+			set.add(h)
+		}
+	}
+	return set
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revset
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+	"zombiezen.com/go/gg/internal/gittool"
+)
+
+var (
+	gitPath      string
+	gitPathError error
+)
+
+func TestMain(m *testing.M) {
+	gitPath, gitPathError = exec.LookPath("git")
+	os.Exit(m.Run())
+}
+
+func TestEval(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping due to -short")
+	}
+	if gitPathError != nil {
+		t.Skip("git not found:", gitPathError)
+	}
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "gg_revset_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	gitConfig := []byte("[user]\nname = User\nemail = foo@example.com\n")
+	if err := ioutil.WriteFile(filepath.Join(root, ".gitconfig"), gitConfig, 0666); err != nil {
+		t.Fatal(err)
+	}
+	repoPath := filepath.Join(root, "repo")
+	git, err := gittool.New(gitPath, repoPath, &gittool.Options{
+		Env: []string{"GIT_CONFIG_NOSYSTEM=1", "HOME=" + root},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := git.WithDir(root).Run(ctx, "init", repoPath); err != nil {
+		t.Fatal(err)
+	}
+	commit := func(file, msg string, extraArgs ...string) gitobj.Hash {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(repoPath, file), []byte(msg+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := git.Run(ctx, "add", file); err != nil {
+			t.Fatal(err)
+		}
+		args := append([]string{"commit", "--quiet", "-m", msg}, extraArgs...)
+		if err := git.Run(ctx, args...); err != nil {
+			t.Fatal(err)
+		}
+		r, err := gittool.ParseRev(ctx, git, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Commit()
+	}
+
+	// c1 -- c2 (master)
+	//   \
+	//    f1 -- f2 (feature)
+	const changeID = "I0123456789abcdef0123456789abcdef01234567"
+	c1 := commit("foo.txt", "first")
+	if err := git.Run(ctx, "update-ref", "refs/remotes/origin/master", c1.String()); err != nil {
+		t.Fatal(err)
+	}
+	c2 := commit("foo.txt", "second")
+	if err := git.Run(ctx, "checkout", "--quiet", "-b", "feature", c1.String()); err != nil {
+		t.Fatal(err)
+	}
+	f1 := commit("foo.txt", "feature one\n\nChange-Id: "+changeID, "--author=Other <other@example.com>")
+	f2 := commit("bar.txt", "feature two")
+	names := map[gitobj.Hash]string{c1: "c1", c2: "c2", f1: "f1", f2: "f2"}
+
+	tests := []struct {
+		expr string
+		want []gitobj.Hash
+	}{
+		{"HEAD", []gitobj.Hash{f2}},
+		{"master", []gitobj.Hash{c2}},
+		{"master~1..feature", []gitobj.Hash{f2, f1}},
+		{"ancestors(feature)", []gitobj.Hash{f2, f1, c1}},
+		{"::master", []gitobj.Hash{c2, c1}},
+		{"descendants(" + c1.String() + ")", []gitobj.Hash{f2, f1, c2, c1}},
+		{"master~1::", []gitobj.Hash{f2, f1, c2, c1}},
+		{"master~1::feature", []gitobj.Hash{f2, f1, c1}},
+		{"draft()", []gitobj.Hash{f2, f1, c2}},
+		{"public()", []gitobj.Hash{c1}},
+		{"draft() and author(me)", []gitobj.Hash{f2, c2}},
+		{"draft() and not author(me)", []gitobj.Hash{f1}},
+		{"heads(draft())", []gitobj.Hash{f2, c2}},
+		{"roots(draft())", []gitobj.Hash{f1, c2}},
+		{"branch(feature)", []gitobj.Hash{f2}},
+		{"branch()", []gitobj.Hash{f2, c2}},
+		{"only(feature, master)", []gitobj.Hash{f2, f1}},
+		{"only(feature)", []gitobj.Hash{f2, f1}},
+		{"keyword(OTHER)", []gitobj.Hash{f1}},
+		{"keyword('feature')", []gitobj.Hash{f2, f1}},
+		{"file(bar.txt)", []gitobj.Hash{f2}},
+		{"changeid(" + changeID[:8] + ")", []gitobj.Hash{f1}},
+		{"not ancestors(master)", []gitobj.Hash{f2, f1}},
+		{"master or feature", []gitobj.Hash{f2, c2}},
+		{"date('>2000-01-01') and ::master", []gitobj.Hash{c2, c1}},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.expr, err)
+			continue
+		}
+		got, err := e.Eval(ctx, git)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", test.expr, err)
+			continue
+		}
+		if !equalHashes(got, test.want) {
+			t.Errorf("Eval(%q) = %s; want %s", test.expr, prettyHashes(got, names), prettyHashes(test.want, names))
+		}
+	}
+
+	// Only the functions that follow edges to children or need every
+	// commit should walk the whole history.
+	var loadedGraph bool
+	hookedGit, err := gittool.New(gitPath, repoPath, &gittool.Options{
+		Env: []string{"GIT_CONFIG_NOSYSTEM=1", "HOME=" + root},
+		LogHook: func(_ context.Context, args []string) {
+			if len(args) > 0 && args[0] == "rev-list" {
+				for _, a := range args {
+					loadedGraph = loadedGraph || a == "--parents"
+				}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphTests := []struct {
+		expr string
+		want bool
+	}{
+		{"draft()", false},
+		{"::master and author(me)", false},
+		{"only(feature)", false},
+		{"heads(draft())", true},
+		{"master~1::", true},
+		{"not master", true},
+	}
+	for _, test := range graphTests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.expr, err)
+			continue
+		}
+		loadedGraph = false
+		if _, err := e.Eval(ctx, hookedGit); err != nil {
+			t.Errorf("Eval(%q): %v", test.expr, err)
+			continue
+		}
+		if loadedGraph != test.want {
+			t.Errorf("Eval(%q) loaded the commit graph = %t; want %t", test.expr, loadedGraph, test.want)
+		}
+	}
+
+	errorTests := []string{
+		"nosuchfunc()",
+		"ancestors()",
+		"branch(nosuch)",
+		"nosuchbranch",
+		"changeid(xyz)",
+		"author(ancestors(HEAD))",
+	}
+	for _, expr := range errorTests {
+		e, err := Parse(expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", expr, err)
+			continue
+		}
+		if got, err := e.Eval(ctx, git); err == nil {
+			t.Errorf("Eval(%q) = %s, <nil>; want error", expr, prettyHashes(got, names))
+		}
+	}
+}
+
+// equalHashes reports whether h1 and h2 contain the same hashes,
+// ignoring order. The commits in the test are usually created within
+// the same second, so their relative order is unspecified.
+func equalHashes(h1, h2 []gitobj.Hash) bool {
+	if len(h1) != len(h2) {
+		return false
+	}
+	set := make(map[gitobj.Hash]bool, len(h1))
+	for _, h := range h1 {
+		set[h] = true
+	}
+	for _, h := range h2 {
+		if !set[h] {
+			return false
+		}
+	}
+	return true
+}
+
+func prettyHashes(hashes []gitobj.Hash, names map[gitobj.Hash]string) string {
+	s := make([]string, len(hashes))
+	for i, h := range hashes {
+		if n := names[h]; n != "" {
+			s[i] = n
+		} else {
+			s[i] = h.String()
+		}
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
@@ -0,0 +1,398 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package revset provides a query language for selecting sets of
+// commits, modeled after Mercurial's revsets.
+//
+// An expression is built from git revisions (like "HEAD~2" or
+// "origin/master"), function calls (like "descendants(X)"), the
+// "and", "or", and "not" operators, and the "::" DAG range operator.
+// Arguments that aren't revisions, like the pattern passed to
+// author(), may be quoted with single or double quotes.
+package revset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Expr is a parsed revset expression.
+type Expr struct {
+	root node
+}
+
+// Parse parses a revset expression.
+func Parse(s string) (*Expr, error) {
+	p := &parser{s: s}
+	if err := p.next(); err != nil {
+		return nil, fmt.Errorf("parse revset %q: %v", s, err)
+	}
+	n, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("parse revset %q: %v", s, err)
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("parse revset %q: unexpected %v at %d", s, p.tok, p.tok.pos)
+	}
+	return &Expr{root: n}, nil
+}
+
+// Symbol returns the expression as a git revision if the expression
+// consists solely of one unquoted revision.
+func (e *Expr) Symbol() (rev string, ok bool) {
+	sym, ok := e.root.(*symbolNode)
+	if !ok || sym.quoted {
+		return "", false
+	}
+	return sym.name, true
+}
+
+// String returns the expression in its canonical form.
+func (e *Expr) String() string {
+	return e.root.String()
+}
+
+type node interface {
+	String() string
+}
+
+// symbolNode is a git revision or a string argument.
+type symbolNode struct {
+	name   string
+	quoted bool
+}
+
+func (n *symbolNode) String() string {
+	if !n.quoted {
+		return n.name
+	}
+	return fmt.Sprintf("%q", n.name)
+}
+
+type funcNode struct {
+	name string
+	args []node
+}
+
+func (n *funcNode) String() string {
+	args := make([]string, len(n.args))
+	for i := range n.args {
+		args[i] = n.args[i].String()
+	}
+	return n.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+type andNode struct {
+	x, y node
+}
+
+func (n *andNode) String() string {
+	return "(" + n.x.String() + " and " + n.y.String() + ")"
+}
+
+type orNode struct {
+	x, y node
+}
+
+func (n *orNode) String() string {
+	return "(" + n.x.String() + " or " + n.y.String() + ")"
+}
+
+type notNode struct {
+	x node
+}
+
+func (n *notNode) String() string {
+	return "not " + n.x.String()
+}
+
+// dagRangeNode is the "::" operator. Either side may be nil.
+type dagRangeNode struct {
+	from, to node
+}
+
+func (n *dagRangeNode) String() string {
+	sb := new(strings.Builder)
+	if n.from != nil {
+		sb.WriteString(n.from.String())
+	}
+	sb.WriteString("::")
+	if n.to != nil {
+		sb.WriteString(n.to.String())
+	}
+	return sb.String()
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokLParen
+	tokRParen
+	tokComma
+	tokDAG
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	s    string
+	pos  int
+}
+
+func (tok token) String() string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokWord:
+		return fmt.Sprintf("%q", tok.s)
+	case tokString:
+		return "string " + fmt.Sprintf("%q", tok.s)
+	default:
+		return fmt.Sprintf("%q", tok.s)
+	}
+}
+
+// parser is a recursive descent parser for the grammar:
+//
+//	expr    = and { ( "or" | "|" ) and }
+//	and     = not { ( "and" | "&" ) not }
+//	not     = ( "not" not ) | range
+//	range   = "::" primary | primary [ "::" [ primary ] ]
+//	primary = "(" expr ")" | WORD "(" [ expr { "," expr } ] ")" | WORD | STRING
+type parser struct {
+	s   string
+	pos int
+	tok token
+}
+
+func (p *parser) expr() (node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOr {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &orNode{x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokAnd {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = &andNode{x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.tok.kind != tokNot {
+		return p.dagRange()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	return &notNode{x}, nil
+}
+
+func (p *parser) dagRange() (node, error) {
+	if p.tok.kind == tokDAG {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		to, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return &dagRangeNode{to: to}, nil
+	}
+	from, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokDAG {
+		return from, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	switch p.tok.kind {
+	case tokWord, tokString, tokLParen:
+		to, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return &dagRangeNode{from: from, to: to}, nil
+	default:
+		return &dagRangeNode{from: from}, nil
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	switch p.tok.kind {
+	case tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected \")\" at %d, found %v", p.tok.pos, p.tok)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tokString:
+		n := &symbolNode{name: p.tok.s, quoted: true}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tokWord:
+		name := p.tok.s
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokLParen {
+			return &symbolNode{name: name}, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f := &funcNode{name: name}
+		if p.tok.kind == tokRParen {
+			return f, p.next()
+		}
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			f.args = append(f.args, arg)
+			if p.tok.kind == tokRParen {
+				return f, p.next()
+			}
+			if p.tok.kind != tokComma {
+				return nil, fmt.Errorf("expected \",\" or \")\" at %d, found %v", p.tok.pos, p.tok)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %v at %d", p.tok, p.tok.pos)
+	}
+}
+
+// next advances p.tok to the next token in the input.
+func (p *parser) next() error {
+	for p.pos < len(p.s) && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.s) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+	switch c := p.s[p.pos]; {
+	case c == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, s: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, s: ")", pos: start}
+	case c == ',':
+		p.pos++
+		p.tok = token{kind: tokComma, s: ",", pos: start}
+	case c == '&':
+		p.pos++
+		p.tok = token{kind: tokAnd, s: "&", pos: start}
+	case c == '|':
+		p.pos++
+		p.tok = token{kind: tokOr, s: "|", pos: start}
+	case strings.HasPrefix(p.s[p.pos:], "::"):
+		p.pos += 2
+		p.tok = token{kind: tokDAG, s: "::", pos: start}
+	case c == '\'' || c == '"':
+		sb := new(strings.Builder)
+		for p.pos++; ; p.pos++ {
+			if p.pos >= len(p.s) {
+				return fmt.Errorf("unterminated string at %d", start)
+			}
+			cc := p.s[p.pos]
+			if cc == c {
+				p.pos++
+				break
+			}
+			if cc == '\\' && p.pos+1 < len(p.s) {
+				p.pos++
+				cc = p.s[p.pos]
+			}
+			sb.WriteByte(cc)
+		}
+		p.tok = token{kind: tokString, s: sb.String(), pos: start}
+	default:
+		for p.pos < len(p.s) && !isSpace(p.s[p.pos]) && !isSpecial(p.s[p.pos]) && !strings.HasPrefix(p.s[p.pos:], "::") {
+			p.pos++
+		}
+		word := p.s[start:p.pos]
+		switch word {
+		case "and":
+			p.tok = token{kind: tokAnd, s: word, pos: start}
+		case "or":
+			p.tok = token{kind: tokOr, s: word, pos: start}
+		case "not":
+			p.tok = token{kind: tokNot, s: word, pos: start}
+		default:
+			p.tok = token{kind: tokWord, s: word, pos: start}
+		}
+	}
+	return nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isSpecial(c byte) bool {
+	return c == '(' || c == ')' || c == ',' || c == '&' || c == '|' || c == '\'' || c == '"'
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revset
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    string
+		symbol  bool
+		wantErr bool
+	}{
+		{expr: "HEAD", want: "HEAD", symbol: true},
+		{expr: "  HEAD~2 ", want: "HEAD~2", symbol: true},
+		{expr: "master@{upstream}", want: "master@{upstream}", symbol: true},
+		{expr: "origin/master..HEAD", want: "origin/master..HEAD", symbol: true},
+		{expr: ":/fix", want: ":/fix", symbol: true},
+		{expr: "HEAD^{tree}", want: "HEAD^{tree}", symbol: true},
+		{expr: "'HEAD'", want: `"HEAD"`},
+		{expr: "draft()", want: "draft()"},
+		{expr: "descendants(HEAD~1)", want: "descendants(HEAD~1)"},
+		{expr: "draft() and author(me)", want: "(draft() and author(me))"},
+		{expr: "draft() & author(me)", want: "(draft() and author(me))"},
+		{expr: "a or b and c", want: "(a or (b and c))"},
+		{expr: "a | b | c", want: "((a or b) or c)"},
+		{expr: "(a or b) and c", want: "((a or b) and c)"},
+		{expr: "not a and b", want: "(not a and b)"},
+		{expr: "not not a", want: "not not a"},
+		{expr: "a::b", want: "a::b"},
+		{expr: "a::", want: "a::"},
+		{expr: "::b", want: "::b"},
+		{expr: "a:: and b", want: "(a:: and b)"},
+		{expr: "HEAD~3::HEAD", want: "HEAD~3::HEAD"},
+		{expr: "only(a, b)", want: "only(a, b)"},
+		{expr: `date("2018-01-01 to 2018-02-01")`, want: `date("2018-01-01 to 2018-02-01")`},
+		{expr: `keyword('it\'s')`, want: `keyword("it's")`},
+		{expr: "", wantErr: true},
+		{expr: "a and", wantErr: true},
+		{expr: "(a", wantErr: true},
+		{expr: "a)", wantErr: true},
+		{expr: "f(a b)", wantErr: true},
+		{expr: "'abc", wantErr: true},
+		{expr: "a b", wantErr: true},
+	}
+	for _, test := range tests {
+		e, err := Parse(test.expr)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("Parse(%q) = _, %v; want %s", test.expr, err, test.want)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("Parse(%q) = %v, <nil>; want error", test.expr, e)
+			continue
+		}
+		if got := e.String(); got != test.want {
+			t.Errorf("Parse(%q) = %s; want %s", test.expr, got, test.want)
+		}
+		if _, got := e.Symbol(); got != test.symbol {
+			t.Errorf("Parse(%q).Symbol() ok = %t; want %t", test.expr, got, test.symbol)
+		}
+	}
+}
+
+func TestDateArgs(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: ">2018-01-01", want: []string{"--since=2018-01-01"}},
+		{spec: "<2018-01-01", want: []string{"--until=2018-01-01"}},
+		{spec: "-7", want: []string{"--since=7 days ago"}},
+		{spec: "2018-01-01 to 2018-02-01", want: []string{"--since=2018-01-01", "--until=2018-02-01"}},
+		{spec: "2018-01-01", want: []string{"--since=2018-01-01 00:00:00", "--until=2018-01-01 23:59:59"}},
+		{spec: "-x", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := dateArgs(test.spec)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("dateArgs(%q) = _, %v; want %q", test.spec, err, test.want)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("dateArgs(%q) = %q, <nil>; want error", test.spec, got)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("dateArgs(%q) = %q; want %q", test.spec, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("dateArgs(%q) = %q; want %q", test.spec, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,557 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package template implements output templates, modeled after
+// Mercurial's templates.
+//
+// A template is literal text with expressions in braces. An expression
+// is a keyword (like "{node}"), optionally followed by filters (like
+// "{node|short}"), or a function call (like "{if(branches, 'x')}").
+// The functions are if(COND, THEN[, ELSE]), ifeq(A, B, THEN[, ELSE]),
+// join(LIST, SEP), and pad(TEXT, WIDTH).
+// String arguments to functions are themselves templates. In literal
+// text and strings, "\n" and "\t" produce a newline and a tab, and "\{"
+// produces a literal brace.
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+// Keywords is the set of values available to a template. Values may be
+// a string, a []string, a bool, an int, a time.Time, a gitobj.Hash, a
+// []gitobj.Hash, or a func() (interface{}, error) that lazily computes
+// one of the former.
+type Keywords map[string]interface{}
+
+// lookup returns the resolved value of the keyword.
+func (kw Keywords) lookup(name string) (interface{}, error) {
+	v, ok := kw[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown keyword %q", name)
+	}
+	if f, ok := v.(func() (interface{}, error)); ok {
+		var err error
+		v, err = f()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		kw[name] = v
+	}
+	return v, nil
+}
+
+// MarshalJSON returns the keywords as a JSON object, with keys in
+// sorted order.
+func (kw Keywords) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(kw))
+	for k := range kw {
+		v, err := kw.lookup(k)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = jsonValue(v)
+	}
+	return json.Marshal(m)
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case gitobj.Hash:
+		return v.String()
+	case []gitobj.Hash:
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = v[i].String()
+		}
+		return s
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		if v == nil {
+			return []string{}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// A Template is a parsed template.
+type Template struct {
+	nodes []node
+}
+
+// Parse parses a template.
+func Parse(s string) (*Template, error) {
+	p := &parser{s: s}
+	nodes, err := p.text(0)
+	if err != nil {
+		return nil, fmt.Errorf("parse template %q: %v", s, err)
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+// Execute writes the template to w using the given keywords.
+func (t *Template) Execute(w io.Writer, kw Keywords) error {
+	buf := new(bytes.Buffer)
+	if err := renderNodes(buf, t.nodes, kw); err != nil {
+		return fmt.Errorf("template: %v", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func renderNodes(buf *bytes.Buffer, nodes []node, kw Keywords) error {
+	for _, n := range nodes {
+		v, err := n.eval(kw)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(stringify(v))
+	}
+	return nil
+}
+
+type node interface {
+	eval(kw Keywords) (interface{}, error)
+}
+
+type literalNode string
+
+func (n literalNode) eval(kw Keywords) (interface{}, error) {
+	return string(n), nil
+}
+
+// templateNode is a quoted string argument.
+type templateNode []node
+
+func (n templateNode) eval(kw Keywords) (interface{}, error) {
+	buf := new(bytes.Buffer)
+	if err := renderNodes(buf, n, kw); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
+}
+
+type keywordNode string
+
+func (n keywordNode) eval(kw Keywords) (interface{}, error) {
+	return kw.lookup(string(n))
+}
+
+type filterNode struct {
+	x    node
+	name string
+}
+
+func (n *filterNode) eval(kw Keywords) (interface{}, error) {
+	v, err := n.x.eval(kw)
+	if err != nil {
+		return nil, err
+	}
+	f := filters[n.name]
+	out, err := f(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.name, err)
+	}
+	return out, nil
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n *callNode) eval(kw Keywords) (interface{}, error) {
+	switch n.name {
+	case "if":
+		cond, err := n.args[0].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return n.args[1].eval(kw)
+		}
+		if len(n.args) == 3 {
+			return n.args[2].eval(kw)
+		}
+		return "", nil
+	case "ifeq":
+		a, err := n.args[0].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		b, err := n.args[1].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		if stringify(a) == stringify(b) {
+			return n.args[2].eval(kw)
+		}
+		if len(n.args) == 4 {
+			return n.args[3].eval(kw)
+		}
+		return "", nil
+	case "pad":
+		text, err := n.args[0].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		width, err := n.args[1].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		w, err := strconv.Atoi(stringify(width))
+		if err != nil {
+			return nil, fmt.Errorf("pad: width: %v", err)
+		}
+		s := stringify(text)
+		if n := utf8.RuneCountInString(s); n < w {
+			s += strings.Repeat(" ", w-n)
+		}
+		return s, nil
+	case "join":
+		list, err := n.args[0].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		sep, err := n.args[1].eval(kw)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Join(stringList(list), stringify(sep)), nil
+	default:
+		panic("unknown function " + n.name)
+	}
+}
+
+// funcArgs is the minimum and maximum number of arguments for each
+// function.
+var funcArgs = map[string][2]int{
+	"if":   {2, 3},
+	"ifeq": {3, 4},
+	"join": {2, 2},
+	"pad":  {2, 2},
+}
+
+var filters = map[string]func(interface{}) (interface{}, error){
+	"short": func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case gitobj.Hash:
+			return v.Short(), nil
+		case []gitobj.Hash:
+			s := make([]string, len(v))
+			for i := range v {
+				s[i] = v[i].Short()
+			}
+			return s, nil
+		default:
+			return nil, errors.New("argument is not a hash")
+		}
+	},
+	"firstline": func(v interface{}) (interface{}, error) {
+		s := stringify(v)
+		if i := strings.IndexByte(s, '\n'); i != -1 {
+			s = s[:i]
+		}
+		return s, nil
+	},
+	"isodate":     dateFilter("2006-01-02 15:04 -0700"),
+	"rfc3339date": dateFilter(time.RFC3339),
+	"shortdate":   dateFilter("2006-01-02"),
+	"person": func(v interface{}) (interface{}, error) {
+		s := stringify(v)
+		if i := strings.Index(s, " <"); i != -1 {
+			return s[:i], nil
+		}
+		return s, nil
+	},
+	"email": func(v interface{}) (interface{}, error) {
+		s := stringify(v)
+		i := strings.LastIndexByte(s, '<')
+		j := strings.LastIndexByte(s, '>')
+		if i == -1 || j < i {
+			return s, nil
+		}
+		return s[i+1 : j], nil
+	},
+	"json": func(v interface{}) (interface{}, error) {
+		out, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return nil, err
+		}
+		return string(out), nil
+	},
+	"lower": func(v interface{}) (interface{}, error) {
+		return strings.ToLower(stringify(v)), nil
+	},
+	"upper": func(v interface{}) (interface{}, error) {
+		return strings.ToUpper(stringify(v)), nil
+	},
+	"strip": func(v interface{}) (interface{}, error) {
+		return strings.TrimSpace(stringify(v)), nil
+	},
+	"count": func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case []string:
+			return len(v), nil
+		case []gitobj.Hash:
+			return len(v), nil
+		default:
+			return len(stringify(v)), nil
+		}
+	},
+}
+
+func dateFilter(layout string) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, errors.New("argument is not a date")
+		}
+		return t.Format(layout), nil
+	}
+}
+
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, " ")
+	case gitobj.Hash:
+		return v.String()
+	case []gitobj.Hash:
+		return strings.Join(stringList(v), " ")
+	case time.Time:
+		return v.Format("Mon Jan 02 15:04:05 2006 -0700")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []gitobj.Hash:
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = v[i].String()
+		}
+		return s
+	default:
+		if s := stringify(v); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	case []gitobj.Hash:
+		return len(v) > 0
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case time.Time:
+		return !v.IsZero()
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+// text parses literal text and expressions until the end of input or
+// the given quote character.
+func (p *parser) text(quote byte) ([]node, error) {
+	var nodes []node
+	lit := new(bytes.Buffer)
+	flush := func() {
+		if lit.Len() > 0 {
+			nodes = append(nodes, literalNode(lit.String()))
+			lit.Reset()
+		}
+	}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case quote != 0 && c == quote:
+			flush()
+			return nodes, nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos += 2
+			switch e := p.s[p.pos-1]; e {
+			case 'n':
+				lit.WriteByte('\n')
+			case 't':
+				lit.WriteByte('\t')
+			default:
+				lit.WriteByte(e)
+			}
+		case c == '{':
+			flush()
+			p.pos++
+			n, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.pos >= len(p.s) || p.s[p.pos] != '}' {
+				return nil, fmt.Errorf("expected '}' at %d", p.pos)
+			}
+			p.pos++
+			nodes = append(nodes, n)
+		default:
+			lit.WriteByte(c)
+			p.pos++
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated string")
+	}
+	flush()
+	return nodes, nil
+}
+
+func (p *parser) expr() (node, error) {
+	n, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) || p.s[p.pos] != '|' {
+			return n, nil
+		}
+		p.pos++
+		p.skipSpace()
+		name := p.ident()
+		if name == "" {
+			return nil, fmt.Errorf("expected filter name at %d", p.pos)
+		}
+		if filters[name] == nil {
+			return nil, fmt.Errorf("unknown filter %q", name)
+		}
+		n = &filterNode{x: n, name: name}
+	}
+}
+
+func (p *parser) term() (node, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, errors.New("unexpected end of template")
+	}
+	if c := p.s[p.pos]; c == '"' || c == '\'' {
+		p.pos++
+		nodes, err := p.text(c)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		return templateNode(nodes), nil
+	}
+	start := p.pos
+	name := p.ident()
+	if name == "" {
+		return nil, fmt.Errorf("unexpected %q at %d", p.s[p.pos], p.pos)
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return literalNode(name), nil
+	}
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return keywordNode(name), nil
+	}
+	p.pos++
+	nargs, ok := funcArgs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name, start)
+	}
+	call := &callNode{name: name}
+	for {
+		p.skipSpace()
+		if p.pos < len(p.s) && p.s[p.pos] == ')' && len(call.args) == 0 {
+			p.pos++
+			break
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return nil, errors.New("unexpected end of template")
+		}
+		if p.s[p.pos] == ')' {
+			p.pos++
+			break
+		}
+		if p.s[p.pos] != ',' {
+			return nil, fmt.Errorf("expected ',' or ')' at %d", p.pos)
+		}
+		p.pos++
+	}
+	if n := len(call.args); n < nargs[0] || n > nargs[1] {
+		if nargs[0] == nargs[1] {
+			return nil, fmt.Errorf("%s takes %d arguments", name, nargs[0])
+		}
+		return nil, fmt.Errorf("%s takes %d to %d arguments", name, nargs[0], nargs[1])
+	}
+	return call, nil
+}
+
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') && c != '_' {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"zombiezen.com/go/gg/internal/gitobj"
+)
+
+func TestExecute(t *testing.T) {
+	node, err := gitobj.ParseHash("0123456789abcdef0123456789abcdef01234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2018, time.July, 4, 13, 30, 0, 0, time.FixedZone("", -7*60*60))
+	newKeywords := func() Keywords {
+		return Keywords{
+			"node":     node,
+			"parents":  []gitobj.Hash{node, node},
+			"author":   "Jane Doe <jane@example.com>",
+			"date":     date,
+			"desc":     "Fix the thing\n\nIt was broken.\n",
+			"branches": []string{"master", "feature"},
+			"tags":     []string(nil),
+			"active":   true,
+			"changeid": func() (interface{}, error) { return "Iabc", nil },
+			"broken":   func() (interface{}, error) { return nil, errors.New("bork") },
+		}
+	}
+
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{template: "", want: ""},
+		{template: "hello", want: "hello"},
+		{template: `a\nb\tc\{d\}`, want: "a\nb\tc{d}"},
+		{template: "{node}", want: "0123456789abcdef0123456789abcdef01234567"},
+		{template: "{node|short}", want: "01234567"},
+		{template: "{ node | short }", want: "01234567"},
+		{template: "{parents|short}", want: "01234567 01234567"},
+		{template: "{author}", want: "Jane Doe <jane@example.com>"},
+		{template: "{author|person} {author|email}", want: "Jane Doe jane@example.com"},
+		{template: "{date|isodate}", want: "2018-07-04 13:30 -0700"},
+		{template: "{date|shortdate}", want: "2018-07-04"},
+		{template: "{date|rfc3339date}", want: "2018-07-04T13:30:00-07:00"},
+		{template: "{desc|firstline}", want: "Fix the thing"},
+		{template: "{desc|firstline|upper}", want: "FIX THE THING"},
+		{template: "{branches}", want: "master feature"},
+		{template: "{branches|count}", want: "2"},
+		{template: "{join(branches, ', ')}", want: "master, feature"},
+		{template: "{changeid}", want: "Iabc"},
+		{template: "{desc|firstline|json}", want: `"Fix the thing"`},
+		{template: "{tags|json}", want: "[]"},
+		{template: "{if(branches, '[{branches}]')}", want: "[master feature]"},
+		{template: "{if(tags, '[{tags}]')}", want: ""},
+		{template: "{if(tags, 'yes', 'no')}", want: "no"},
+		{template: `{if(active, "*", " ")}`, want: "*"},
+		{template: "{ifeq(changeid, 'Iabc', 'match', 'nope')}", want: "match"},
+		{template: "{ifeq(changeid, 'Ixyz', 'match', 'nope')}", want: "nope"},
+		{template: "{node|short}\n", want: "01234567\n"},
+		{template: "{pad(branches|count, 3)}|", want: "2  |"},
+		{template: "{pad(author, 4)}|", want: "Jane Doe <jane@example.com>|"},
+		{template: "{nosuch}", wantErr: true},
+		{template: "{broken}", wantErr: true},
+		{template: "{desc|short}", wantErr: true},
+		{template: "{author|isodate}", wantErr: true},
+		{template: "{node", wantErr: true},
+		{template: "{node|nosuch}", wantErr: true},
+		{template: "{nosuch()}", wantErr: true},
+		{template: "{if(node)}", wantErr: true},
+		{template: "{if(node, 'abc)}", wantErr: true},
+	}
+	for _, test := range tests {
+		tmpl, err := Parse(test.template)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("Parse(%q): %v", test.template, err)
+			}
+			continue
+		}
+		sb := new(strings.Builder)
+		err = tmpl.Execute(sb, newKeywords())
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("Execute(%q): %v", test.template, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("Execute(%q) = %q, <nil>; want error", test.template, sb.String())
+			continue
+		}
+		if got := sb.String(); got != test.want {
+			t.Errorf("Execute(%q) = %q; want %q", test.template, got, test.want)
+		}
+	}
+}
+
+func TestKeywordsJSON(t *testing.T) {
+	node, err := gitobj.ParseHash("0123456789abcdef0123456789abcdef01234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kw := Keywords{
+		"node":     node,
+		"date":     time.Date(2018, time.July, 4, 13, 30, 0, 0, time.UTC),
+		"tags":     []string(nil),
+		"active":   false,
+		"changeid": func() (interface{}, error) { return "Iabc", nil },
+	}
+	got, err := json.Marshal(kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"active":false,"changeid":"Iabc","date":"2018-07-04T13:30:00Z","node":"0123456789abcdef0123456789abcdef01234567","tags":[]}`
+	if string(got) != want {
+		t.Errorf("json.Marshal(kw) = %s; want %s", got, want)
+	}
+}